@@ -0,0 +1,20 @@
+// Command backfillslugs gives the products, categories and brands created before slugs existed a
+// slug generated from their name. It connects with the same DB_* environment variables as the API
+// and only touches records without a slug, so it can be run repeatedly.
+package main
+
+import (
+	"backend/config"
+	"backend/services"
+	"log"
+)
+
+func main() {
+	config.ConnectDatabase()
+
+	filled, err := services.BackfillSlugs(config.DB)
+	if err != nil {
+		log.Fatalf("backfilling slugs failed after %d records: %v", filled, err)
+	}
+	log.Printf("backfilled %d slugs", filled)
+}
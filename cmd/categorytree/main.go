@@ -0,0 +1,24 @@
+// Command categorytree builds the paths, depths and sibling positions of the categories from their
+// parents, which lets categories nest without the three level limit. It connects with the same
+// DB_* environment variables as the API and can be run repeatedly. Run cmd/searchindex afterwards
+// so search documents pick up the category paths.
+package main
+
+import (
+	"backend/config"
+	"backend/services"
+	"log"
+)
+
+func main() {
+	config.ConnectDatabase()
+
+	orphans, err := services.BuildCategoryTree(config.DB)
+	if err != nil {
+		log.Fatalf("building the category tree failed: %v", err)
+	}
+	if orphans > 0 {
+		log.Printf("%d categories are not below a top category, check their parents", orphans)
+	}
+	log.Println("category tree built")
+}
@@ -0,0 +1,19 @@
+// Command migratevariants converts variations stored as child products into product variants.
+// It connects with the same DB_* environment variables as the API and can be run repeatedly.
+package main
+
+import (
+	"backend/config"
+	"backend/services"
+	"log"
+)
+
+func main() {
+	config.ConnectDatabase()
+
+	result, err := services.MigrateChildVariants(config.DB)
+	log.Printf("migrated %d variants of %d products", result.Variants, result.Products)
+	if err != nil {
+		log.Fatalf("some products were not migrated, fix them and run again: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+// Command searchindex installs the pg_trgm extension and the search indexes, then rebuilds the
+// search document of every product. It connects with the same DB_* environment variables as the
+// API and can be run repeatedly.
+package main
+
+import (
+	"backend/config"
+	"backend/services"
+	"log"
+)
+
+func main() {
+	config.ConnectDatabase()
+
+	if err := services.PrepareSearchIndex(config.DB); err != nil {
+		log.Fatalf("preparing the search index failed: %v", err)
+	}
+	if err := services.RefreshSearchIndex(config.DB); err != nil {
+		log.Fatalf("rebuilding the search index failed: %v", err)
+	}
+	log.Println("search index rebuilt")
+}
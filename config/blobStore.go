@@ -0,0 +1,66 @@
+package config
+
+import (
+	"backend/models"
+	"backend/storage"
+	"log"
+	"os"
+	"strings"
+)
+
+// ConnectBlobStore sets up where uploaded images are kept. BLOB_STORE picks "local", the default,
+// or "s3" for Amazon S3 and compatible services such as MinIO.
+//
+// local: BLOB_DIR is the folder of the files ("uploads" by default) and BLOB_PUBLIC_URL the URL
+// they are served under ("/media" by default).
+//
+// s3: S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY address the bucket.
+// S3_PATH_STYLE=true puts the bucket in the path, as MinIO expects, and BLOB_PUBLIC_URL
+// optionally replaces the bucket URL in links, such as with a CDN.
+//
+// IMAGE_BASE_URL replaces "/api/images" in the links to processed images, such as with a CDN in
+// front of the API.
+func ConnectBlobStore() {
+	if url := os.Getenv("IMAGE_BASE_URL"); url != "" {
+		models.ImageURL = url
+	}
+
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		store := &storage.LocalStore{Dir: os.Getenv("BLOB_DIR"), BaseURL: os.Getenv("BLOB_PUBLIC_URL")}
+		if store.Dir == "" {
+			store.Dir = "uploads"
+		}
+		if store.BaseURL == "" {
+			store.BaseURL = "/media"
+		}
+		if err := os.MkdirAll(store.Dir, 0o755); err != nil {
+			log.Println(err.Error())
+			panic("Failed to prepare the blob folder !")
+		}
+		storage.Default = store
+	case "s3":
+		store := &storage.S3Store{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: strings.EqualFold(os.Getenv("S3_PATH_STYLE"), "true"),
+			PublicURL: os.Getenv("BLOB_PUBLIC_URL"),
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" {
+			store.Endpoint = "https://s3." + store.Region + ".amazonaws.com"
+		}
+		if store.Bucket == "" || store.AccessKey == "" || store.SecretKey == "" {
+			panic("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are needed by the s3 blob store !")
+		}
+		storage.Default = store
+	default:
+		panic("Unknown BLOB_STORE " + kind + " !")
+	}
+	log.Println("Blob store connected successfully !")
+}
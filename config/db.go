@@ -55,20 +55,59 @@ func ConnectDatabase() {
 	// 	models.CartItem{},
 	// 	models.Category{},
 	// 	models.CategoryImage{},
+	// 	models.Collection{},
+	// 	models.CollectionProduct{},
 	// 	models.ContentImage{},
 	// 	models.Coupon{},
+	// 	models.Currency{},
+	// 	models.CurrencySetting{},
 	// 	models.CouponUsageHistory{},
+	// 	models.GiftCard{},
+	// 	models.GiftCardTransaction{},
 	// 	models.Inventory{},
+	// 	models.Invoice{},
+	// 	models.InvoiceLine{},
+	// 	models.InvoiceSequence{},
+	// 	models.InvoiceSetting{},
+	// 	models.LoyaltyAccount{},
+	// 	models.LoyaltyCategoryMultiplier{},
+	// 	models.LoyaltySetting{},
+	// 	models.LoyaltyTransaction{},
 	// 	models.Order{},
 	// 	models.OrderItem{},
 	// 	models.Payment{},
 	// 	models.PaymentOption{},
+	// 	models.PriceHistory{},
+	// 	models.PriceSchedule{},
 	// 	models.Product{},
+	// 	models.Promotion{},
+	// 	models.PromotionTier{},
+	// 	models.PromotionBundleItem{},
+	// 	models.OrderPromotion{},
 	// 	models.ProductImage{},
+	// 	models.ProductOption{},
+	// 	models.ProductOptionValue{},
+	// 	models.ProductVariantValue{},
+	// 	models.ProductVariant{},
+	// 	models.VariantOptionValue{},
+	// 	models.Image{},
+	// 	models.ProductPrice{},
+	// 	models.ProductRelation{},
+	// 	models.ProductCoPurchase{},
+	// 	models.ProductDraft{},
+	// 	models.ProductRevision{},
 	// 	models.Review{},
 	// 	models.ShippingAddress{},
 	// 	models.ShoppingCart{},
+	// 	models.SlugRedirect{},
+	// 	models.StoreCreditAccount{},
+	// 	models.StoreCreditTransaction{},
 	// 	models.ShippingOptions{},
+	// 	models.Tag{},
+	// 	models.TaxClass{},
+	// 	models.TaxRate{},
+	// 	models.TaxSetting{},
+	// 	models.OrderTaxLine{},
 	// 	models.User{},
 	// 	models.ProductAttribute{},
 	// 	models.WishList{},
@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/services"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,6 +24,10 @@ func AddBrand(c *gin.Context) {
 
 	// Insert the category into the database
 	if err := config.DB.Create(&brand).Error; err != nil {
+		if models.IsImageError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -65,14 +70,39 @@ func UpdateBrand(c *gin.Context) {
 		return
 	}
 
+	current := ""
+	if brand.Permalink != nil {
+		current = *brand.Permalink
+	}
+
 	// Bind the updated data to the category
 	if err := c.ShouldBindJSON(&brand); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Save the updated category
-	if err := config.DB.Save(&brand).Error; err != nil {
+	// Save the updated brand, redirecting its old permalink when the permalink changed
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		requested := current
+		if brand.Permalink != nil {
+			requested = *brand.Permalink
+		}
+		slug := current
+		if requested != current {
+			var err error
+			if slug, err = services.ChangeSlug(tx, services.SlugBrand, brand.ID, current, requested); err != nil {
+				return err
+			}
+		}
+		brand.Permalink = &slug
+		return tx.Save(&brand).Error
+	})
+	if err != nil {
+		writeSlugError(c, err)
+		return
+	}
+	// product search documents contain the brand name
+	if err := services.RefreshBrandSearch(config.DB, brand.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -85,9 +115,9 @@ func UpdateBrand(c *gin.Context) {
 func DeleteBrand(c *gin.Context) {
 
 	brandID := c.Param("id")
-	var brand *models.Category
+	var brand *models.Brand
 
-	// Fetch the category from the database
+	// Fetch the brand from the database
 	if err := config.DB.First(&brand, brandID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Brand not found"})
@@ -97,9 +127,9 @@ func DeleteBrand(c *gin.Context) {
 		return
 	}
 
-	// Delete the category from the database
-	if err := config.DB.Delete(&brand).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Move the brand to the trash, unless products still have it
+	if err := services.TrashBrand(config.DB, *brand); err != nil {
+		writeTrashError(c, err)
 		return
 	}
 
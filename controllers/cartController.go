@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/services"
 	"net/http"
 	"strconv"
 
@@ -38,7 +39,7 @@ func GetShoppingCartByUserID(c *gin.Context) {
 	var shoppingCart *models.ShoppingCart
 
 	// Use Preload to load associated CartItems
-	if err := config.DB.Where("user_id = ?", userID).Preload("CartItems").Preload("CartItems.Product").First(&shoppingCart).Error; err != nil {
+	if err := config.DB.Where("user_id = ?", userID).Preload("CartItems").Preload("CartItems.Product").Preload("CartItems.Variant.Values").First(&shoppingCart).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Shopping cart not found"})
 		} else {
@@ -55,7 +56,7 @@ func GetWishlistByUserID(c *gin.Context) {
 	var wishList []*models.WishList
 
 	// Use Preload to load associated CartItems
-	if err := config.DB.Where("user_id = ?", userID).Preload("Product").Preload("Product.Images").Find(&wishList).Error; err != nil {
+	if err := config.DB.Where("user_id = ?", userID).Preload("Product").Preload("Product.Images", services.CoverImage).Find(&wishList).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "No wishlist found"})
 		} else {
@@ -120,6 +121,15 @@ func AddCartItem(c *gin.Context) {
 		return
 	}
 
+	if cartItem.VariantID != nil {
+		var count int64
+		config.DB.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *cartItem.VariantID, cartItem.ProductID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Variant does not belong to the product"})
+			return
+		}
+	}
+
 	// Save CartItem to the database
 	if err := config.DB.Create(&cartItem).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
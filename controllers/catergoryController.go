@@ -3,8 +3,10 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/services"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -26,6 +28,10 @@ func CreateCategory(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "CategoryType must be in ['parent', 'child']"})
 			return
 		}
+		if models.IsImageError(err) || errors.Is(err, models.ErrUnknownParent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -61,57 +67,108 @@ func GetCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, categories)
 }
 
+// GetNestedCategories returns the category tree, each category with its sub categories in their
+// order and the number of products in it and below it
 func GetNestedCategories(c *gin.Context) {
+	tree, err := services.CategoryTree(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// GetCategoryBreadcrumbs returns the categories from the top down to a category
+func GetCategoryBreadcrumbs(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category ID"})
+		return
+	}
+
+	crumbs, err := services.Breadcrumbs(config.DB, uint(categoryID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, crumbs)
+}
 
-	type Category struct {
-		ID       uint        `json:"id"`
-		Name     string      `json:"name"`
-		ParentID *uint       `json:"parent_id"` // Nullable for top-level categories
-		Level    int         `json:"level"`
-		Path     []int       `json:"-"` // Path to use for ordering; ignore in JSON
-		Children []*Category `json:"children,omitempty"`
-	}
-	var categories []*Category
-
-	query := `
-		WITH RECURSIVE category_hierarchy AS (
-			SELECT id, name, parent_id, 1 AS level, ARRAY[id] AS path
-			FROM categories
-			WHERE parent_id IS NULL
-			UNION ALL
-			SELECT c.id, c.name, c.parent_id, ch.level + 1, ch.path || c.id
-			FROM categories c
-			JOIN category_hierarchy ch ON c.parent_id = ch.id
-		)
-		SELECT id, name, parent_id, level, path
-		FROM category_hierarchy
-		ORDER BY path;`
-
-	if err := config.DB.Raw(query).Scan(&categories).Error; err != nil {
+// MoveCategory moves a category with its sub categories below another parent, or to the top
+// level when ParentID is left out, at Position among its new siblings
+func MoveCategory(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category ID"})
+		return
+	}
+	var payload struct {
+		ParentID *uint
+		Position *int // Last when left out
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category *models.Category
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		category, err = services.MoveCategory(tx, uint(categoryID), payload.ParentID, payload.Position)
+		return err
+	})
+	if err != nil {
+		writeCategoryTreeError(c, err)
+		return
+	}
+	// product search documents contain the names of the categories above
+	if err := services.RefreshCategorySearch(config.DB, category.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	buildCategoryTree := func(categories []*Category) []*Category {
-		categoryMap := make(map[uint]*Category)
-		var rootCategories []*Category
+	c.JSON(http.StatusOK, category)
+}
 
-		for i := range categories {
-			category := categories[i]           // Current category
-			categoryMap[category.ID] = category // Store in map
+// ReorderCategories orders the sub categories of ParentID, or the top level categories when it is
+// left out, as CategoryIDs lists them. Those left out follow in their current order.
+func ReorderCategories(c *gin.Context) {
+	var payload struct {
+		ParentID    *uint
+		CategoryIDs []uint `binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-			if category.ParentID == nil {
-				rootCategories = append(rootCategories, category) // Add to root if no parent
-			} else {
-				parent := categoryMap[*category.ParentID]
-				parent.Children = append(parent.Children, category) // Append to parent’s children
-			}
-		}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return services.ReorderCategories(tx, payload.ParentID, payload.CategoryIDs)
+	})
+	if err != nil {
+		writeCategoryTreeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Categories reordered"})
+}
 
-		return rootCategories
+// writeCategoryTreeError answers a failed change of the category tree
+func writeCategoryTreeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, services.ErrCategoryCycle) || errors.Is(err, services.ErrNotSiblings) || errors.Is(err, models.ErrUnknownParent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidSlug) || errors.Is(err, services.ErrSlugTaken):
+		writeSlugError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
-	nestedCategories := buildCategoryTree(categories)
-	c.JSON(http.StatusOK, nestedCategories)
 }
 
 func GetSubCategories(c *gin.Context) {
@@ -119,7 +176,7 @@ func GetSubCategories(c *gin.Context) {
 	var categories []*models.Category
 
 	// Use Preload to load associated Products for each category
-	if err := config.DB.Preload("Products").Where("parent_id = ?", parentID).Find(&categories).Error; err != nil {
+	if err := config.DB.Preload("Products").Where("parent_id = ?", parentID).Order("position ASC, id ASC").Find(&categories).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -163,14 +220,47 @@ func UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	current := category.Slug
+	before := *category
+
 	// Bind the updated data to the category
 	if err := c.ShouldBindJSON(&category); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Save the updated category
-	if err := config.DB.Save(&category).Error; err != nil {
+	// the place in the tree only changes through a move, which keeps the paths below consistent
+	parentID := category.ParentID
+	category.ParentID, category.Path, category.Depth, category.Position, category.CategoryType =
+		before.ParentID, before.Path, before.Depth, before.Position, before.CategoryType
+
+	// Save the updated category, redirecting its old slug when the slug changed
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if !sameCategory(parentID, before.ParentID) {
+			moved, err := services.MoveCategory(tx, category.ID, parentID, nil)
+			if err != nil {
+				return err
+			}
+			category.ParentID, category.Path, category.Depth, category.Position, category.CategoryType =
+				moved.ParentID, moved.Path, moved.Depth, moved.Position, moved.CategoryType
+		}
+		requested := category.Slug
+		category.Slug = current
+		if requested != current {
+			slug, err := services.ChangeSlug(tx, services.SlugCategory, category.ID, current, requested)
+			if err != nil {
+				return err
+			}
+			category.Slug = slug
+		}
+		return tx.Save(&category).Error
+	})
+	if err != nil {
+		writeCategoryTreeError(c, err)
+		return
+	}
+	// product search documents contain the category name
+	if err := services.RefreshCategorySearch(config.DB, category.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -195,12 +285,19 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	// Delete the category from the database
-	if err := config.DB.Delete(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Move the category to the trash, unless products or sub categories are still in it
+	if err := services.TrashCategory(config.DB, *category); err != nil {
+		writeTrashError(c, err)
 		return
 	}
 
 	// Return success message
 	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
 }
+
+func sameCategory(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
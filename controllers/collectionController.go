@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+type collectionPayload struct {
+	Name            string `binding:"required"`
+	Slug            string // Generated from the name when left empty
+	Description     string
+	MetaTitle       string
+	MetaDescription string
+	CollectionType  string                 `binding:"required,oneof=manual rules"`
+	Rules           models.CollectionRules `binding:"dive"`
+	Match           string                 // all or any, all by default
+	StartDate       *time.Time
+	EndDate         *time.Time
+	IsActive        *bool // true by default
+}
+
+// apply copies the payload onto a collection, leaving the slug to the caller
+func (p collectionPayload) apply(collection *models.Collection) {
+	collection.Name = p.Name
+	collection.Description = p.Description
+	collection.MetaTitle = p.MetaTitle
+	collection.MetaDescription = p.MetaDescription
+	collection.CollectionType = p.CollectionType
+	collection.Rules = p.Rules
+	if collection.Rules == nil {
+		collection.Rules = models.CollectionRules{}
+	}
+	collection.Match = p.Match
+	if collection.Match == "" {
+		collection.Match = "all"
+	}
+	collection.StartDate, collection.EndDate = p.StartDate, p.EndDate
+	collection.IsActive = p.IsActive == nil || *p.IsActive
+}
+
+// bindCollection binds and validates the payload of a collection, answering with the error when
+// it is invalid
+func bindCollection(c *gin.Context, collection *models.Collection) (collectionPayload, bool) {
+	var payload collectionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return payload, false
+	}
+	payload.apply(collection)
+	if collection.Match != "all" && collection.Match != "any" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Match must be all or any"})
+		return payload, false
+	}
+	if err := services.CheckCollection(*collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return payload, false
+	}
+	return payload, true
+}
+
+// collectionFromPath loads the collection of the id in the path, answering 404 when there is none
+func collectionFromPath(c *gin.Context) (*models.Collection, bool) {
+	var collection models.Collection
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &collection, true
+}
+
+// liveCollectionFromSlug loads the live collection of the slug in the path. A collection that is
+// inactive or outside its dates is not found.
+func liveCollectionFromSlug(c *gin.Context) (*models.Collection, bool) {
+	var collection models.Collection
+	if err := config.DB.Scopes(services.LiveCollection).Where("slug = ?", c.Param("slug")).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &collection, true
+}
+
+// CreateCollection adds a manual or rules collection. The products of a manual collection are
+// picked with SetCollectionProducts.
+func CreateCollection(c *gin.Context) {
+	var collection models.Collection
+	payload, ok := bindCollection(c, &collection)
+	if !ok {
+		return
+	}
+	if payload.Slug != "" && utils.Slugify(payload.Slug) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidSlug.Error()})
+		return
+	}
+	collection.Slug = payload.Slug
+
+	if err := config.DB.Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection)
+}
+
+// GetCollections lists the collections shown in the store now
+func GetCollections(c *gin.Context) {
+	var collections []*struct {
+		ID              uint
+		Name            string
+		Slug            string
+		Description     string
+		MetaTitle       string
+		MetaDescription string
+		StartDate       *time.Time
+		EndDate         *time.Time
+	}
+
+	model := config.DB.Model(&models.Collection{}).Scopes(services.LiveCollection).Order("collections.name ASC, collections.id ASC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&collections)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// GetAllCollections lists every collection, including those scheduled, ended or inactive, with
+// whether it is shown in the store now
+func GetAllCollections(c *gin.Context) {
+	var collections []*struct {
+		ID             uint
+		Name           string
+		Slug           string
+		CollectionType string
+		Rules          models.CollectionRules
+		Match          string
+		StartDate      *time.Time
+		EndDate        *time.Time
+		IsActive       bool
+		Live           bool
+		ProductCount   int // Products picked for a manual collection
+		UpdatedAt      time.Time
+	}
+
+	model := config.DB.Model(&models.Collection{}).
+		Select(`collections.id, collections.name, collections.slug, collections.collection_type, collections.rules,
+			collections.match, collections.start_date, collections.end_date, collections.is_active, collections.updated_at,
+			(collections.is_active AND (collections.start_date IS NULL OR collections.start_date <= NOW())
+				AND (collections.end_date IS NULL OR collections.end_date > NOW())) AS live,
+			(SELECT COUNT(*) FROM collection_products WHERE collection_products.collection_id = collections.id) AS product_count`).
+		Order("collections.updated_at DESC, collections.id DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&collections)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// GetCollection returns a collection with the products picked for it, in their order
+func GetCollection(c *gin.Context) {
+	var collection models.Collection
+	if err := config.DB.Preload("Products", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("id = ?", c.Param("id")).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// GetCollectionBySlug returns a collection shown in the store now
+func GetCollectionBySlug(c *gin.Context) {
+	collection, ok := liveCollectionFromSlug(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// UpdateCollection replaces the settings of a collection. Changing a manual collection to rules
+// drops the products picked for it.
+func UpdateCollection(c *gin.Context) {
+	collection, ok := collectionFromPath(c)
+	if !ok {
+		return
+	}
+	payload, ok := bindCollection(c, collection)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if payload.Slug != "" && payload.Slug != collection.Slug {
+			slug := utils.Slugify(payload.Slug)
+			if slug == "" {
+				return services.ErrInvalidSlug
+			}
+			unique, err := models.UniqueSlug(tx, "collections", "slug", slug, collection.ID)
+			if err != nil {
+				return err
+			}
+			if unique != slug {
+				return services.ErrSlugTaken
+			}
+			collection.Slug = slug
+		}
+		if collection.CollectionType != "manual" {
+			if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionProduct{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(collection).Error
+	})
+	if err != nil {
+		writeSlugError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection removes a collection from the store
+func DeleteCollection(c *gin.Context) {
+	collection, ok := collectionFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+}
+
+// SetCollectionProducts replaces the products picked for a manual collection, listed in the
+// order they are shown in
+func SetCollectionProducts(c *gin.Context) {
+	var payload struct {
+		ProductIDs []uint
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	collection, ok := collectionFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SetCollectionProducts(tx, *collection, payload.ProductIDs)
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrNotManual) || errors.Is(err, services.ErrUnknownProducts) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection products updated"})
+}
+
+// GetCollectionProducts lists the published products of a live collection, filtered, sorted and
+// paginated like GetProducts. A manual collection keeps the order its products were picked in
+// unless another sort is asked for.
+func GetCollectionProducts(c *gin.Context) {
+	collection, ok := liveCollectionFromSlug(c)
+	if !ok {
+		return
+	}
+	writeCollectionProducts(c, *collection, true)
+}
+
+// PreviewCollectionProducts lists the products of any collection, such as one scheduled for a
+// later campaign, including unpublished products unless filtered by status
+func PreviewCollectionProducts(c *gin.Context) {
+	collection, ok := collectionFromPath(c)
+	if !ok {
+		return
+	}
+	writeCollectionProducts(c, *collection, false)
+}
+
+func writeCollectionProducts(c *gin.Context, collection models.Collection, published bool) {
+	var params utils.Parameters
+	if c.Bind(&params) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
+		return
+	}
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
+	}
+	if published {
+		filter.Status = "published"
+	}
+
+	order := services.CuratedOrder(collection.ID)
+	if collection.CollectionType != "manual" || params.Sort != "" {
+		sort, ok := productSort(c, params, services.SortNewest, false)
+		if !ok {
+			return
+		}
+		order = sort.Scope()
+	}
+
+	scope, err := services.CollectionScope(collection)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	listProducts(c, converter, order, scope, filter.Scope(""))
+}
@@ -11,7 +11,8 @@ import (
 func AddBannerImages(c *gin.Context) {
 	var payload struct {
 		Position string
-		Image    []string
+		Image    []string // Base64 images
+		ImageIDs []uint   // Uploaded images
 	}
 
 	// Bind the incoming JSON to the Category struct
@@ -23,14 +24,24 @@ func AddBannerImages(c *gin.Context) {
 	var contents []models.ContentImage
 	for _, image := range payload.Image {
 		contents = append(contents, models.ContentImage{
-			Position: payload.Position,
-			Image:    image,
+			Position:    payload.Position,
+			StoredImage: models.StoredImage{Image: image},
 		})
 
 	}
+	for i := range payload.ImageIDs {
+		contents = append(contents, models.ContentImage{
+			Position:    payload.Position,
+			StoredImage: models.StoredImage{ImageID: &payload.ImageIDs[i]},
+		})
+	}
 
 	// Insert the category into the database
 	if err := config.DB.Create(&contents).Error; err != nil {
+		if models.IsImageError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// requestCurrency returns the currency a request asked for through the currency
+// query parameter or the X-Currency header, empty means the base currency
+func requestCurrency(c *gin.Context) string {
+	if currency := c.Query("currency"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return strings.ToUpper(c.GetHeader("X-Currency"))
+}
+
+// requestConverter returns a converter into the currency of the request and
+// writes a bad request response when the currency is not supported
+func requestConverter(c *gin.Context) (*services.Converter, bool) {
+	converter, err := services.NewConverter(config.DB, requestCurrency(c))
+	if err != nil {
+		if err == services.ErrUnsupportedCurrency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return converter, true
+}
+
+// localizePrices rewrites the prices of a product in place into the converter's currency.
+// compareAt, sale and effective may be nil for responses without those prices. It fails for
+// products priced in a currency that is unknown or no longer active.
+func localizePrices(converter *services.Converter, productID uint, currency *string, price *utils.Money, compareAt **utils.Money, sale **utils.Money, effective *utils.Money) error {
+	var compareAtPrice, salePrice *utils.Money
+	if compareAt != nil {
+		compareAtPrice = *compareAt
+	}
+	if sale != nil {
+		salePrice = *sale
+	}
+	onSale := effective != nil && salePrice != nil && *effective == *salePrice && *effective != *price
+
+	pricing, err := converter.ProductPricing(productID, *currency, *price, compareAtPrice, salePrice)
+	if err != nil {
+		return err
+	}
+	*price = pricing.Price
+	*currency = converter.Target
+	if compareAt != nil {
+		*compareAt = pricing.CompareAtPrice
+	}
+	if sale != nil {
+		*sale = pricing.SalePrice
+	}
+	if effective != nil {
+		*effective = pricing.Price
+		if onSale && pricing.SalePrice != nil {
+			*effective = *pricing.SalePrice
+		}
+	}
+	return nil
+}
+
+// GetCurrencies lists the active currencies and the base currency
+func GetCurrencies(c *gin.Context) {
+	setting, err := services.CurrencySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var currencies []models.Currency
+	query := config.DB.Order("code ASC")
+	if c.Query("include_inactive") != "true" {
+		query = query.Where("is_active = true")
+	}
+	if err := query.Find(&currencies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"BaseCurrency": setting.BaseCurrency, "Currencies": currencies})
+}
+
+// SetCurrency creates a currency or updates its exchange rate
+func SetCurrency(c *gin.Context) {
+	var currency models.Currency
+
+	if err := c.ShouldBindJSON(&currency); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency.Code = strings.ToUpper(strings.TrimSpace(currency.Code))
+	if len(currency.Code) != 3 || currency.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code must be a three letter currency code and Name is required"})
+		return
+	}
+	if currency.Rate <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must be greater than zero"})
+		return
+	}
+
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "symbol", "rate", "is_active", "updated_at"}),
+	}).Create(&currency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, currency)
+}
+
+// DeleteCurrency stops selling in a currency. Orders placed in it keep their locked rate.
+func DeleteCurrency(c *gin.Context) {
+	code := strings.ToUpper(c.Param("code"))
+
+	if err := config.DB.Model(&models.Currency{}).Where("code = ?", code).Update("is_active", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Currency deactivated"})
+}
+
+// UpdateCurrencySettings changes the base currency revenue is reported in
+func UpdateCurrencySettings(c *gin.Context) {
+	setting, err := services.CurrencySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setting.BaseCurrency = strings.ToUpper(strings.TrimSpace(setting.BaseCurrency))
+	if len(setting.BaseCurrency) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "BaseCurrency must be a three letter currency code"})
+		return
+	}
+
+	if err := config.DB.Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// GetProductPrices returns the fixed per currency prices of a product
+func GetProductPrices(c *gin.Context) {
+	productID := c.Param("id")
+	var prices []models.ProductPrice
+
+	if err := config.DB.Where("product_id = ?", productID).Order("currency ASC").Find(&prices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prices)
+}
+
+// SetProductPrice creates or updates the fixed price of a product in a currency
+func SetProductPrice(c *gin.Context) {
+	var product models.Product
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&product).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var price models.ProductPrice
+	if err := c.ShouldBindJSON(&price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	price.ID = 0
+	price.ProductID = product.ID
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+	if err := config.DB.Where("code = ?", price.Currency).First(&models.Currency{}).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrUnsupportedCurrency.Error()})
+		return
+	}
+	if price.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than zero"})
+		return
+	}
+
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "compare_at_price", "sale_price", "updated_at"}),
+	}).Create(&price).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "price saved"})
+}
+
+// DeleteProductPrice removes the fixed price of a product in a currency so it falls back to conversion
+func DeleteProductPrice(c *gin.Context) {
+	productID := c.Param("id")
+	currency := strings.ToUpper(c.Param("currency"))
+
+	if err := config.DB.Where("product_id = ? AND currency = ?", productID, currency).Delete(&models.ProductPrice{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "price removed"})
+}
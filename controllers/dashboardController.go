@@ -3,6 +3,8 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/services"
+	"backend/utils"
 	"net/http"
 	"strconv"
 	"time"
@@ -67,7 +69,7 @@ func GetTopSellingProducts(c *gin.Context) {
 // GetMonthlySales returns total sales for each month of the current year
 func GetMonthlySales(c *gin.Context) {
 	var monthlySales struct {
-		Revenue    float64
+		Revenue    utils.Money
 		Total      int
 		Completed  int
 		Pending    int
@@ -100,8 +102,9 @@ func GetMonthlySales(c *gin.Context) {
 	}
 	if err := config.DB.Raw(`
 		SELECT
-			SUM(amount) as revenue
+			SUM(payments.amount / COALESCE(NULLIF(orders.exchange_rate, 0), 1)) as revenue
 		FROM payments
+		JOIN orders ON orders.id = payments.order_id
 		WHERE payment_status = 'completed' AND
 		EXTRACT(MONTH FROM payment_date) = ? AND
 		EXTRACT(YEAR FROM payment_date) = ?`, currentMonth, currentYear).Find(&monthlySales).Error; err != nil {
@@ -122,9 +125,16 @@ func GetMonthlySales(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"message": "No data found"})
 		return
 	}
-	// Return the result
+	setting, err := services.CurrencySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve base currency"})
+		return
+	}
+
+	// Return the result, revenue is reported in the base currency
 	c.JSON(http.StatusOK, gin.H{
 		"Revenue":    monthlySales.Revenue,
+		"Currency":   setting.BaseCurrency,
 		"Completed":  monthlySales.Completed,
 		"Pending":    monthlySales.Pending,
 		"Cancelled":  monthlySales.Cancelled,
@@ -136,8 +146,8 @@ func GetMonthlySales(c *gin.Context) {
 // GetYearlyRevenue returns the revenue for the past 12 months
 func GetYearlyRevenue(c *gin.Context) {
 	var yearlyRevenue []struct {
-		Month   string  `json:"month"`
-		Revenue float64 `json:"revenue"`
+		Month   string      `json:"month"`
+		Revenue utils.Money `json:"revenue"`
 	}
 
 	// Get the current month and the month one year ago
@@ -148,16 +158,22 @@ func GetYearlyRevenue(c *gin.Context) {
 	if err := config.DB.Raw(`
 		SELECT 
 			TO_CHAR(DATE_TRUNC('month', orders.created_at), 'Mon YYYY') AS month, 
-			SUM(total_price) AS revenue
+			SUM(total_price / COALESCE(NULLIF(orders.exchange_rate, 0), 1)) AS revenue
 		FROM orders
-		LEFT JOIN payments ON payments.order_id = orders.id
-		WHERE orders.created_at BETWEEN ? AND ? AND payments.payment_status = 'completed'
+		WHERE orders.created_at BETWEEN ? AND ?
+		AND EXISTS (SELECT 1 FROM payments WHERE payments.order_id = orders.id AND payments.payment_status = 'completed')
 		GROUP BY month
 		ORDER BY month ASC`, startDate, now).Scan(&yearlyRevenue).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve yearly revenue"})
 		return
 	}
 
-	// Return the result
-	c.JSON(http.StatusOK, gin.H{"yearly_revenue": yearlyRevenue})
+	setting, err := services.CurrencySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve base currency"})
+		return
+	}
+
+	// Return the result, revenue is reported in the base currency
+	c.JSON(http.StatusOK, gin.H{"yearly_revenue": yearlyRevenue, "currency": setting.BaseCurrency})
 }
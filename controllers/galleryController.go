@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productFromPath loads the product of the id in the path, answering 404 when there is none
+func productFromPath(c *gin.Context) (*models.Product, bool) {
+	var product models.Product
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &product, true
+}
+
+// writeGalleryError answers a failed gallery change, mistakes in the request being the client's fault
+func writeGalleryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotInGallery):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrForeignVariant) || errors.Is(err, services.ErrColorlessPrimary) || models.IsImageError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetProductGallery lists every image of a product, variant images included, in gallery order
+func GetProductGallery(c *gin.Context) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	images, err := services.ProductGallery(config.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// AddProductImages appends uploaded images, given by ImageID, or base64 encoded ones to the
+// gallery of a product
+func AddProductImages(c *gin.Context) {
+	var payload struct {
+		Images []services.GalleryImageInput `binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, input := range payload.Images {
+		if input.ImageID == nil && input.Image == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "every image needs an ImageID or Image"})
+			return
+		}
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var images []models.ProductImage
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		images, err = services.AddGalleryImages(tx, product.ID, payload.Images)
+		return err
+	})
+	if err != nil {
+		writeGalleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, images)
+}
+
+// UpdateProductImage replaces the alt text, color and variant of a gallery image and makes it,
+// or stops it being, the primary image of the product or of its color
+func UpdateProductImage(c *gin.Context) {
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+	var payload services.GalleryImageUpdate
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var image *models.ProductImage
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		image, err = services.UpdateGalleryImage(tx, product.ID, uint(imageID), payload)
+		return err
+	})
+	if err != nil {
+		writeGalleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// ReorderProductImages puts the images of a product in the order of ImageIDs, the IDs of its
+// gallery images. Images left out keep their order after those listed.
+func ReorderProductImages(c *gin.Context) {
+	var payload struct {
+		ImageIDs []uint `binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var images []models.ProductImage
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.ReorderGallery(tx, product.ID, payload.ImageIDs); err != nil {
+			return err
+		}
+		var err error
+		images, err = services.ProductGallery(tx, product.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrNotInGallery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ImageIDs must be distinct images of the product"})
+			return
+		}
+		writeGalleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// DeleteProductImage removes an image from the gallery of a product
+func DeleteProductImage(c *gin.Context) {
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteGalleryImage(config.DB, product.ID, uint(imageID)); err != nil {
+		writeGalleryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image removed from the gallery"})
+}
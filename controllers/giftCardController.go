@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// createGiftCard stores a new gift card together with its issue ledger entry
+func createGiftCard(card *models.GiftCard, userID *uint) error {
+	code, err := utils.GenerateGiftCardCode()
+	if err != nil {
+		return err
+	}
+	card.Code = code
+	card.Balance = card.InitialBalance
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(card).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.GiftCardTransaction{
+			GiftCardID:      card.ID,
+			UserID:          userID,
+			TransactionType: "issue",
+			Amount:          card.InitialBalance,
+			BalanceAfter:    card.Balance,
+		}).Error
+	})
+}
+
+// IssueGiftCard lets an admin issue an active gift card
+func IssueGiftCard(c *gin.Context) {
+	var payload struct {
+		Amount         utils.Money `binding:"required,gt=0"`
+		Currency       string      `binding:"required,len=3"`
+		RecipientEmail *string
+		ExpirationDate *time.Time
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	card := models.GiftCard{
+		InitialBalance: payload.Amount,
+		Currency:       payload.Currency,
+		Source:         "issued",
+		RecipientEmail: payload.RecipientEmail,
+		ExpirationDate: payload.ExpirationDate,
+		IsActive:       true,
+	}
+	if err := createGiftCard(&card, &userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, card)
+}
+
+// PurchaseGiftCard creates a gift card bought by a customer. The card stays
+// inactive until an admin activates it once the payment has been received.
+func PurchaseGiftCard(c *gin.Context) {
+	var payload struct {
+		Amount         utils.Money `binding:"required,gt=0"`
+		Currency       string      `binding:"required,len=3"`
+		RecipientEmail *string
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	expiration := time.Now().AddDate(1, 0, 0)
+	card := models.GiftCard{
+		InitialBalance: payload.Amount,
+		Currency:       payload.Currency,
+		Source:         "purchased",
+		PurchasedBy:    &userID,
+		RecipientEmail: payload.RecipientEmail,
+		ExpirationDate: &expiration,
+		IsActive:       false,
+	}
+	if err := createGiftCard(&card, &userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create gift card"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "gift card created, pending payment", "ID": card.ID})
+}
+
+// GetGiftCards lists all gift cards
+func GetGiftCards(c *gin.Context) {
+	var cards []models.GiftCard
+	model := config.DB.Model(&models.GiftCard{}).Order("created_at DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&cards)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// GetGiftCard retrieves a gift card with its ledger
+func GetGiftCard(c *gin.Context) {
+	id := c.Param("id")
+	var card models.GiftCard
+
+	if err := config.DB.Preload("Transactions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC, id DESC")
+	}).Where("id = ?", id).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, card)
+}
+
+// UpdateGiftCard activates, deactivates or changes the expiry of a gift card
+func UpdateGiftCard(c *gin.Context) {
+	id := c.Param("id")
+	var payload struct {
+		IsActive       *bool
+		ExpirationDate *time.Time
+		RecipientEmail *string
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var card models.GiftCard
+	if err := config.DB.Where("id = ?", id).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if payload.IsActive != nil {
+		updates["is_active"] = *payload.IsActive
+	}
+	if payload.ExpirationDate != nil {
+		updates["expiration_date"] = *payload.ExpirationDate
+	}
+	if payload.RecipientEmail != nil {
+		updates["recipient_email"] = *payload.RecipientEmail
+	}
+
+	if err := config.DB.Model(&card).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gift card updated"})
+}
+
+// AdjustGiftCardBalance adds or removes value from a gift card
+func AdjustGiftCardBalance(c *gin.Context) {
+	id := c.Param("id")
+	var payload struct {
+		Amount utils.Money `binding:"required"`
+		Note   string      `binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var card models.GiftCard
+	if err := config.DB.Where("id = ?", id).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var entry *models.GiftCardTransaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = services.AdjustGiftCard(tx, card.ID, payload.Amount, "adjust", nil, &userID, payload.Note)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// CheckGiftCardBalance returns the remaining balance of a gift card by its code
+func CheckGiftCardBalance(c *gin.Context) {
+	code := c.Param("code")
+	var card models.GiftCard
+
+	if err := config.DB.Where("code = ? AND is_active = true", code).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found or inactive"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Balance":        card.Balance,
+		"Currency":       card.Currency,
+		"ExpirationDate": card.ExpirationDate,
+	})
+}
+
+// storeCreditResponse returns the balance and paginated ledger of a customer
+func storeCreditResponse(c *gin.Context, userID uint) {
+	balance, err := services.StoreCreditBalance(config.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var history []models.StoreCreditTransaction
+	model := config.DB.Model(&models.StoreCreditTransaction{}).Where("user_id = ?", userID).Order("created_at DESC, id DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&history)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Balance": balance, "History": page})
+}
+
+// GetMyStoreCredit returns the store credit of the logged in customer
+func GetMyStoreCredit(c *gin.Context) {
+	storeCreditResponse(c, c.GetUint("user_id"))
+}
+
+// GetCustomerStoreCredit returns the store credit of any customer
+func GetCustomerStoreCredit(c *gin.Context) {
+	var user models.User
+	if err := config.DB.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	storeCreditResponse(c, user.ID)
+}
+
+// AdjustCustomerStoreCredit issues store credit to a customer (manually or for a refund) or corrects it
+func AdjustCustomerStoreCredit(c *gin.Context) {
+	var payload struct {
+		UserID          uint        `binding:"required"`
+		Amount          utils.Money `binding:"required"`
+		TransactionType string      `binding:"required,oneof=issue refund adjust"`
+		OrderID         *uint
+		Note            string
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if payload.TransactionType != "adjust" && payload.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "issued or refunded credit must be positive"})
+		return
+	}
+	if payload.TransactionType == "refund" && payload.OrderID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OrderID is required for refunds"})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+	var entry *models.StoreCreditTransaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if payload.TransactionType == "refund" {
+			entry, err = refundStoreCredit(tx, payload.UserID, payload.Amount, *payload.OrderID, adminID, payload.Note)
+		} else {
+			entry, err = services.AdjustStoreCredit(tx, payload.UserID, payload.Amount, payload.TransactionType, payload.OrderID, &adminID, payload.Note)
+		}
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientCredit) || errors.Is(err, services.ErrInvalidCreditAmount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// refundStoreCredit refunds a base currency amount of an order as store credit and claws back
+// the share of loyalty points earned on the refunded amount
+func refundStoreCredit(tx *gorm.DB, userID uint, amount utils.Money, orderID uint, adminID uint, note string) (*models.StoreCreditTransaction, error) {
+	entry, err := services.AdjustStoreCredit(tx, userID, amount, "refund", &orderID, &adminID, note)
+	if err != nil {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := tx.Where("id = ?", orderID).First(&order).Error; err != nil {
+		return nil, err
+	}
+	// store credit is in the base currency, the order total in the currency of the order
+	if order.ExchangeRate > 0 {
+		amount = amount.MulRate(order.ExchangeRate)
+	}
+	return entry, services.ReverseRefundedPoints(tx, order.ID, amount, "order refunded")
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/storage"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// The limits of an image upload request
+const (
+	maxImageUploadSize  = 15 << 20 // Bytes of one file
+	maxImageUploadFiles = 20
+)
+
+// uploadContentTypes are the formats accepted, as sniffed from the data of a file
+var uploadContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UploadImages stores the images sent as multipart/form-data in "files". Optional "alt_text",
+// "color" and "position" fields, repeated in the order of the files, describe each image and are
+// the defaults of the records it is attached to. The answered ImageIDs are attached by giving them
+// as the ImageID of product, brand, category or banner images.
+func UploadImages(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImageUploadFiles*maxImageUploadSize+1<<20)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d files of %d MB can be uploaded at once", maxImageUploadFiles, maxImageUploadSize>>20)})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "files is required"})
+		return
+	}
+	if len(files) > maxImageUploadFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d files can be uploaded at once", maxImageUploadFiles)})
+		return
+	}
+	altTexts, colors, positions := form.Value["alt_text"], form.Value["color"], form.Value["position"]
+
+	type upload struct {
+		FileName string
+		Width    int
+		Height   int
+		Color    *string
+		Position int
+		models.StoredImage
+	}
+	uploads := make([]upload, len(files))
+	data := make([][]byte, len(files))
+	for i, header := range files {
+		uploads[i].FileName = header.Filename
+		if header.Size > maxImageUploadSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s is larger than %d MB", header.Filename, maxImageUploadSize>>20)})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data[i], err = io.ReadAll(io.LimitReader(file, maxImageUploadSize))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// the content type the client claims is not trusted
+		if !uploadContentTypes[http.DetectContentType(data[i])] {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": header.Filename + ": " + storage.ErrUnsupportedImage.Error()})
+			return
+		}
+
+		if i < len(altTexts) {
+			uploads[i].AltText = strings.TrimSpace(altTexts[i])
+		}
+		if i < len(colors) && strings.TrimSpace(colors[i]) != "" {
+			color := strings.TrimSpace(colors[i])
+			uploads[i].Color = &color
+		}
+		if i < len(positions) && positions[i] != "" {
+			if uploads[i].Position, err = strconv.Atoi(positions[i]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "position must be a whole number"})
+				return
+			}
+		}
+	}
+
+	for i := range uploads {
+		image, err := models.StoreImage(config.DB, data[i])
+		if err != nil {
+			if models.IsImageError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": uploads[i].FileName + ": " + err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// an identical earlier upload takes the description of the latest one
+		image.AltText, image.Color, image.Position = uploads[i].AltText, uploads[i].Color, uploads[i].Position
+		if err := config.DB.Model(image).Select("alt_text", "color", "position").Updates(image).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		uploads[i].Width, uploads[i].Height = image.Width, image.Height
+		uploads[i].Use(image)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"Images": uploads})
+}
+
+// imageCacheControl lets browsers and CDNs keep an image for a year, the files of an image ID
+// never change
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// GetImage serves the original of an image, or a rendition such as /api/images/12/card.webp
+func GetImage(c *gin.Context) {
+	var image models.Image
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	name := c.Param("rendition")
+	key, contentType, ok := image.File(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image has no rendition " + name})
+		return
+	}
+
+	etag := `"` + image.Hash
+	if name != "" && name != "original" {
+		etag += "-" + name
+	}
+	etag += `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", imageCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := storage.Default.Get(key)
+	if err != nil {
+		c.Header("ETag", "")
+		c.Header("Cache-Control", "no-store")
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image file is missing"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// etagMatches reports whether an If-None-Match header names etag, weakly compared as the header asks
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
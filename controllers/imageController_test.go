@@ -0,0 +1,28 @@
+package controllers
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"3f2a-card"`, true},
+		{`W/"3f2a-card"`, true},
+		{`"3f2a"`, false},
+		{`"3f2a-zoom", "3f2a-card"`, true},
+		{`"3f2a-zoom",W/"3f2a-card"`, true},
+		{`"3f2a-zoom"`, false},
+		{"*", true},
+		{"3f2a-card", false}, // an entity tag is quoted
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			if got := etagMatches(test.header, `"3f2a-card"`); got != test.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
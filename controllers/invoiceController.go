@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// canAccessOrder tells whether the current user is an admin or the buyer of the order
+func canAccessOrder(c *gin.Context, order models.Order) bool {
+	return c.GetString("role") == "admin" || order.UserID == c.GetUint("user_id")
+}
+
+// writeInvoiceDocument renders an invoice or credit note in the requested format, PDF by default
+func writeInvoiceDocument(c *gin.Context, invoice models.Invoice) {
+	seller, err := services.InvoiceSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buffer bytes.Buffer
+	if c.DefaultQuery("format", "pdf") == "html" {
+		if err := services.RenderInvoiceHTML(&buffer, invoice, seller); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buffer.Bytes())
+		return
+	}
+
+	if err := services.RenderInvoicePDF(&buffer, invoice, seller); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	c.Data(http.StatusOK, "application/pdf", buffer.Bytes())
+}
+
+// GetOrderInvoice downloads the invoice of an order, issuing it first for orders placed before invoicing
+func GetOrderInvoice(c *gin.Context) {
+	var order models.Order
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&order).Error; err != nil || !canAccessOrder(c, order) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var invoice *models.Invoice
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.IssueInvoice(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeInvoiceDocument(c, *invoice)
+}
+
+// GetOrderInvoices lists the invoice and credit notes of an order
+func GetOrderInvoices(c *gin.Context) {
+	var order models.Order
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&order).Error; err != nil || !canAccessOrder(c, order) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var invoices []models.Invoice
+	if err := config.DB.Preload("Lines").Where("order_id = ?", order.ID).Order("issued_at ASC, id ASC").Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+// GetInvoiceDocument downloads an invoice or credit note by its ID
+func GetInvoiceDocument(c *gin.Context) {
+	var invoice models.Invoice
+	if err := config.DB.Preload("Lines").Preload("Order").Where("id = ?", c.Param("id")).First(&invoice).Error; err != nil || !canAccessOrder(c, invoice.Order) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+
+	writeInvoiceDocument(c, invoice)
+}
+
+// CreateCreditNote credits items or shipping of an order and can refund the credited total as store credit
+func CreateCreditNote(c *gin.Context) {
+	var payload struct {
+		Lines               []services.CreditLine `binding:"dive"`
+		Shipping            utils.Money
+		Reason              string `binding:"required"`
+		RefundToStoreCredit bool
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if payload.Shipping < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping must not be negative"})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+	var note *models.Invoice
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		note, err = services.IssueCreditNote(tx, order.ID, payload.Lines, payload.Shipping, payload.Reason, &adminID)
+		if err != nil {
+			return err
+		}
+		// returned or credited goods no longer earn points, however the customer is refunded
+		if err := services.ReverseRefundedPoints(tx, order.ID, note.Total, "credit note "+note.Number); err != nil {
+			return err
+		}
+		if !payload.RefundToStoreCredit {
+			return nil
+		}
+
+		// store credit is kept in the base currency
+		amount := note.Total
+		if order.ExchangeRate > 0 {
+			amount = amount.DivRate(order.ExchangeRate)
+		}
+		_, err = services.AdjustStoreCredit(tx, order.UserID, amount, "refund", &order.ID, &adminID, "credit note "+note.Number)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToCredit) || errors.Is(err, services.ErrCreditExceedsInvoice) || errors.Is(err, services.ErrUnknownInvoiceLine) || errors.Is(err, services.ErrInvalidCreditAmount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
+
+// GetPackingSlips prints the packing slips of a batch of orders, one page per order
+func GetPackingSlips(c *gin.Context) {
+	var payload struct {
+		OrderIDs []uint `binding:"required,min=1"`
+		Format   string `binding:"omitempty,oneof=pdf html"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slips, err := services.LoadPackingSlips(config.DB, payload.OrderIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(slips) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No orders found"})
+		return
+	}
+
+	seller, err := services.InvoiceSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buffer bytes.Buffer
+	if payload.Format == "html" {
+		if err := services.RenderPackingSlipsHTML(&buffer, slips, seller); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buffer.Bytes())
+		return
+	}
+
+	if err := services.RenderPackingSlipsPDF(&buffer, slips, seller); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="packing-slips.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", buffer.Bytes())
+}
+
+// GetInvoiceSettings returns the seller details printed on invoices
+func GetInvoiceSettings(c *gin.Context) {
+	setting, err := services.InvoiceSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// UpdateInvoiceSettings changes the seller details printed on invoices
+func UpdateInvoiceSettings(c *gin.Context) {
+	setting, err := services.InvoiceSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loyaltyResponse returns the points balance and paginated ledger of a customer
+func loyaltyResponse(c *gin.Context, userID uint) {
+	balance, err := services.LoyaltyBalance(config.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setting, err := services.LoyaltySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var history []models.LoyaltyTransaction
+	model := config.DB.Model(&models.LoyaltyTransaction{}).Where("user_id = ?", userID).Order("created_at DESC, id DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&history)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Balance":      balance,
+		"BalanceValue": services.PointsValue(balance, setting),
+		"History":      page,
+	})
+}
+
+// GetMyLoyaltyPoints returns the points of the logged in customer
+func GetMyLoyaltyPoints(c *gin.Context) {
+	loyaltyResponse(c, c.GetUint("user_id"))
+}
+
+// GetCustomerLoyaltyPoints returns the points of any customer
+func GetCustomerLoyaltyPoints(c *gin.Context) {
+	var user models.User
+	if err := config.DB.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	loyaltyResponse(c, user.ID)
+}
+
+// AdjustLoyaltyPoints lets an admin add or remove points with a reason
+func AdjustLoyaltyPoints(c *gin.Context) {
+	var payload struct {
+		UserID uint   `binding:"required"`
+		Points int    `binding:"required"`
+		Reason string `binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, payload.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+	var entry *models.LoyaltyTransaction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = services.AdjustPoints(tx, user.ID, payload.Points, "adjust", nil, &adminID, payload.Reason)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientPoints) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// GetLoyaltySettings returns the loyalty configuration and category multipliers
+func GetLoyaltySettings(c *gin.Context) {
+	setting, err := services.LoyaltySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var multipliers []models.LoyaltyCategoryMultiplier
+	if err := config.DB.Find(&multipliers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Settings": setting, "CategoryMultipliers": multipliers})
+}
+
+// UpdateLoyaltySettings changes the earn rate, redemption value and minimum redemption
+func UpdateLoyaltySettings(c *gin.Context) {
+	setting, err := services.LoyaltySettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if setting.EarnRate < 0 || setting.RedemptionValue < 0 || setting.MinRedeemPoints < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "loyalty settings must not be negative"})
+		return
+	}
+
+	if err := config.DB.Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// SetLoyaltyMultiplier creates or updates the points multiplier of a category
+func SetLoyaltyMultiplier(c *gin.Context) {
+	var multiplier models.LoyaltyCategoryMultiplier
+
+	if err := c.ShouldBindJSON(&multiplier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if multiplier.Multiplier < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Multiplier must not be negative"})
+		return
+	}
+
+	multiplier.ID = 0
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "category_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"multiplier"}),
+	}).Create(&multiplier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "multiplier saved"})
+}
+
+// DeleteLoyaltyMultiplier removes the points multiplier of a category
+func DeleteLoyaltyMultiplier(c *gin.Context) {
+	categoryID := c.Param("category_id")
+
+	if err := config.DB.Where("category_id = ?", categoryID).Delete(&models.LoyaltyCategoryMultiplier{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "multiplier removed"})
+}
@@ -4,6 +4,7 @@ import (
 	"backend/config"
 	"backend/models"
 	"backend/serializers"
+	"backend/services"
 	"backend/utils"
 	"errors"
 	"fmt"
@@ -31,15 +32,63 @@ func CreateOrder(c *gin.Context) {
 		return
 
 	}
+	if order.PaymentDetails == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid payment method"})
+		return
+	}
+
+	// Prices, totals, tax, discounts and the payment are computed below, whatever the client sent for them is dropped
+	order.ID = 0
 	order.UserID = c.GetUint("user_id")
+	order.User = models.User{}
 	order.OrderStatus = "pending"
 	order.ItemPrice = 0.0
+	order.DiscountAmount = 0
+	order.ShippingCost = 0
+	order.TotalPrice = 0
+	order.TaxAmount = 0
+	order.ShippingTax = 0
+	order.Promotions = nil
+	order.TaxLines = nil
+	order.PointsRedeemed = 0
+	order.PaymentDetails = &models.Payment{PaymentMethod: order.PaymentDetails.PaymentMethod}
+	for i := range order.OrderItems {
+		order.OrderItems[i] = models.OrderItem{
+			ProductID: order.OrderItems[i].ProductID,
+			VariantID: order.OrderItems[i].VariantID,
+			Quantity:  order.OrderItems[i].Quantity,
+		}
+	}
 
 	if err := config.DB.Where("payment_method = ?", order.PaymentDetails.PaymentMethod).First(&shipping_option).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid payment method"})
 		return
 	}
 
+	// Lock in the currency of the order and its exchange rate to the base currency
+	currency := requestCurrency(c)
+	if order.Currency != nil && *order.Currency != "" {
+		currency = *order.Currency
+	}
+	converter, err := services.NewConverter(config.DB, currency)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid currency", "error": err.Error()})
+		return
+	}
+	order.Currency = &converter.Target
+	order.ExchangeRate = converter.Rate()
+	order.BaseCurrency = converter.Base
+
+	// Every item is priced in the currency of the order, at the sale or price list price of the day
+	if err := services.PriceOrderItems(config.DB, converter, order.OrderItems); err != nil {
+		if errors.Is(err, services.ErrUnknownOrderItem) || errors.Is(err, services.ErrUnsupportedCurrency) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid order items", "error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price order items"})
+		}
+		return
+	}
+
 	// Start a database transaction
 	tx := config.DB.Begin()
 
@@ -54,14 +103,18 @@ func CreateOrder(c *gin.Context) {
 
 	// Loop through the order items and create them, also update inventory for each product
 	for _, item := range order.OrderItems {
-		order.ItemPrice += item.PriceAtPurchase * float64(item.Quantity)
+		order.ItemPrice += item.PriceAtPurchase.Mul(item.Quantity)
 
 		var ProductID uint
 		tx.Model(&models.Product{}).Select("id").Where("id = ?", item.ProductID).First(&ProductID)
 
-		// Fetch the existing inventory record for the product
+		// Fetch the existing inventory record for the variant, or the product when it has none
 		var inventory models.Inventory
-		if err := tx.Where("product_id = ?", ProductID).First(&inventory).Error; err != nil {
+		stock := tx.Where("product_id = ? AND variant_id IS NULL", ProductID)
+		if item.VariantID != nil {
+			stock = tx.Where("product_id = ? AND variant_id = ?", ProductID, *item.VariantID)
+		}
+		if err := stock.First(&inventory).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
 			return
@@ -87,6 +140,37 @@ func CreateOrder(c *gin.Context) {
 
 	}
 
+	// Apply automatic promotions before any coupon. Promotions are defined in the base currency.
+	var lines []services.CartLine
+	for _, item := range order.OrderItems {
+		lines = append(lines, services.CartLine{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: converter.ToBase(item.PriceAtPurchase),
+		})
+	}
+	lines, err = services.LoadCartLines(tx, lines)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order items"})
+		return
+	}
+	applied, promotionDiscount, err := services.EvaluatePromotions(tx, lines)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate promotions"})
+		return
+	}
+	for _, promotion := range applied {
+		order.Promotions = append(order.Promotions, models.OrderPromotion{
+			PromotionID:    promotion.PromotionID,
+			Name:           promotion.Name,
+			DiscountAmount: converter.FromBase(promotion.DiscountAmount),
+		})
+	}
+	order.DiscountAmount += converter.FromBase(promotionDiscount)
+
 	if order.Coupon != "" {
 		coupon := ApplyCoupon(c, order.Coupon, order.UserID)
 		if coupon == nil {
@@ -95,19 +179,82 @@ func CreateOrder(c *gin.Context) {
 
 		}
 		if coupon.DiscountType == "percentage" {
-			order.DiscountAmount = order.DiscountAmount + order.ItemPrice*(coupon.DiscountValue/100)
+			order.DiscountAmount = order.DiscountAmount + order.ItemPrice.Percent(coupon.DiscountValue.Float64())
 		} else {
-			order.DiscountAmount = order.DiscountAmount + coupon.DiscountValue
+			order.DiscountAmount = order.DiscountAmount + converter.FromBase(coupon.DiscountValue)
 		}
 	}
 
-	order.ShippingCost = shipping_option.ShippingCost
+	if order.RedeemPoints > 0 {
+		value, used, err := services.RedeemLoyaltyPoints(tx, order.UserID, order.RedeemPoints, converter.ToBase(order.ItemPrice-order.DiscountAmount), order.ID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to redeem loyalty points", "error": err.Error()})
+			return
+		}
+		order.DiscountAmount += converter.FromBase(value)
+		order.PointsRedeemed = used
+	}
+
+	order.ShippingCost = converter.FromBase(shipping_option.ShippingCost)
 	order.TotalPrice = order.ItemPrice - order.DiscountAmount + order.ShippingCost
 
+	taxLines, err := applyOrderTax(tx, order, lines)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate tax"})
+		return
+	}
+	order.TaxLines = taxLines
+
+	// Gift cards and store credit pay first, the chosen payment method covers the remainder
+	remaining := order.TotalPrice
+	var redemptions []models.Payment
+
+	if order.GiftCardCode != "" {
+		redeemed, err := services.RedeemGiftCard(tx, order.GiftCardCode, remaining, converter.Target, order.UserID, order.ID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to redeem gift card", "error": err.Error()})
+			return
+		}
+		if redeemed > 0 {
+			redemptions = append(redemptions, redemptionPayment(order.ID, "gift_card", redeemed))
+			remaining -= redeemed
+		}
+	}
+
+	// Store credit is kept in the base currency
+	if order.UseStoreCredit && remaining > 0 {
+		redeemedBase, err := services.RedeemStoreCredit(tx, order.UserID, converter.ToBase(remaining), order.ID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to redeem store credit", "error": err.Error()})
+			return
+		}
+		if redeemed := utils.MinMoney(converter.FromBase(redeemedBase), remaining); redeemed > 0 {
+			redemptions = append(redemptions, redemptionPayment(order.ID, "store_credit", redeemed))
+			remaining -= redeemed
+		}
+	}
+
+	if len(redemptions) != 0 {
+		if err := tx.Create(&redemptions).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record redemptions"})
+			return
+		}
+	}
+
 	order.PaymentDetails.OrderID = order.ID
-	order.PaymentDetails.Amount = order.TotalPrice
+	order.PaymentDetails.Amount = remaining
 	order.PaymentDetails.TransanctionID = toPtr(utils.GenerateTransactionID())
 	order.PaymentDetails.PaymentStatus = "pending"
+	if order.PaymentDetails.Amount <= 0 {
+		now := time.Now()
+		order.PaymentDetails.PaymentStatus = "completed"
+		order.PaymentDetails.PaymentDate = &now
+	}
 
 	if err := tx.Save(&order).Error; err != nil {
 		tx.Rollback()
@@ -121,6 +268,12 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	if _, err := services.IssueInvoice(tx, order.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue invoice"})
+		return
+	}
+
 	// Commit the transaction
 	tx.Commit()
 
@@ -128,13 +281,100 @@ func CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "order created successfully", "OrderID": order.OrderIdentifier})
 }
 
+// applyOrderTax calculates the tax of an order, stores the rate and tax of every item and
+// adds the tax to the total when prices are exclusive. It returns the tax summary per rate.
+func applyOrderTax(tx *gorm.DB, order *models.Order, lines []services.CartLine) ([]models.OrderTaxLine, error) {
+	setting, err := services.TaxSettings(tx)
+	if err != nil {
+		return nil, err
+	}
+	order.PricesIncludeTax = setting.PricesIncludeTax
+
+	// order level discounts are spread over the items by their share of the item price
+	weights := make([]utils.Money, len(order.OrderItems))
+	for i, item := range order.OrderItems {
+		weights[i] = item.PriceAtPurchase.Mul(item.Quantity)
+	}
+	discounts := utils.MinMoney(order.DiscountAmount, order.ItemPrice).Allocate(weights)
+
+	request := services.TaxRequest{
+		Address:          services.TaxAddress{Country: order.ShippingCountry, Region: order.ShippingRegion},
+		Shipping:         order.ShippingCost,
+		PricesIncludeTax: setting.PricesIncludeTax,
+	}
+	for i, item := range order.OrderItems {
+		line := services.TaxLine{
+			Reference: i,
+			ProductID: item.ProductID,
+			Amount:    weights[i] - discounts[i],
+		}
+		if i < len(lines) {
+			line.TaxClassID = lines[i].TaxClassID
+		}
+		request.Lines = append(request.Lines, line)
+	}
+
+	result, err := services.NewTaxCalculator(tx).Calculate(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range result.Lines {
+		if line.Reference < 0 || line.Reference >= len(order.OrderItems) {
+			return nil, fmt.Errorf("tax calculated for unknown line %d", line.Reference)
+		}
+		item := &order.OrderItems[line.Reference]
+		item.TaxRate = line.Rate
+		item.TaxAmount = line.TaxAmount
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"tax_rate":   line.Rate,
+			"tax_amount": line.TaxAmount,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	order.TaxAmount = result.TotalTax
+	order.ShippingTax = result.ShippingTax
+	if !setting.PricesIncludeTax {
+		order.TotalPrice += result.TotalTax
+	}
+
+	var taxLines []models.OrderTaxLine
+	for _, entry := range result.Breakdown {
+		taxLines = append(taxLines, models.OrderTaxLine{
+			OrderID:       order.ID,
+			Name:          entry.Name,
+			Rate:          entry.Rate,
+			TaxableAmount: entry.TaxableAmount,
+			TaxAmount:     entry.TaxAmount,
+		})
+	}
+	return taxLines, nil
+}
+
+// redemptionPayment builds the completed payment recorded for a gift card or store credit redemption
+func redemptionPayment(orderID uint, method string, amount utils.Money) models.Payment {
+	now := time.Now()
+	return models.Payment{
+		PaymentMethod:  method,
+		PaymentStatus:  "completed",
+		Amount:         amount,
+		TransanctionID: toPtr(utils.GenerateTransactionID()),
+		PaymentDate:    &now,
+		OrderID:        orderID,
+	}
+}
+
 // GetOrder retrieves an order by ID along with its items
 func GetOrderByID(c *gin.Context) {
 	orderID := c.Param("id")
 	var order *serializers.OrderResponse
 
 	// Preload OrderItems to include them in the response
-	if err := config.DB.Model(&models.Order{}).Preload("User").Preload("PaymentDetails").Preload("OrderItems.Product").First(&order, orderID).Error; err != nil {
+	if err := config.DB.Model(&models.Order{}).Preload("User").Preload("PaymentDetails", "payment_method NOT IN ?", []string{"gift_card", "store_credit"}).Preload("Payments").Preload("Promotions").Preload("TaxLines").Preload("Invoices", func(db *gorm.DB) *gorm.DB {
+		return db.Order("issued_at ASC, id ASC")
+	}).Preload("OrderItems.Product").Preload("OrderItems.Variant.Values").Where("id = ?", orderID).First(&order).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		} else {
@@ -142,6 +382,11 @@ func GetOrderByID(c *gin.Context) {
 		}
 		return
 	}
+	// other customers' orders are answered as missing, like their invoices
+	if !canAccessOrder(c, models.Order{UserID: order.UserID}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
 
 	// Return the order with its items
 	c.JSON(http.StatusOK, order)
@@ -154,11 +399,11 @@ func GetOrders(c *gin.Context) {
 	if c.GetString("role") == "admin" {
 
 		// Preload OrderItems to include them in the response
-		model = config.DB.Model(&models.Order{}).Preload("User").Preload("PaymentDetails").Preload("OrderItems.Product").Order("created_at DESC")
+		model = config.DB.Model(&models.Order{}).Preload("User").Preload("PaymentDetails").Preload("OrderItems.Product").Preload("OrderItems.Variant.Values").Order("created_at DESC")
 
 	} else {
 		// Preload OrderItems to include them in the response
-		model = config.DB.Model(&models.Order{}).Preload("User").Preload("OrderItems.Product").Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC")
+		model = config.DB.Model(&models.Order{}).Preload("User").Preload("OrderItems.Product").Preload("OrderItems.Variant.Values").Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC")
 
 	}
 
@@ -198,8 +443,8 @@ func CancelOrder(c *gin.Context) {
 
 	orderID := c.Param("id")
 
-	// Fetch the category from the database
-	if err := config.DB.Model(&models.Order{}).Where("id = ?", orderID).Update("order_status", "cancelled").Error; err != nil {
+	var order models.Order
+	if err := config.DB.Where("id = ?", orderID).First(&order).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		} else {
@@ -208,6 +453,21 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
+	// Cancel the order and give back any gift card, store credit or points spent on it
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Update("order_status", "cancelled").Error; err != nil {
+			return err
+		}
+		if err := services.ReverseOrderRedemptions(tx, order.ID); err != nil {
+			return err
+		}
+		return services.ReverseOrderPoints(tx, order.ID, 1, true, "order cancelled")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Return the updated category
 	c.JSON(http.StatusOK, gin.H{"message": "order cancelled"})
 }
@@ -226,7 +486,8 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Model(&models.Order{}).Where("id = ?", orderID).Update("order_status", payload.OrderStatus).Error; err != nil {
+	var order models.Order
+	if err := config.DB.Where("id = ?", orderID).First(&order).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		} else {
@@ -235,6 +496,28 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Update("order_status", payload.OrderStatus).Error; err != nil {
+			return err
+		}
+
+		switch payload.OrderStatus {
+		case "delivered":
+			_, err := services.AwardOrderPoints(tx, order.ID)
+			return err
+		case "cancelled":
+			if err := services.ReverseOrderRedemptions(tx, order.ID); err != nil {
+				return err
+			}
+			return services.ReverseOrderPoints(tx, order.ID, 1, true, "order cancelled")
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Return the updated category
 	c.JSON(http.StatusOK, gin.H{"message": "order status updated"})
 }
@@ -251,8 +534,12 @@ func RestockProduct(c *gin.Context) {
 
 	var existingInventory models.Inventory
 
-	// Check if an inventory record already exists for the given product
-	if err := config.DB.Where("product_id = ?", inventoryRequest.ProductID).First(&existingInventory).Error; err != nil {
+	// Check if an inventory record already exists for the given product or variant
+	stock := config.DB.Where("product_id = ? AND variant_id IS NULL", inventoryRequest.ProductID)
+	if inventoryRequest.VariantID != nil {
+		stock = config.DB.Where("product_id = ? AND variant_id = ?", inventoryRequest.ProductID, *inventoryRequest.VariantID)
+	}
+	if err := stock.First(&existingInventory).Error; err != nil {
 		// If no existing record, create a new one
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			inventoryRequest.ChangeType = "restock"
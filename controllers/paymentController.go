@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/utils"
 	"net/http"
 	"time"
 
@@ -59,22 +60,22 @@ func GetAllPayments(c *gin.Context) {
 
 	type Order struct {
 		gorm.Model
-		OrderIdentifier      string  `gorm:"type:varchar(8); not null;unique;index"`
-		OrderStatus          string  `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled')"`
-		Currency             *string `gorm:"size:3; not null"`
-		TotalPrice           float64 `gorm:"type:decimal(10,2);not null"`
-		ItemPrice            float64 `gorm:"type:decimal(10,2);not null"`
-		DiscountAmount       float64 `gorm:"type:decimal(10,2);default:0;not null"`
-		ShippingCost         float64 `gorm:"type:decimal(10,2);default:0;not null"`
-		OrderShippingAddress string  `gorm:"type:text"`
+		OrderIdentifier      string      `gorm:"type:varchar(8); not null;unique;index"`
+		OrderStatus          string      `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled')"`
+		Currency             *string     `gorm:"size:3; not null"`
+		TotalPrice           utils.Money `gorm:"type:decimal(10,2);not null"`
+		ItemPrice            utils.Money `gorm:"type:decimal(10,2);not null"`
+		DiscountAmount       utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+		ShippingCost         utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+		OrderShippingAddress string      `gorm:"type:text"`
 	}
 
 	type Payment struct {
 		gorm.Model
-		PaymentMethod  string  `gorm:"size:50;not null;check:payment_method IN ('cash_on_delivery', 'paypal')"`
-		PaymentStatus  string  `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed')"`
-		Amount         float64 `gorm:"type:decimal(10,2);not null"`
-		TransanctionID *string `gorm:"size:11;not null"`
+		PaymentMethod  string      `gorm:"size:50;not null;check:payment_method IN ('cash_on_delivery', 'paypal', 'gift_card', 'store_credit')"`
+		PaymentStatus  string      `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed', 'refunded')"`
+		Amount         utils.Money `gorm:"type:decimal(10,2);not null"`
+		TransanctionID *string     `gorm:"size:11;not null"`
 		PaymentDate    *time.Time
 		OrderID        uint  `gorm:"not null"`
 		Order          Order `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
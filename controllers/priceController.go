@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// CreatePriceSchedule schedules a price change for a product
+func CreatePriceSchedule(c *gin.Context) {
+	productID := c.Param("id")
+	var payload struct {
+		Price       utils.Money `binding:"required,gt=0"`
+		EffectiveAt time.Time   `binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var product models.Product
+	if err := config.DB.Where("id = ?", productID).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if payload.EffectiveAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "EffectiveAt must be in the future"})
+		return
+	}
+	variations, err := services.HasOwnPricedVariations(config.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if variations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrVariationPrices.Error()})
+		return
+	}
+
+	schedule := models.PriceSchedule{
+		ProductID:   product.ID,
+		Price:       payload.Price,
+		EffectiveAt: payload.EffectiveAt,
+		CreatedBy:   c.GetUint("user_id"),
+	}
+	if err := config.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price change"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// GetPriceSchedules lists the scheduled price changes of a product
+func GetPriceSchedules(c *gin.Context) {
+	productID := c.Param("id")
+	var schedules []models.PriceSchedule
+
+	if err := config.DB.Where("product_id = ?", productID).Order("effective_at ASC").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// DeletePriceSchedule cancels a scheduled price change that has not been applied yet
+func DeletePriceSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+	var schedule models.PriceSchedule
+
+	if err := config.DB.Where("id = ?", scheduleID).First(&schedule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price schedule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if schedule.AppliedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price schedule has already been applied"})
+		return
+	}
+
+	if err := config.DB.Delete(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price schedule cancelled"})
+}
+
+// GetPriceHistory returns the audit trail of price changes for a product
+func GetPriceHistory(c *gin.Context) {
+	productID := c.Param("id")
+
+	type User struct {
+		ID   uint   `gorm:"primarykey"`
+		Name string `gorm:"size:100;not null"`
+	}
+	var history []*struct {
+		ID        uint `gorm:"primaryKey"`
+		ProductID uint
+		PriceType string
+		OldPrice  *utils.Money
+		NewPrice  *utils.Money
+		Source    string
+		ChangedBy *uint
+		User      *User `gorm:"foreignKey:ChangedBy"`
+		ChangedAt time.Time
+	}
+
+	model := config.DB.Model(&models.PriceHistory{}).Preload("User").Where("product_id = ?", productID).Order("changed_at DESC, id DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&history)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
@@ -3,14 +3,15 @@ package controllers
 import (
 	"backend/config"
 	"backend/models"
+	"backend/services"
 	"backend/utils"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 	"github.com/morkid/paginate"
 	"gopkg.in/guregu/null.v4"
 	"gorm.io/gorm"
@@ -28,45 +29,80 @@ func CreateProduct(c *gin.Context) {
 		Variation []Variation
 	}
 	var payload struct {
-		Name        string  `gorm:"size:150;not null"`
-		Description string  `gorm:"type:text"`
-		SKU         string  `gorm:"size:150;not null;unique;index"`
-		Barcode     *string `gorm:"size:150"`
-		Price       float64 `gorm:"type:decimal(10,2);not null"`
-		Currency    string  `gorm:"size:3; not null"`
-		CategoryID  uint    `gorm:"not null"`
-		Status      *string `gorm:"not null;check:status IN ('published', 'unpublished')"`
-		Featured    bool    `gorm:"default:false"`
-		Stock       uint    `gorm:"-"`
-		IsChild     bool    `gorm:"default:false"`
-		ParentID    *uint
-		Color       string
-		Size        string
-		BrandID     *uint
-		Attributes  []Attributes
-		Images      []models.ProductImage `gorm:"foreignKey:ProductID"`
+		Name            string `gorm:"size:150;not null"`
+		Slug            string // Generated from the name when empty
+		MetaTitle       string
+		MetaDescription string
+		Description     string      `gorm:"type:text"`
+		SKU             string      `gorm:"size:150;not null;unique;index"`
+		Barcode         *string     `gorm:"size:150"`
+		Price           utils.Money `gorm:"type:decimal(10,2);not null"`
+		Currency        string      `gorm:"size:3; not null"`
+		CompareAtPrice  *utils.Money
+		SalePrice       *utils.Money
+		SaleStartDate   *time.Time
+		SaleEndDate     *time.Time
+		CategoryID      uint    `gorm:"not null"`
+		Status          *string `gorm:"not null;check:status IN ('published', 'unpublished')"`
+		PublishAt       *time.Time
+		UnpublishAt     *time.Time
+		Featured        bool `gorm:"default:false"`
+		Stock           uint `gorm:"-"`
+		IsChild         bool `gorm:"default:false"`
+		ParentID        *uint
+		Color           string
+		Size            string
+		BrandID         *uint
+		TaxClassID      *uint
+		Attributes      []Attributes            // Color and size variations, kept for older clients
+		Options         []services.OptionInput  `binding:"dive"`
+		Variants        []services.VariantInput `binding:"dive"`
+		Images          []models.ProductImage   `gorm:"foreignKey:ProductID"`
 	}
 
 	if err := c.BindJSON(&payload); err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := services.CheckPublishSchedule(payload.PublishAt, payload.UnpublishAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// prices are converted from the currency of the product, which must be one the store supports
+	if _, err := services.NewConverter(config.DB, payload.Currency); err != nil {
+		if errors.Is(err, services.ErrUnsupportedCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
 
 	tx := config.DB.Begin()
 	parent := models.Product{
-		Name:        payload.Name,
-		Description: payload.Description,
-		SKU:         payload.SKU,
-		Barcode:     payload.Barcode,
-		Price:       payload.Price,
-		Currency:    payload.Currency,
-		CategoryID:  payload.CategoryID,
-		BrandID:     payload.BrandID,
-		Status:      payload.Status,
-		Featured:    payload.Featured,
-		Color:       payload.Color,
-		Size:        payload.Size,
-		Images:      payload.Images,
+		Name:            payload.Name,
+		Slug:            payload.Slug,
+		MetaTitle:       payload.MetaTitle,
+		MetaDescription: payload.MetaDescription,
+		Description:     payload.Description,
+		SKU:             payload.SKU,
+		Barcode:         payload.Barcode,
+		Price:           payload.Price,
+		Currency:        payload.Currency,
+		CompareAtPrice:  payload.CompareAtPrice,
+		SalePrice:       payload.SalePrice,
+		SaleStartDate:   payload.SaleStartDate,
+		SaleEndDate:     payload.SaleEndDate,
+		CategoryID:      payload.CategoryID,
+		TaxClassID:      payload.TaxClassID,
+		BrandID:         payload.BrandID,
+		Status:          payload.Status,
+		PublishAt:       payload.PublishAt,
+		UnpublishAt:     payload.UnpublishAt,
+		Featured:        payload.Featured,
+		Color:           payload.Color,
+		Size:            payload.Size,
+		Images:          payload.Images,
 		Inventory: &models.Inventory{
 			StockLevel: int(payload.Stock),
 			InOpen:     0,
@@ -77,60 +113,68 @@ func CreateProduct(c *gin.Context) {
 
 	if err := tx.Create(&parent).Error; err != nil {
 		tx.Rollback()
+		if models.IsImageError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 		return
 	}
 
-	if len(payload.Attributes) != 0 {
-		var variations []models.Product
-		var images []models.ProductImage
-
+	// the color and size attributes are a two dimensional case of options
+	if len(payload.Attributes) != 0 && len(payload.Options) == 0 {
+		color := services.OptionInput{Name: "Color"}
+		size := services.OptionInput{Name: "Size"}
+		sizes := make(map[string]bool)
 		for _, attribute := range payload.Attributes {
-
+			color.Values = append(color.Values, services.OptionValueInput{Value: attribute.Color, Image: attribute.Image})
 			for _, variation := range attribute.Variation {
-
-				variations = append(variations, models.Product{
-					Name:        parent.Name,
-					Description: parent.Description,
-					SKU:         parent.SKU + "-" + attribute.Color + "-" + variation.Size,
-					Barcode:     parent.Barcode,
-					Price:       parent.Price,
-					Currency:    parent.Currency,
-					CategoryID:  parent.CategoryID,
-					Status:      parent.Status,
-					IsChild:     true,
-					ParentID:    &parent.ID,
-					Color:       attribute.Color,
-					Size:        variation.Size,
-					BrandID:     parent.BrandID,
-					Inventory: &models.Inventory{
-						StockLevel: variation.Quantity,
-						InOpen:     0,
-						ChangeType: "restock",
-						ChangeDate: time.Now(),
-					},
+				if !sizes[variation.Size] {
+					sizes[variation.Size] = true
+					size.Values = append(size.Values, services.OptionValueInput{Value: variation.Size})
+				}
+				payload.Variants = append(payload.Variants, services.VariantInput{
+					Values:   []string{attribute.Color, variation.Size},
+					Quantity: variation.Quantity,
 				})
-
 			}
-			images = append(images, models.ProductImage{
-				ProductID: parent.ID,
-				Image:     attribute.Image,
-				Color:     &attribute.Color,
-			})
-
 		}
+		payload.Options = []services.OptionInput{color}
+		if len(size.Values) != 0 {
+			payload.Options = append(payload.Options, size)
+		} else {
+			for i := range payload.Variants {
+				payload.Variants[i].Values = payload.Variants[i].Values[:1]
+			}
+		}
+	}
 
-		if err := tx.Create(&variations).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create variations", "error": err.Error()})
-			return
+	if len(payload.Options) != 0 {
+		options, err := services.CreateProductOptions(tx, parent.ID, payload.Options)
+		if err == nil {
+			_, err = services.CreateVariantMatrix(tx, parent, options, payload.Variants)
 		}
-		if err := tx.Create(&images).Error; err != nil {
+		if err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create Variation images", "error": err.Error()})
+			if errors.Is(err, services.ErrDuplicateOption) || errors.Is(err, services.ErrIncompleteOption) || errors.Is(err, services.ErrTooManyVariants) || models.IsImageError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create variations", "error": err.Error()})
+			}
 			return
 		}
+	}
 
+	if err := services.RefreshSearchIndex(tx, parent.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("user_id")
+	if err := services.RecordRevision(tx, nil, parent, "create", &userID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	tx.Commit()
@@ -138,46 +182,226 @@ func CreateProduct(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Product added successfully"})
 }
 
-// GetProducts retrieves all products with their category and reviews
+// SearchProducts ranks published products by how well they match the key, tolerating typos in
+// product names, and returns result cards with the matched words highlighted
 func SearchProducts(c *gin.Context) {
 	var params utils.Parameters
 	if c.Bind(&params) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
 		return
 	}
-
-	searchQuery := ""
-
-	if params.Key != "" {
-		searchQuery = "products.name ILIKE '%" + params.Key + "%' OR sku ILIKE '%" + params.Key + "%' OR categories.name ILIKE '%" + params.Key + "%' OR brands.name ILIKE '%" + params.Key + "%' OR size ILIKE '%" + params.Key + "%'"
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
+	}
+	fallback := services.SortName
+	if services.SearchTerms(params.Key) != "" {
+		fallback = services.SortRelevance
+	}
+	sort, ok := productSort(c, params, fallback, true)
+	if !ok {
+		return
 	}
 
+	type Brand struct {
+		ID   uint        `gorm:"primarykey"`
+		Name null.String `gorm:"size:100;not null"`
+	}
+	type Category struct {
+		ID   uint        `gorm:"primarykey"`
+		Name null.String `gorm:"size:100;not null"`
+	}
 	type Product struct {
-		ID   uint   `gorm:"primarykey"`
-		Name string `gorm:"size:150;not null"`
-		// Description  string          `gorm:"type:text"`
+		ID              uint `gorm:"primarykey"`
+		Name            string
+		NameHighlight   string  `gorm:"column:name_highlight"` // Name with the matched words in <mark> tags
+		Snippet         string  `gorm:"column:snippet"`        // Highlighted fragments of the description
+		Rank            float64 `gorm:"column:rank"`
+		SKU             string
+		Price           utils.Money
+		Currency        string
+		CompareAtPrice  *utils.Money
+		SalePrice       *utils.Money
+		SaleStartDate   *time.Time
+		SaleEndDate     *time.Time
+		EffectivePrice  utils.Money `gorm:"column:effective_price"`
+		BrandID         *uint
+		Brand           Brand `gorm:"foreignKey:BrandID"`
+		CategoryID      uint
+		Category        Category              `gorm:"foreignKey:CategoryID"`
+		Images          []models.ProductImage `gorm:"foreignKey:ProductID"`
+		InventoryStatus bool                  `gorm:"column:inventory_status"`
+		TotalReviews    int
+		Rating          int
 	}
 
 	var products []*Product
+	var page paginate.Page
+
+	err := services.SearchTransaction(config.DB, func(tx *gorm.DB) error {
+		model := tx.Model(&products).Preload("Brand").Preload("Category").Preload("Images", services.CoverImage).
+			Joins("LEFT JOIN reviews ON products.id = reviews.product_id").
+			Where("products.status = ? AND products.is_child = false", "published").
+			Scopes(filter.Scope("")).
+			Group("products.id")
+		model = services.ProductSearch(model, params.Key, `products.id, products.name, products.sku, products.price, products.currency,
+			products.compare_at_price, products.sale_price, products.sale_start_date, products.sale_end_date,
+			products.brand_id, products.category_id,
+			`+utils.EffectivePriceColumn+` AS effective_price,
+			count(reviews.id) as total_reviews,
+			AVG(reviews.rating)::int as rating,
+			EXISTS (
+				SELECT 1
+				FROM inventories
+				WHERE inventories.product_id = products.id
+				AND inventories.stock_level > 0
+				AND inventories.deleted_at IS NULL
+			) AS inventory_status`)
+
+		pg := paginate.New()
+		page = pg.With(model.Scopes(sort.Scope())).Request(listingRequest(c.Request)).Response(&products)
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	if err := converter.LoadPriceLists(config.DB, ids); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, product := range products {
+		if err := localizePrices(converter, product.ID, &product.Currency, &product.Price, &product.CompareAtPrice, &product.SalePrice, &product.EffectivePrice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// productFilter validates the listing filters of the request, answering with the error when
+// they are invalid
+func productFilter(c *gin.Context, params utils.Parameters, converter *services.Converter) (services.ProductFilter, bool) {
+	filter, err := services.NewProductFilter(params, converter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return filter, false
+	}
+	return filter, true
+}
+
+// productSort validates the sort order of a listing, answering with the error when it is invalid
+func productSort(c *gin.Context, params utils.Parameters, fallback string, searching bool) (services.ProductSort, bool) {
+	sort, err := services.NewProductSort(params.Sort, params.WindowDays, fallback, searching)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return sort, false
+	}
+	return sort, true
+}
+
+// listingRequest hides the sort parameter of a listing from paginate, which would read it as
+// a column to order by
+func listingRequest(request *http.Request) *http.Request {
+	query := request.URL.Query()
+	query.Del("sort")
+	clone := request.Clone(request.Context())
+	clone.URL.RawQuery = query.Encode()
+	return clone
+}
+
+// GetProductFacets counts the products of a listing per brand, color, size, price bucket,
+// rating and availability. It takes the filters of GetProducts and the search key; every facet
+// is counted without its own filter. Price buckets are in the requested currency.
+func GetProductFacets(c *gin.Context) {
+	var params utils.Parameters
+	if c.Bind(&params) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
+		return
+	}
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
+	}
+	buckets, err := services.PriceBuckets(params.PriceBuckets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	config.DB.Model(&products).
-		Select(`products.name, products.id`).
-		Joins("LEFT JOIN categories ON products.category_id = categories.id").
-		Joins("LEFT JOIN brands ON products.brand_id = brands.id").
-		Where(searchQuery).
-		Where("products.status = ? AND products.parent_id IS NULL", "published").
-		Group("products.id").Find(&products)
+	bounds := make([]utils.Money, len(buckets))
+	for i, bucket := range buckets {
+		bounds[i] = converter.ToBase(bucket)
+	}
+	var facets services.ProductFacets
+	err = services.SearchTransaction(config.DB, func(tx *gorm.DB) error {
+		facets, err = services.LoadProductFacets(tx, filter, params.Key, bounds)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, &products)
+	// the buckets are reported as requested rather than converted back
+	facets.Currency = converter.Target
+	for i := range facets.Prices {
+		facets.Prices[i].Min = 0
+		if i > 0 {
+			facets.Prices[i].Min = buckets[i-1]
+		}
+		if i < len(buckets) {
+			facets.Prices[i].Max = &buckets[i]
+		}
+	}
+
+	c.JSON(http.StatusOK, facets)
 }
+
+// GetProducts retrieves all products with their category and reviews
 func GetProducts(c *gin.Context) {
 	var params utils.Parameters
 	if c.Bind(&params) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
 		return
 	}
-	querystring := utils.ProductQueryParameterToMap(params)
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
+	}
+	sort, ok := productSort(c, params, services.SortNewest, false)
+	if !ok {
+		return
+	}
 
+	listProducts(c, converter, sort.Scope(), filter.Scope(""))
+}
+
+// listProducts answers a page of the parent products matching the scopes, in the currency of the
+// request. It is shared by the listings filtered like GetProducts.
+func listProducts(c *gin.Context, converter *services.Converter, order func(db *gorm.DB) *gorm.DB, scopes ...func(db *gorm.DB) *gorm.DB) {
 	type Inventory struct {
 		ProductID  uint           `gorm:"not null" json:"-"`
 		Product    models.Product `gorm:"foreignKey:ProductID" json:"-"`
@@ -189,12 +413,17 @@ func GetProducts(c *gin.Context) {
 	}
 	type Product struct {
 		gorm.Model
-		Name            string  `gorm:"size:150;not null"`
-		Description     string  `gorm:"type:text"`
-		SKU             string  `gorm:"size:150;not null;unique;index"`
-		Barcode         *string `gorm:"size:150"`
-		Price           float64 `gorm:"type:decimal(10,2);not null"`
-		Currency        string  `gorm:"size:3; not null"`
+		Name            string       `gorm:"size:150;not null"`
+		Description     string       `gorm:"type:text"`
+		SKU             string       `gorm:"size:150;not null;unique;index"`
+		Barcode         *string      `gorm:"size:150"`
+		Price           utils.Money  `gorm:"type:decimal(10,2);not null"`
+		Currency        string       `gorm:"size:3; not null"`
+		CompareAtPrice  *utils.Money `gorm:"type:decimal(10,2)"`
+		SalePrice       *utils.Money `gorm:"type:decimal(10,2)"`
+		SaleStartDate   *time.Time
+		SaleEndDate     *time.Time
+		EffectivePrice  utils.Money `gorm:"column:effective_price"`
 		BrandID         *uint
 		Brand           Brand           `gorm:"foreignKey:BrandID"`
 		CategoryID      uint            `gorm:"not null"`
@@ -211,195 +440,98 @@ func GetProducts(c *gin.Context) {
 	var products []*Product
 	var model *gorm.DB
 
-	model = config.DB.Debug().Model(&products).Preload("Category").Preload("Inventory").Preload("Brand").Preload("Images").
-		Select(`products.*, 
+	model = config.DB.Debug().Model(&products).Preload("Category").Preload("Inventory", "variant_id IS NULL").Preload("Brand").Preload("Images", services.CoverImage).
+		Select(`products.*,
+				`+utils.EffectivePriceColumn+` AS effective_price,
 				count(reviews.id) as total_reviews,
 				AVG(reviews.rating)::int as rating,
 				CASE 
-					WHEN EXISTS (
-						SELECT 1 
-						FROM products AS child
-						JOIN inventories ON inventories.product_id = child.id
-						WHERE child.parent_id = products.id 
-						AND inventories.stock_level > 0
-					) THEN true
 					WHEN EXISTS (
 						SELECT 1 
 						FROM inventories 
 						WHERE inventories.product_id = products.id 
 						AND inventories.stock_level > 0
+						AND inventories.deleted_at IS NULL
 					) THEN true
 					ELSE false
 				END AS inventory_status
 
 			`).
 		Joins("LEFT JOIN reviews ON products.id = reviews.product_id").
-		Where(querystring).
+		Scopes(scopes...).
 		Where("is_child = ?", false).
 		Group("products.id")
 
 	pg := paginate.New()
-	page := pg.With(model).Request(c.Request).Response(&products)
+	page := pg.With(model.Scopes(order)).Request(listingRequest(c.Request)).Response(&products)
 
 	if page.Error {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
 		return
 	}
 
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	if err := converter.LoadPriceLists(config.DB, ids); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, product := range products {
+		if err := localizePrices(converter, product.ID, &product.Currency, &product.Price, &product.CompareAtPrice, &product.SalePrice, &product.EffectivePrice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, &page)
 }
+
+// GetNewArrivalProducts lists the newest products first, filtered like GetProducts
 func GetNewArrivalProducts(c *gin.Context) {
 	var params utils.Parameters
 	if c.Bind(&params) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
 		return
 	}
-	querstring := utils.ProductQueryParameterToMap(params)
-	type Inventory struct {
-		ProductID  uint           `gorm:"not null" json:"-"`
-		Product    models.Product `gorm:"foreignKey:ProductID" json:"-"`
-		StockLevel int            `gorm:"not null"`
-	}
-	type Brand struct {
-		ID   uint        `gorm:"primarykey"`
-		Name null.String `gorm:"size:100;not null"`
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
 	}
-	type Product struct {
-		gorm.Model
-		Name            string                `gorm:"size:150;not null"`
-		Description     string                `gorm:"type:text"`
-		SKU             string                `gorm:"size:150;not null;unique;index"`
-		Barcode         *string               `gorm:"size:150"`
-		Price           float64               `gorm:"type:decimal(10,2);not null"`
-		Currency        string                `gorm:"size:3; not null"`
-		Images          []models.ProductImage `gorm:"foreignKey:ProductID"`
-		BrandID         *uint
-		Brand           Brand           `gorm:"foreignKey:BrandID"`
-		CategoryID      uint            `gorm:"not null"`
-		Category        models.Category `gorm:"foreignKey:CategoryID"`
-		Status          *string         `gorm:"not null;check:status IN ('published', 'unpublished')"`
-		Inventory       *Inventory      `gorm:"foreignKey:ProductID"`
-		InventoryStatus bool            `gorm:"column:inventory_status"`
-		TotalReviews    int
-		Rating          int
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
 	}
-
-	var products []*Product
-	var model *gorm.DB
-
-	model = config.DB.Model(&products).Preload("Category").Preload("Inventory").Preload("Brand").Preload("Images").
-		Select(`products.*, 
-				count(reviews.id) as total_reviews,
-				AVG(reviews.rating)::int as rating,
-				CASE 
-					WHEN EXISTS (
-						SELECT 1 
-						FROM products AS child
-						JOIN inventories ON inventories.product_id = child.id
-						WHERE child.parent_id = products.id 
-						AND inventories.stock_level > 0
-					) THEN true
-					WHEN EXISTS (
-						SELECT 1 
-						FROM inventories 
-						WHERE inventories.product_id = products.id 
-						AND inventories.stock_level > 0
-					) THEN true
-					ELSE false
-				END AS inventory_status
-			`).
-		Joins("LEFT JOIN reviews ON products.id = reviews.product_id").
-		Where(querstring).
-		Where("is_child = false").
-		Group("products.id").
-		Order("products.created_at DESC")
-
-	pg := paginate.New()
-	page := pg.With(model).Request(c.Request).Response(&products)
-
-	if page.Error {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+	sort, ok := productSort(c, params, services.SortNewest, false)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, &page)
+	listProducts(c, converter, sort.Scope(), filter.Scope(""))
 }
+
+// GetTrendingProducts lists products by their recent sales, older sales counting less
 func GetTrendingProducts(c *gin.Context) {
 	var params utils.Parameters
 	if c.Bind(&params) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
 		return
 	}
-	querstring := utils.ProductQueryParameterToMap(params)
-	type Inventory struct {
-		ProductID  uint           `gorm:"not null" json:"-"`
-		Product    models.Product `gorm:"foreignKey:ProductID" json:"-"`
-		StockLevel int            `gorm:"not null"`
-	}
-	type Brand struct {
-		ID   uint        `gorm:"primarykey"`
-		Name null.String `gorm:"size:100;not null"`
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
 	}
-	type Product struct {
-		gorm.Model
-		Name            string                `gorm:"size:150;not null"`
-		Description     string                `gorm:"type:text"`
-		SKU             string                `gorm:"size:150;not null;unique;index"`
-		Barcode         *string               `gorm:"size:150"`
-		Price           float64               `gorm:"type:decimal(10,2);not null"`
-		Currency        string                `gorm:"size:3; not null"`
-		Images          []models.ProductImage `gorm:"foreignKey:ProductID"`
-		BrandID         *uint
-		Brand           Brand           `gorm:"foreignKey:BrandID"`
-		CategoryID      uint            `gorm:"not null"`
-		Category        models.Category `gorm:"foreignKey:CategoryID"`
-		Status          *string         `gorm:"not null;check:status IN ('published', 'unpublished')"`
-		Inventory       *Inventory      `gorm:"foreignKey:ProductID"`
-		InventoryStatus bool            `gorm:"column:inventory_status"`
-		TotalReviews    int
-		Rating          int
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
 	}
-
-	var products []*Product
-	var model *gorm.DB
-
-	model = config.DB.Model(&products).Preload("Category").Preload("Inventory").Preload("Brand").Preload("Images").
-		Select(`products.*, 
-				count(reviews.id) as total_reviews,
-				AVG(reviews.rating)::int as rating,
-				CASE 
-					WHEN EXISTS (
-						SELECT 1 
-						FROM products AS child
-						JOIN inventories ON inventories.product_id = child.id
-						WHERE child.parent_id = products.id 
-						AND inventories.stock_level > 0
-					) THEN true
-					WHEN EXISTS (
-						SELECT 1 
-						FROM inventories 
-						WHERE inventories.product_id = products.id 
-						AND invenstock_level > 0
-					) THEN true
-					ELSE false
-				END AS inventory_status
-			`).
-		Joins("LEFT JOIN reviews ON products.id = reviews.product_id").
-		Joins("LEFT JOIN order_items on products.id = order_items.product_id").
-		Where(querstring).
-		Where("is_child = ?", false).
-		Group("products.id").
-		Order("COUNT(distinct order_items.order_id) DESC")
-
-	pg := paginate.New()
-	page := pg.With(model).Request(c.Request).Response(&products)
-
-	if page.Error {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+	sort, ok := productSort(c, params, services.SortTrending, false)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, &page)
+	listProducts(c, converter, sort.Scope(), filter.Scope(""))
 }
 
 // GetProduct retrieves a single product by its ID
@@ -407,9 +539,10 @@ func GetSingleProduct(c *gin.Context) {
 	productID := c.Param("id")
 
 	type Category struct {
-		CategoryID       *uint `gorm:"-"`
-		SubCategoryID    *uint `gorm:"-"`
-		SubSubCategoryID *uint `gorm:"-"`
+		CategoryID       *uint  `gorm:"-"`
+		SubCategoryID    *uint  `gorm:"-"`
+		SubSubCategoryID *uint  `gorm:"-"`
+		Path             []uint `gorm:"-"` // Every category from the top down to the one of the product
 	}
 
 	type Brand struct {
@@ -418,14 +551,14 @@ func GetSingleProduct(c *gin.Context) {
 	}
 	type Product struct {
 		gorm.Model
-		Name         string   `gorm:"size:150;not null"`
-		Description  string   `gorm:"type:text"`
-		SKU          string   `gorm:"size:150;not null;unique;index"`
-		Barcode      *string  `gorm:"size:150"`
-		Price        float64  `gorm:"type:decimal(10,2);not null"`
-		Currency     string   `gorm:"size:3; not null"`
-		CategoryID   uint     `gorm:"not null"`
-		Category     Category `gorm:"foreignKey:CategoryID"`
+		Name         string      `gorm:"size:150;not null"`
+		Description  string      `gorm:"type:text"`
+		SKU          string      `gorm:"size:150;not null;unique;index"`
+		Barcode      *string     `gorm:"size:150"`
+		Price        utils.Money `gorm:"type:decimal(10,2);not null"`
+		Currency     string      `gorm:"size:3; not null"`
+		CategoryID   uint        `gorm:"not null"`
+		Category     Category    `gorm:"foreignKey:CategoryID"`
 		BrandID      *uint
 		Brand        Brand   `gorm:"foreignKey:BrandID"`
 		Status       *string `gorm:"not null;check:status IN ('published', 'unpublished')"`
@@ -433,7 +566,7 @@ func GetSingleProduct(c *gin.Context) {
 		TotalReviews int
 		Rating       int
 		Variation    json.RawMessage
-		Path         pq.Int64Array `gorm:"column:path" json:"-"`
+		Path         string `gorm:"-" json:"-"`
 		Images       []models.ProductImage
 	}
 
@@ -442,14 +575,13 @@ func GetSingleProduct(c *gin.Context) {
 	model := config.DB.Model(&models.Product{}).Preload("Category").Preload("Brand").
 		Select(`products.*, 
 				count(reviews.id) as total_reviews,
-				cat_path.path,
 				AVG(reviews.rating)::int as rating,
 				COALESCE(
 					json_agg(
 						json_build_object(
 						'id', variations.id,
-						'size', variations.size,
-						'color', variations.color
+						'sku', variations.sku,
+						'price', variations.price
 
 						)
 					)FILTER (WHERE variations.id IS NOT NULL),
@@ -458,24 +590,10 @@ func GetSingleProduct(c *gin.Context) {
 				inventories.stock_level as stock_level
 			`).
 		Joins("LEFT JOIN reviews ON products.id = reviews.product_id").
-		Joins("LEFT JOIN inventories ON products.id = inventories.product_id").
-		Joins("LEFT JOIN products AS variations ON variations.parent_id = products.id AND variations.is_child = true").
-		Joins(`
-			LEFT JOIN (WITH RECURSIVE category_hierarchy AS (
-				SELECT id, name, parent_id, 1 AS level, ARRAY[id] AS path
-				FROM categories
-				WHERE parent_id IS NULL
-				UNION ALL
-				SELECT c.id, c.name, c.parent_id, ch.level + 1, ch.path || c.id
-				FROM categories c
-				JOIN category_hierarchy ch ON c.parent_id = ch.id
-			)
-			SELECT id, name, parent_id, level, path
-			FROM category_hierarchy
-			ORDER BY path) as cat_path on cat_path.id = products.category_id
-		`).
+		Joins("LEFT JOIN inventories ON products.id = inventories.product_id AND inventories.variant_id IS NULL").
+		Joins("LEFT JOIN product_variants AS variations ON variations.product_id = products.id AND variations.deleted_at IS NULL").
 		Where("products.id = ?", productID).
-		Group("products.id, cat_path.path, inventories.stock_level").
+		Group("products.id, inventories.stock_level").
 		First(&product)
 
 	if model.Error != nil {
@@ -489,18 +607,19 @@ func GetSingleProduct(c *gin.Context) {
 		return
 	}
 
-	config.DB.Model([]models.ProductImage{}).Where("product_id = ?", productID).Find(&product.Images)
-	for i, v := range product.Path {
+	config.DB.Model([]models.ProductImage{}).Where("product_id = ?", productID).Scopes(services.GalleryOrder).Find(&product.Images)
+	config.DB.Model(&models.Category{}).Where("id = ?", product.CategoryID).Pluck("path", &product.Path)
+	// the first three levels are kept for older clients, Path holds them all
+	product.Category.Path = models.PathIDs(product.Path)
+	for i := range product.Category.Path {
+		categoryID := product.Category.Path[i]
 		if i == 0 {
-			categoryID := uint(v)
 			product.Category.CategoryID = &categoryID
 		}
 		if i == 1 {
-			categoryID := uint(v)
 			product.Category.SubCategoryID = &categoryID
 		}
 		if i == 2 {
-			categoryID := uint(v)
 			product.Category.SubSubCategoryID = &categoryID
 		}
 	}
@@ -510,61 +629,85 @@ func GetSingleProduct(c *gin.Context) {
 
 // GetProduct retrieves a single product by its ID
 func GetSingleProductV2(c *gin.Context) {
-	productID := c.Param("id")
+	writeProductDetail(c, c.Param("id"))
+}
 
-	type AttributeVariation struct {
-		ID       uint   `gorm:"primarykey"`
-		Size     string `json:"Size"`
-		Quantity int    `json:"Quantity"`
+// writeProductDetail responds with a product, its options and variants in the currency of the request
+func writeProductDetail(c *gin.Context, productID string) {
+
+	type OptionValue struct {
+		ID    uint
+		Value string
+		Image string
 	}
-	type ColorMap struct {
-		Image     string               `json:"Image"`
-		Variation []AttributeVariation `json:"variation"`
+	type Option struct {
+		ID     uint
+		Name   string
+		Values []OptionValue
 	}
 
-	type ColorGroup struct {
-		Color     string               `json:"Color"`
-		Image     string               `json:"Image"`
-		Variation []AttributeVariation `json:"variation"`
+	type VariantValue struct {
+		Option string
+		Value  string
 	}
-
-	type Variation struct {
-		ID        uint              `gorm:"primarykey"`
-		SKU       string            `gorm:"size:150;not null;unique;index"`
-		Inventory *models.Inventory `gorm:"foreignKey:ProductID;references:ID"`
-		Color     string
-		Size      string
-		Images    []models.ProductImage `gorm:"foreignKey:ProductID;references:ID"`
+	type Variant struct {
+		ID             uint
+		SKU            string
+		Barcode        *string
+		Price          *utils.Money // Price override of the variant
+		SalePrice      *utils.Money // Sale price of the variant, while its sale runs
+		EffectivePrice utils.Money
+		Weight         *float64
+		Quantity       int
+		Options        []VariantValue
+		Images         []models.ProductImage
 	}
 
 	type Product struct {
 		gorm.Model
-		Name        string          `gorm:"size:150;not null"`
-		Description string          `gorm:"type:text"`
-		SKU         string          `gorm:"size:150;not null;unique;index"`
-		Barcode     *string         `gorm:"size:150"`
-		Price       float64         `gorm:"type:decimal(10,2);not null"`
-		Currency    string          `gorm:"size:3; not null"`
-		CategoryID  uint            `gorm:"not null"`
-		Category    models.Category `gorm:"foreignKey:CategoryID"`
-		Status      *string         `gorm:"not null;check:status IN ('published', 'unpublished')"`
-		Featured    bool            `gorm:"default:false"`
-		Stock       uint            `gorm:"-"`
-		IsChild     bool            `gorm:"default:false"`
-		ParentID    *uint
-		Color       string
-		Size        string
-		BrandID     *uint
-		Brand       models.Brand          `gorm:"foreignKey:BrandID;refrences:BrandID"`
-		Images      []models.ProductImage `gorm:"foreignKey:ProductID"`
-		Variations  []Variation           `gorm:"-" json:"-"`
-		Attributes  []ColorGroup          `gorm:"-"`
+		Name            string `gorm:"size:150;not null"`
+		Slug            string
+		MetaTitle       string
+		MetaDescription string
+		Description     string       `gorm:"type:text"`
+		SKU             string       `gorm:"size:150;not null;unique;index"`
+		Barcode         *string      `gorm:"size:150"`
+		Price           utils.Money  `gorm:"type:decimal(10,2);not null"`
+		Currency        string       `gorm:"size:3; not null"`
+		CompareAtPrice  *utils.Money `gorm:"type:decimal(10,2)"`
+		SalePrice       *utils.Money `gorm:"type:decimal(10,2)"`
+		SaleStartDate   *time.Time
+		SaleEndDate     *time.Time
+		EffectivePrice  utils.Money     `gorm:"column:effective_price"`
+		CategoryID      uint            `gorm:"not null"`
+		Category        models.Category `gorm:"foreignKey:CategoryID"`
+		Status          *string         `gorm:"not null;check:status IN ('published', 'unpublished')"`
+		Featured        bool            `gorm:"default:false"`
+		Stock           uint            `gorm:"-"`
+		IsChild         bool            `gorm:"default:false"`
+		ParentID        *uint
+		Color           string
+		Size            string
+		BrandID         *uint
+		Brand           models.Brand           `gorm:"foreignKey:BrandID;refrences:BrandID"`
+		Images          []models.ProductImage  `gorm:"foreignKey:ProductID"`
+		Tags            []models.Tag           `gorm:"many2many:product_tags;joinForeignKey:ProductID;joinReferences:TagID"`
+		Options         []Option               `gorm:"-"`
+		Variants        []Variant              `gorm:"-"`
+		Recommendations productRecommendations `gorm:"-"`
+	}
+
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
 	}
 
 	var product *Product
 	// var variations []Variation
 
-	model := config.DB.Model(&models.Product{}).Preload("Category").Preload("Brand").Preload("Images").First(&product, productID)
+	model := config.DB.Model(&models.Product{}).Preload("Category").Preload("Brand").Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name ASC") }).
+		Select("products.*, "+utils.EffectivePriceColumn+" AS effective_price").
+		Where("products.id = ?", productID).First(&product)
 
 	if model.Error != nil {
 		if errors.Is(model.Error, gorm.ErrRecordNotFound) {
@@ -576,49 +719,97 @@ func GetSingleProductV2(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": model.Error.Error()})
 		return
 	}
-	config.DB.Model([]models.Product{}).Preload("Images").Preload("Inventory").Where("parent_id = ? AND is_child = true", productID).Find(&product.Variations)
+	config.DB.Model([]models.ProductImage{}).Where("product_id = ? AND variant_id IS NULL", productID).Scopes(services.GalleryOrder).Find(&product.Images)
 
-	config.DB.Model([]models.ProductImage{}).Where("product_id = ?", productID).Find(&product.Images)
-
-	colorMap := make(map[string]ColorMap)
+	variantOptions, err := services.LoadVariantOptions(config.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	for _, product := range product.Variations {
-		variation := AttributeVariation{
-			ID:       product.ID,
-			Size:     product.Size,
-			Quantity: product.Inventory.StockLevel,
+	for _, option := range variantOptions.Options {
+		output := Option{ID: option.ID, Name: option.Name}
+		for _, value := range option.Values {
+			optionValue := OptionValue{ID: value.ID, Value: value.Value}
+			// the primary image of the color shows the value, else its first image in the gallery
+			for _, img := range product.Images {
+				// images of products created before options are only tied to a color
+				if (value.ID != 0 && img.OptionValueID != nil && *img.OptionValueID == value.ID) ||
+					(img.OptionValueID == nil && img.Color != nil && *img.Color == value.Value && strings.EqualFold(option.Name, "color")) {
+					if optionValue.Image == "" || img.IsColorPrimary {
+						optionValue.Image = img.Image
+					}
+					if img.IsColorPrimary {
+						break
+					}
+				}
+			}
+			output.Values = append(output.Values, optionValue)
 		}
-		// Get the current value (or zero value if not present)
-		colorGroup := colorMap[product.Color]
-
-		// Append the variation
-		colorGroup.Variation = append(colorGroup.Variation, variation)
-
-		// Put it back into the map
-		colorMap[product.Color] = colorGroup
+		product.Options = append(product.Options, output)
 	}
 
-	for _, img := range product.Images {
-		// Get the current value (or zero value if not present)
-		colorGroup := colorMap[*img.Color]
-
-		// Append the variation
-		colorGroup.Image = img.Image
+	for _, variation := range variantOptions.Variants {
+		variant := Variant{ID: variation.ID, SKU: variation.SKU, Barcode: variation.Barcode, Weight: variation.Weight, Images: variation.Images}
+		if variation.Price != nil {
+			price, err := converter.Convert(*variation.Price, product.Currency)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			variant.Price = &price
+		}
+		if variation.OnSale(time.Now()) {
+			price, err := converter.Convert(*variation.SalePrice, product.Currency)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			variant.SalePrice = &price
+		}
+		if variation.Inventory != nil {
+			variant.Quantity = variation.Inventory.StockLevel
+		}
+		for _, value := range variation.Values {
+			variantValue := VariantValue{Value: value.Value}
+			if value.Option != nil {
+				variantValue.Option = value.Option.Name
+			}
+			variant.Options = append(variant.Options, variantValue)
+		}
+		product.Variants = append(product.Variants, variant)
+	}
 
-		// Put it back into the map
-		colorMap[*img.Color] = colorGroup
+	if err := converter.LoadPriceLists(config.DB, []uint{product.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	onSale := (&models.Product{SalePrice: product.SalePrice, SaleStartDate: product.SaleStartDate, SaleEndDate: product.SaleEndDate}).OnSale(time.Now())
+	if err := localizePrices(converter, product.ID, &product.Currency, &product.Price, &product.CompareAtPrice, &product.SalePrice, &product.EffectivePrice); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	var output []ColorGroup
+	// a running sale of the product wins over the sale and the price of a variant
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		variant.EffectivePrice = product.EffectivePrice
+		if onSale {
+			continue
+		}
+		if variant.SalePrice != nil {
+			variant.EffectivePrice = *variant.SalePrice
+		} else if variant.Price != nil {
+			variant.EffectivePrice = *variant.Price
+		}
+	}
 
-	for color, obj := range colorMap {
-		output = append(output, ColorGroup{
-			Color:     color,
-			Image:     obj.Image,
-			Variation: obj.Variation,
-		})
+	recommendations, err := loadRecommendations(converter, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	product.Attributes = output
+	product.Recommendations = recommendations
 
 	c.JSON(http.StatusOK, &product)
 }
@@ -637,13 +828,41 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	before := *product
+
 	if err := c.ShouldBindJSON(&product); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// publishing is scheduled with ScheduleProduct
+	product.PublishAt, product.UnpublishAt = before.PublishAt, before.UnpublishAt
+
+	userID := c.GetUint("user_id")
+	requested := product.Slug
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// the slug is only changed along with a redirect from the old one
+		product.Slug = before.Slug
+		if requested != before.Slug {
+			slug, err := services.ChangeSlug(tx, services.SlugProduct, product.ID, before.Slug, requested)
+			if err != nil {
+				return err
+			}
+			product.Slug = slug
+		}
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RefreshSearchIndex(tx, product.ID); err != nil {
+			return err
+		}
+		if err := services.RecordPriceChanges(tx, before, *product, "manual", &userID); err != nil {
+			return err
+		}
+		return services.RecordRevision(tx, &before, *product, "update", &userID)
+	})
+	if err != nil {
+		writeSlugError(c, err)
 		return
 	}
 
@@ -654,8 +873,14 @@ func CreateVariation(c *gin.Context) {
 	var payload struct {
 		Color    string
 		Size     string
-		Image    string
+		Options  map[string]string // Option name to value, such as {"Fabric": "Linen", "Fit": "Slim"}
+		Image    string            // Base64 image of the variation
+		ImageID  *uint             // Uploaded image of the variation, instead of Image
 		ParentID *uint
+		SKU      string
+		Barcode  *string
+		Price    *utils.Money
+		Weight   *float64
 		Stock    int
 	}
 
@@ -670,63 +895,91 @@ func CreateVariation(c *gin.Context) {
 		return
 	}
 
-	tx := config.DB.Begin()
-	variation := models.Product{
-		Name:        parent.Name,
-		Description: parent.Description,
-		SKU:         parent.SKU + "-" + payload.Size + "-" + payload.Color,
-		Barcode:     parent.Barcode,
-		Price:       parent.Price,
-		Currency:    parent.Currency,
-		CategoryID:  parent.CategoryID,
-		BrandID:     parent.BrandID,
-		IsChild:     true,
-		ParentID:    payload.ParentID,
-		Status:      parent.Status,
-		Featured:    parent.Featured,
-		Color:       payload.Color,
-		Size:        payload.Size,
-		Inventory: &models.Inventory{
-			StockLevel: int(payload.Stock),
-			InOpen:     0,
-			ChangeType: "restock",
-			ChangeDate: time.Now(),
-		},
+	if len(payload.Options) == 0 {
+		payload.Options = map[string]string{"Color": payload.Color, "Size": payload.Size}
 	}
 
-	if err := tx.Create(&variation).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variation"})
+	var variant *models.ProductVariant
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		variant, err = services.AddVariant(tx, parent, payload.Options, services.VariantInput{
+			SKU:      payload.SKU,
+			Barcode:  payload.Barcode,
+			Price:    payload.Price,
+			Weight:   payload.Weight,
+			Quantity: payload.Stock,
+		})
+		if err != nil {
+			return err
+		}
+		if payload.Image != "" || payload.ImageID != nil {
+			image := models.ProductImage{ProductID: parent.ID, VariantID: &variant.ID, StoredImage: models.StoredImage{Image: payload.Image, ImageID: payload.ImageID}}
+			if err := tx.Create(&image).Error; err != nil {
+				return err
+			}
+		}
+		return services.RefreshSearchIndex(tx, parent.ID)
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrVariantExists) || errors.Is(err, services.ErrIncompleteOption) || errors.Is(err, services.ErrTooManyVariants) || models.IsImageError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variation"})
+		}
 		return
 	}
 
-	tx.Commit()
-	c.JSON(http.StatusCreated, gin.H{"message": "Variation added successfully"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Variation added successfully", "VariantID": variant.ID})
 }
+
+// UpdateVariation changes what a variant overrides of its product. Barcode, Price, the sale and
+// Weight are replaced, leaving them out clears the override. Shared fields are edited on the product.
 func UpdateVariation(c *gin.Context) {
-	productID := c.Param("id")
-	var product *models.Product
+	var variant models.ProductVariant
 
-	if err := config.DB.First(&product, productID).Error; err != nil {
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&variant).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variation not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
 
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var payload struct {
+		SKU           *string
+		Barcode       *string
+		Price         *utils.Money
+		SalePrice     *utils.Money
+		SaleStartDate *time.Time
+		SaleEndDate   *time.Time
+		Weight        *float64
+		Position      *int
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	if payload.SKU != nil && *payload.SKU != "" {
+		variant.SKU = *payload.SKU
+	}
+	if payload.Position != nil {
+		variant.Position = *payload.Position
+	}
+	variant.Barcode = payload.Barcode
+	variant.Price = payload.Price
+	variant.SalePrice = payload.SalePrice
+	variant.SaleStartDate = payload.SaleStartDate
+	variant.SaleEndDate = payload.SaleEndDate
+	variant.Weight = payload.Weight
+
+	if err := config.DB.Save(&variant).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Variation added successfully"})
+	c.JSON(http.StatusOK, variant)
 }
 
 // DeleteProduct deletes a product by its ID
@@ -743,7 +996,8 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&product).Error; err != nil {
+	// the product goes to the trash with its variations, see RestoreProduct
+	if err := config.DB.Transaction(func(tx *gorm.DB) error { return services.TrashProduct(tx, *product) }); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -751,18 +1005,23 @@ func DeleteProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 func DeleteVariation(c *gin.Context) {
-	productID := c.Param("id")
-	var product *models.Product
+	var variant models.ProductVariant
 
-	if err := config.DB.First(&product, productID).Error; err != nil {
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&variant).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variation not found"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
-	if err := config.DB.Delete(&product).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.Inventory{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&variant).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -780,6 +1039,10 @@ func CreateProductAttribute(c *gin.Context) {
 	}
 
 	if err := config.DB.Create(&productAttribute).Error; err != nil {
+		if models.IsImageError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -826,12 +1089,21 @@ func UpdateProductAttribute(c *gin.Context) {
 	c.JSON(http.StatusOK, productAttribute)
 }
 
-// DeleteProductAttribute deletes a product attribute by its ID
+// DeleteProductAttribute deletes the variants of a product with the given color and its images
 func DeleteProductAttribute(c *gin.Context) {
 	productId := c.Param("id")
 	color := c.Query("color")
 
-	if err := config.DB.Where("parent_id = ? AND is_child = true AND color = ?", productId, color).Delete(&models.Product{}).Error; err != nil {
+	variants := config.DB.Model(&models.VariantOptionValue{}).Select("variant_option_values.variant_id").
+		Joins("JOIN product_option_values ON product_option_values.id = variant_option_values.option_value_id").
+		Joins("JOIN product_options ON product_options.id = product_option_values.option_id").
+		Where("product_options.product_id = ? AND LOWER(product_options.name) = 'color' AND product_option_values.value = ?", productId, color)
+
+	if err := config.DB.Where("product_id = ? AND variant_id IN (?)", productId, variants).Delete(&models.Inventory{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Where("product_id = ? AND id IN (?)", productId, variants).Delete(&models.ProductVariant{}).Error; err != nil {
 
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 
@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+type productDraft struct {
+	models.ProductDraft
+	Outdated bool                     // The live product changed since the draft was started
+	Changes  []services.ContentChange // From the live product to the draft
+}
+
+// GetProductDraft returns the draft of a product and how it differs from the live product
+func GetProductDraft(c *gin.Context) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var draft models.ProductDraft
+	if err := config.DB.Where("product_id = ?", product.ID).First(&draft).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The product has no draft"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	latest, err := services.LatestRevision(config.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, productDraft{
+		ProductDraft: draft,
+		Outdated:     latest > draft.BaseRevision,
+		Changes:      services.DiffContent(models.ContentOf(*product), draft.Content),
+	})
+}
+
+// SaveProductDraft creates or replaces the draft of a product. The live product does not change
+// until the draft is published, right away or at PublishAt.
+func SaveProductDraft(c *gin.Context) {
+	var payload struct {
+		models.ProductContent
+		PublishAt *time.Time
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if utils.Slugify(payload.Slug) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidSlug.Error()})
+		return
+	}
+	if err := services.CheckPublishSchedule(payload.PublishAt, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var draft models.ProductDraft
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("product_id = ?", product.ID).First(&draft).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the draft starts from the live product as it is now
+			draft.ProductID = product.ID
+			draft.BaseRevision, err = services.LatestRevision(tx, product.ID)
+		}
+		if err != nil {
+			return err
+		}
+		draft.Content = payload.ProductContent
+		draft.PublishAt = payload.PublishAt
+		draft.UpdatedBy = c.GetUint("user_id")
+		return tx.Save(&draft).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// DeleteProductDraft discards the draft of a product
+func DeleteProductDraft(c *gin.Context) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	result := config.DB.Where("product_id = ?", product.ID).Delete(&models.ProductDraft{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The product has no draft"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft discarded"})
+}
+
+// PublishProductDraft makes the draft of a product its live content now
+func PublishProductDraft(c *gin.Context) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var draft models.ProductDraft
+		if err := tx.Where("product_id = ?", product.ID).First(&draft).Error; err != nil {
+			return err
+		}
+		var err error
+		product, err = services.PublishDraft(tx, draft, "draft", &userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The product has no draft"})
+			return
+		}
+		writeSlugError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// ScheduleProduct sets when the product is published and unpublished. Leaving a time out cancels
+// what was scheduled.
+func ScheduleProduct(c *gin.Context) {
+	var payload struct {
+		PublishAt   *time.Time
+		UnpublishAt *time.Time
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.CheckPublishSchedule(payload.PublishAt, payload.UnpublishAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	product.PublishAt, product.UnpublishAt = payload.PublishAt, payload.UnpublishAt
+	if err := config.DB.Model(product).Select("publish_at", "unpublish_at").Updates(product).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// GetProductRevisions lists the revisions of a product, the latest first
+func GetProductRevisions(c *gin.Context) {
+	productID := c.Param("id")
+
+	type User struct {
+		ID   uint   `gorm:"primarykey"`
+		Name string `gorm:"size:100;not null"`
+	}
+	var revisions []*struct {
+		ID        uint `gorm:"primaryKey"`
+		ProductID uint
+		Number    int
+		Content   models.ProductContent
+		Source    string
+		CreatedBy *uint
+		User      *User `gorm:"foreignKey:CreatedBy"`
+		CreatedAt time.Time
+	}
+
+	model := config.DB.Model(&models.ProductRevision{}).Preload("User").Where("product_id = ?", productID).Order("number DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&revisions)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// GetProductRevision returns a revision of a product with the changes leading to it from the
+// previous revision. compare picks another revision to start from, or "live" for the changes a
+// restore would make to the live product.
+func GetProductRevision(c *gin.Context) {
+	productID := c.Param("id")
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision number"})
+		return
+	}
+
+	var revision models.ProductRevision
+	if err := config.DB.Where("product_id = ? AND number = ?", productID, number).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var changes []services.ContentChange
+	switch compare := c.Query("compare"); compare {
+	case "live":
+		var product models.Product
+		if err := config.DB.Where("id = ?", productID).First(&product).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		changes = services.DiffContent(models.ContentOf(product), revision.Content)
+	default:
+		other := number - 1
+		if compare != "" {
+			if other, err = strconv.Atoi(compare); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "compare must be a revision number or live"})
+				return
+			}
+		}
+		// the first revision is compared to an empty product
+		var previous models.ProductRevision
+		err := config.DB.Where("product_id = ? AND number = ?", productID, other).First(&previous).Error
+		if err != nil && !(errors.Is(err, gorm.ErrRecordNotFound) && compare == "") {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Revision to compare to not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		changes = services.DiffContent(previous.Content, revision.Content)
+	}
+
+	c.JSON(http.StatusOK, struct {
+		models.ProductRevision
+		Changes []services.ContentChange
+	}{revision, changes})
+}
+
+// RestoreProductRevision brings back the content of a revision to the live product, recorded as
+// a new revision
+func RestoreProductRevision(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision number"})
+		return
+	}
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = services.RestoreRevision(tx, product.ID, number, &userID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		case errors.Is(err, services.ErrSameAsRevision):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			writeSlugError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
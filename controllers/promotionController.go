@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// Get all promotions
+func GetPromotions(c *gin.Context) {
+	var promotions []models.Promotion
+	model := config.DB.Model(&models.Promotion{}).Preload("Tiers").Preload("BundleItems").Order("priority DESC, id ASC")
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(&promotions)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// Get a promotion by ID
+func GetPromotion(c *gin.Context) {
+	id := c.Param("id")
+	var promotion models.Promotion
+	if err := config.DB.Preload("Tiers").Preload("BundleItems").Where("id = ?", id).First(&promotion).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+	c.JSON(http.StatusOK, promotion)
+}
+
+// Create a new promotion
+func CreatePromotion(c *gin.Context) {
+	var promotion models.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Create(&promotion).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, promotion)
+}
+
+// Update a promotion, replacing its tiers and bundle items
+func UpdatePromotion(c *gin.Context) {
+	id := c.Param("id")
+	var promotion models.Promotion
+	if err := config.DB.Where("id = ?", id).First(&promotion).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("promotion_id = ?", promotion.ID).Delete(&models.PromotionTier{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("promotion_id = ?", promotion.ID).Delete(&models.PromotionBundleItem{}).Error; err != nil {
+			return err
+		}
+		for i := range promotion.Tiers {
+			promotion.Tiers[i].ID = 0
+		}
+		for i := range promotion.BundleItems {
+			promotion.BundleItems[i].ID = 0
+		}
+		return tx.Save(&promotion).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion updated"})
+}
+
+// Delete a promotion
+func DeletePromotion(c *gin.Context) {
+	id := c.Param("id")
+	result := config.DB.Where("id = ?", id).Delete(&models.Promotion{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promotion"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+	c.JSON(http.StatusNoContent, gin.H{"message": "Promotion deleted"})
+}
+
+// GetCartPromotions evaluates the active promotions against the user's shopping cart
+func GetCartPromotions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var shoppingCart *models.ShoppingCart
+
+	if err := config.DB.Where("user_id = ?", userID).Preload("CartItems").First(&shoppingCart).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shopping cart not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var lines []services.CartLine
+	for _, item := range shoppingCart.CartItems {
+		lines = append(lines, services.CartLine{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	lines, err := services.LoadCartLines(config.DB, lines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	applied, discount, err := services.EvaluatePromotions(config.DB, lines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	for i := range applied {
+		applied[i].DiscountAmount = converter.FromBase(applied[i].DiscountAmount)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Promotions": applied, "DiscountAmount": converter.FromBase(discount), "Currency": converter.Target})
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productCard is the short form of a product shown in recommendations
+type productCard struct {
+	ID             uint
+	Name           string
+	Slug           string
+	Price          utils.Money
+	Currency       string
+	CompareAtPrice *utils.Money
+	SalePrice      *utils.Money
+	EffectivePrice utils.Money
+	Rating         int
+	Images         []models.ProductImage `gorm:"foreignKey:ProductID"`
+}
+
+type productRecommendations struct {
+	Related        []*productCard
+	BoughtTogether []*productCard
+	Similar        []*productCard
+}
+
+// loadProductCards loads the cards of the products in the order of ids, priced in the currency of
+// the converter
+func loadProductCards(converter *services.Converter, ids []uint) ([]*productCard, error) {
+	cards := []*productCard{}
+	if len(ids) == 0 {
+		return cards, nil
+	}
+
+	var products []*productCard
+	if err := config.DB.Model(&models.Product{}).Preload("Images", services.CoverImage).
+		Select(`products.id, products.name, products.slug, products.price, products.currency,
+			products.compare_at_price, products.sale_price,
+			`+utils.EffectivePriceColumn+` AS effective_price,
+			COALESCE((SELECT AVG(reviews.rating)::int FROM reviews
+				WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL), 0) AS rating`).
+		Where("products.id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	if err := converter.LoadPriceLists(config.DB, ids); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*productCard, len(products))
+	for _, product := range products {
+		if err := localizePrices(converter, product.ID, &product.Currency, &product.Price, &product.CompareAtPrice, &product.SalePrice, &product.EffectivePrice); err != nil {
+			return nil, err
+		}
+		byID[product.ID] = product
+	}
+	for _, id := range ids {
+		if card, ok := byID[id]; ok {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+// loadRecommendations loads the cards of the products recommended next to a product
+func loadRecommendations(converter *services.Converter, productID uint) (productRecommendations, error) {
+	var output productRecommendations
+	recommendations, err := services.Recommend(config.DB, productID, services.DefaultRecommendations)
+	if err != nil {
+		return output, err
+	}
+	if output.Related, err = loadProductCards(converter, recommendations.Related); err != nil {
+		return output, err
+	}
+	if output.BoughtTogether, err = loadProductCards(converter, recommendations.BoughtTogether); err != nil {
+		return output, err
+	}
+	output.Similar, err = loadProductCards(converter, recommendations.Similar)
+	return output, err
+}
+
+// GetRelatedProducts lists the products linked to a product by hand, in their order, including
+// those not published
+func GetRelatedProducts(c *gin.Context) {
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var related []struct {
+		ID       uint
+		Name     string
+		SKU      string
+		Status   string
+		Position int
+	}
+	if err := config.DB.Model(&models.ProductRelation{}).
+		Select("products.id, products.name, products.sku, products.status, product_relations.position").
+		Joins("INNER JOIN products ON products.id = product_relations.related_product_id AND products.deleted_at IS NULL").
+		Where("product_relations.product_id = ?", product.ID).
+		Order("product_relations.position ASC, product_relations.id ASC").Scan(&related).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, related)
+}
+
+// SetRelatedProducts replaces the products linked to a product by hand, listed in the order they
+// are shown in
+func SetRelatedProducts(c *gin.Context) {
+	var payload struct {
+		ProductIDs []uint
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SetRelatedProducts(tx, product.ID, payload.ProductIDs)
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownRelated) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Related products updated"})
+}
+
+// GetCartRecommendations suggests products often bought with what is in the user's shopping cart
+func GetCartRecommendations(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	var shoppingCart *models.ShoppingCart
+
+	if err := config.DB.Where("user_id = ?", userID).Preload("CartItems").First(&shoppingCart).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shopping cart not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+
+	var productIDs []uint
+	for _, item := range shoppingCart.CartItems {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	ids, err := services.RecommendForCart(config.DB, productIDs, services.DefaultRecommendations)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cards, err := loadProductCards(converter, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cards)
+}
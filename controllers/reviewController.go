@@ -4,6 +4,7 @@ import (
 	"backend/config"
 	"backend/models"
 	"backend/serializers"
+	"backend/utils"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -67,7 +68,7 @@ func GetCustomerReview(c *gin.Context) {
 		Description string          `gorm:"type:text"`
 		SKU         string          `gorm:"size:150;not null;unique;index"`
 		Barcode     *string         `gorm:"size:150"`
-		Price       float64         `gorm:"type:decimal(10,2);not null"`
+		Price       utils.Money     `gorm:"type:decimal(10,2);not null"`
 		Currency    string          `gorm:"size:3; not null"`
 		Images      pq.StringArray  `gorm:"type:varchar[]"`
 		CategoryID  uint            `gorm:"not null"`
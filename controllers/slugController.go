@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// writeSlugError responds to a failed update, a bad or taken slug being the client's fault
+func writeSlugError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// resolveSlug finds the record of the slug in the path. An old slug is answered with a permanent
+// redirect to the URL of the current one, and false is returned.
+func resolveSlug(c *gin.Context, entityType string, prefix string) (uint, bool) {
+	slug := c.Param("slug")
+	id, current, err := services.ResolveSlug(config.DB, entityType, slug)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No " + entityType + " found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return 0, false
+	}
+
+	if current != slug {
+		location := prefix + url.PathEscape(current)
+		if c.Request.URL.RawQuery != "" {
+			location += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, location)
+		return 0, false
+	}
+	return id, true
+}
+
+// GetProductBySlug retrieves a single product by its slug
+func GetProductBySlug(c *gin.Context) {
+	id, ok := resolveSlug(c, services.SlugProduct, "/api/products/slug/")
+	if !ok {
+		return
+	}
+	writeProductDetail(c, strconv.FormatUint(uint64(id), 10))
+}
+
+// GetCategoryBySlug retrieves a single category by its slug
+func GetCategoryBySlug(c *gin.Context) {
+	id, ok := resolveSlug(c, services.SlugCategory, "/api/categories/slug/")
+	if !ok {
+		return
+	}
+
+	var category *models.Category
+	if err := config.DB.Preload("Products").Preload("Image").First(&category, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// GetBrandBySlug retrieves a single brand by its permalink
+func GetBrandBySlug(c *gin.Context) {
+	id, ok := resolveSlug(c, services.SlugBrand, "/api/brands/slug/")
+	if !ok {
+		return
+	}
+
+	var brand *models.Brand
+	if err := config.DB.Preload("Products").Preload("Logo").First(&brand, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, brand)
+}
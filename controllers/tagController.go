@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tagFromPath loads the tag of the id in the path, answering 404 when there is none
+func tagFromPath(c *gin.Context) (*models.Tag, bool) {
+	var tag models.Tag
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &tag, true
+}
+
+// GetTags lists the tags by name with the number of published products having each
+func GetTags(c *gin.Context) {
+	var tags []struct {
+		ID           uint
+		Name         string
+		Slug         string
+		ProductCount int
+	}
+	err := config.DB.Model(&models.Tag{}).
+		Select(`tags.id, tags.name, tags.slug, (SELECT COUNT(*) FROM product_tags
+			INNER JOIN products ON products.id = product_tags.product_id
+			WHERE product_tags.tag_id = tags.id AND products.deleted_at IS NULL AND products.status = 'published') AS product_count`).
+		Order("tags.name ASC, tags.id ASC").Scan(&tags).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// CreateTag adds a tag, its slug generated from the name when left empty
+func CreateTag(c *gin.Context) {
+	var payload struct {
+		Name string `binding:"required"`
+		Slug string
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := models.Tag{Name: payload.Name, Slug: payload.Slug}
+	if tag.Slug != "" {
+		if tag.Slug = utils.Slugify(tag.Slug); tag.Slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidSlug.Error()})
+			return
+		}
+	}
+	if err := config.DB.Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag renames a tag. Rules of collections refer to tags by slug and stop matching when the
+// slug changes.
+func UpdateTag(c *gin.Context) {
+	var payload struct {
+		Name string `binding:"required"`
+		Slug string `binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag, ok := tagFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		slug := utils.Slugify(payload.Slug)
+		if slug == "" {
+			return services.ErrInvalidSlug
+		}
+		if slug != tag.Slug {
+			unique, err := models.UniqueSlug(tx, "tags", "slug", slug, tag.ID)
+			if err != nil {
+				return err
+			}
+			if unique != slug {
+				return services.ErrSlugTaken
+			}
+		}
+		tag.Name, tag.Slug = payload.Name, slug
+		return tx.Save(tag).Error
+	})
+	if err != nil {
+		writeSlugError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from every product having it
+func DeleteTag(c *gin.Context) {
+	tag, ok := tagFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(tag).Association("Products").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted"})
+}
+
+// SetProductTags replaces the tags of a product with the tags named, creating the missing ones
+func SetProductTags(c *gin.Context) {
+	var payload struct {
+		Tags []string
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product, ok := productFromPath(c)
+	if !ok {
+		return
+	}
+
+	var tags []models.Tag
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tags, err = services.SetProductTags(tx, product, payload.Tags)
+		return err
+	})
+	if err != nil {
+		writeSlugError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetTagProducts lists the published products of a tag, filtered, sorted and paginated like
+// GetProducts
+func GetTagProducts(c *gin.Context) {
+	var tag models.Tag
+	if err := config.DB.Where("slug = ?", c.Param("slug")).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var params utils.Parameters
+	if c.Bind(&params) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to bind identifier parameters."})
+		return
+	}
+	converter, ok := requestConverter(c)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(c, params, converter)
+	if !ok {
+		return
+	}
+	sort, ok := productSort(c, params, services.SortNewest, false)
+	if !ok {
+		return
+	}
+	filter.Status = "published"
+
+	listProducts(c, converter, sort.Scope(), filter.Scope(""), func(db *gorm.DB) *gorm.DB {
+		return db.Where("products.id IN (SELECT product_id FROM product_tags WHERE tag_id = ?)", tag.ID)
+	})
+}
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTaxClass creates a new tax class
+func CreateTaxClass(c *gin.Context) {
+	var class models.TaxClass
+
+	if err := c.ShouldBindJSON(&class); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Create(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, class)
+}
+
+// GetTaxClasses lists every tax class with its rates
+func GetTaxClasses(c *gin.Context) {
+	var classes []models.TaxClass
+
+	if err := config.DB.Preload("Rates").Order("name ASC").Find(&classes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, classes)
+}
+
+// UpdateTaxClass renames or describes a tax class
+func UpdateTaxClass(c *gin.Context) {
+	id := c.Param("id")
+	var class models.TaxClass
+
+	if err := config.DB.Where("id = ?", id).First(&class).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax class not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&class); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, class)
+}
+
+// DeleteTaxClass removes a tax class and its rates
+func DeleteTaxClass(c *gin.Context) {
+	id := c.Param("id")
+
+	var count int64
+	if err := config.DB.Model(&models.Product{}).Where("tax_class_id = ?", id).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class is still assigned to products"})
+		return
+	}
+
+	if err := config.DB.Where("tax_class_id = ?", id).Delete(&models.TaxRate{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Where("id = ?", id).Delete(&models.TaxClass{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tax class deleted"})
+}
+
+// CreateTaxRate adds a rate to a tax class for a country or region
+func CreateTaxRate(c *gin.Context) {
+	var rate models.TaxRate
+
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rate.Rate < 0 || rate.Country == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Country is required and Rate must not be negative"})
+		return
+	}
+
+	if err := config.DB.First(&models.TaxClass{}, rate.TaxClassID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class not found"})
+		return
+	}
+
+	if err := config.DB.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// GetTaxRates lists the tax rates, optionally for one country
+func GetTaxRates(c *gin.Context) {
+	var rates []models.TaxRate
+	query := config.DB.Order("country ASC, region ASC, id ASC")
+
+	if country := c.Query("country"); country != "" {
+		query = query.Where("LOWER(country) = LOWER(?)", country)
+	}
+
+	if err := query.Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// UpdateTaxRate changes a tax rate
+func UpdateTaxRate(c *gin.Context) {
+	id := c.Param("id")
+	var rate models.TaxRate
+
+	if err := config.DB.Where("id = ?", id).First(&rate).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rate.Rate < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must not be negative"})
+		return
+	}
+
+	if err := config.DB.Save(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rate)
+}
+
+// DeleteTaxRate removes a tax rate
+func DeleteTaxRate(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := config.DB.Where("id = ?", id).Delete(&models.TaxRate{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rate deleted"})
+}
+
+// GetTaxSettings returns the store wide tax configuration
+func GetTaxSettings(c *gin.Context) {
+	setting, err := services.TaxSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// UpdateTaxSettings switches between inclusive and exclusive prices and sets the default classes
+func UpdateTaxSettings(c *gin.Context) {
+	setting, err := services.TaxSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&setting).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setting)
+}
+
+// EstimateCartTax returns the tax a cart would be charged for a destination
+func EstimateCartTax(c *gin.Context) {
+	var payload struct {
+		Country  string `binding:"required"`
+		Region   string
+		Shipping utils.Money
+		Items    []struct {
+			ProductID uint `binding:"required"`
+			VariantID *uint
+			Quantity  int `binding:"required,gt=0"`
+		} `binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var lines []services.CartLine
+	for _, item := range payload.Items {
+		lines = append(lines, services.CartLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	lines, err := services.LoadCartLines(config.DB, lines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setting, err := services.TaxSettings(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	request := services.TaxRequest{
+		Address:          services.TaxAddress{Country: payload.Country, Region: payload.Region},
+		Shipping:         payload.Shipping,
+		PricesIncludeTax: setting.PricesIncludeTax,
+	}
+	for i, line := range lines {
+		request.Lines = append(request.Lines, services.TaxLine{
+			Reference:  i,
+			ProductID:  line.ProductID,
+			TaxClassID: line.TaxClassID,
+			Amount:     line.UnitPrice.Mul(line.Quantity),
+		})
+	}
+
+	result, err := services.NewTaxCalculator(config.DB).Calculate(request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"PricesIncludeTax": setting.PricesIncludeTax,
+		"TaxAmount":        result.TotalTax,
+		"ShippingTax":      result.ShippingTax,
+		"Breakdown":        result.Breakdown,
+	})
+}
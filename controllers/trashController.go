@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/morkid/paginate"
+	"gorm.io/gorm"
+)
+
+// writeTrashError answers a failed delete, restore or purge
+func writeTrashError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found in the trash"})
+	case errors.Is(err, services.ErrCategoryInUse) || errors.Is(err, services.ErrBrandInUse) ||
+		errors.Is(err, services.ErrTrashedParent) || errors.Is(err, services.ErrStillReferred):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// listTrash answers a page of the deleted rows of model, the latest deleted first, with the time
+// each is purged at
+func listTrash(c *gin.Context, model *gorm.DB, columns string, rows interface{}) {
+	model = model.Unscoped().Select(columns+", deleted_at, deleted_at + make_interval(secs => ?) AS purge_at", services.TrashRetention.Seconds()).
+		Where("deleted_at IS NOT NULL").Order("deleted_at DESC, id DESC")
+
+	pg := paginate.New()
+	page := pg.With(model).Request(c.Request).Response(rows)
+
+	if page.Error {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": page.ErrorMessage})
+		return
+	}
+
+	c.JSON(http.StatusOK, &page)
+}
+
+// trashID parses the id in the path of a trash request
+func trashID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetTrashedProducts lists the deleted products, their variations are restored along with them
+func GetTrashedProducts(c *gin.Context) {
+	var products []*struct {
+		ID         uint
+		Name       string
+		SKU        string
+		Slug       string
+		CategoryID uint
+		BrandID    *uint
+		DeletedAt  time.Time
+		PurgeAt    time.Time
+	}
+	listTrash(c, config.DB.Model(&models.Product{}).Where("is_child = false"), "id, name, sku, slug, category_id, brand_id", &products)
+}
+
+// RestoreTrashedProduct brings a product back from the trash with its variations, variants and
+// stock
+func RestoreTrashedProduct(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	var product *models.Product
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = services.RestoreProduct(tx, id)
+		return err
+	})
+	if err != nil {
+		writeTrashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// PurgeProduct permanently deletes a product in the trash without waiting for the retention period
+func PurgeProduct(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	var images []models.Image
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		images, err = services.PurgeProduct(tx, id)
+		return err
+	})
+	if err != nil {
+		writeTrashError(c, err)
+		return
+	}
+	if err := models.DiscardImageFiles(config.DB, images); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Product purged, its image files could not be deleted: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product purged"})
+}
+
+// GetTrashedCategories lists the deleted categories
+func GetTrashedCategories(c *gin.Context) {
+	var categories []*struct {
+		ID           uint
+		Name         string
+		CategoryType string
+		ParentID     *uint
+		Slug         string
+		DeletedAt    time.Time
+		PurgeAt      time.Time
+	}
+	listTrash(c, config.DB.Model(&models.Category{}), "id, name, category_type, parent_id, slug", &categories)
+}
+
+// RestoreTrashedCategory brings a category back from the trash
+func RestoreTrashedCategory(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	category, err := services.RestoreCategory(config.DB, id)
+	if err != nil {
+		writeTrashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// PurgeCategory permanently deletes a category in the trash without waiting for the retention
+// period
+func PurgeCategory(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error { return services.PurgeCategory(tx, id) }); err != nil {
+		writeTrashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category purged"})
+}
+
+// GetTrashedBrands lists the deleted brands
+func GetTrashedBrands(c *gin.Context) {
+	var brands []*struct {
+		ID        uint
+		Name      string
+		Permalink string
+		DeletedAt time.Time
+		PurgeAt   time.Time
+	}
+	listTrash(c, config.DB.Model(&models.Brand{}), "id, name, permalink", &brands)
+}
+
+// RestoreTrashedBrand brings a brand back from the trash
+func RestoreTrashedBrand(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	brand, err := services.RestoreBrand(config.DB, id)
+	if err != nil {
+		writeTrashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, brand)
+}
+
+// PurgeBrand permanently deletes a brand in the trash without waiting for the retention period
+func PurgeBrand(c *gin.Context) {
+	id, ok := trashID(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error { return services.PurgeBrand(tx, id) }); err != nil {
+		writeTrashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Brand purged"})
+}
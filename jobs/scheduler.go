@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"backend/config"
+	"backend/services"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Start launches the background jobs, each on its own ticker. TRASH_RETENTION_DAYS sets how long
+// deleted products, categories and brands are kept, 30 days by default. CO_PURCHASE_WINDOW_DAYS
+// sets the days of orders products bought together are counted over, a year by default.
+func Start() {
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		services.TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+	coPurchaseWindow := services.DefaultCoPurchaseWindow
+	if days, err := strconv.Atoi(os.Getenv("CO_PURCHASE_WINDOW_DAYS")); err == nil && days > 0 {
+		coPurchaseWindow = days
+	}
+
+	go every("apply scheduled prices", time.Minute, func() error {
+		_, err := services.ApplyScheduledPrices(config.DB)
+		return err
+	})
+	go every("publish scheduled products", time.Minute, func() error {
+		_, err := services.ApplyScheduledPublishing(config.DB)
+		return err
+	})
+	go every("purge the trash", time.Hour, func() error {
+		_, err := services.PurgeTrash(config.DB, time.Now().Add(-services.TrashRetention))
+		return err
+	})
+	go every("compute co-purchases", 6*time.Hour, func() error {
+		_, err := services.ComputeCoPurchases(config.DB, coPurchaseWindow)
+		return err
+	})
+}
+
+// every runs job immediately and then once per interval, logging failures
+func every(name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("job %q failed: %s", name, err.Error())
+		}
+		<-ticker.C
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"backend/config"
+	"backend/jobs"
 	"backend/middlewares"
 	"backend/routes"
 	"net/http"
@@ -19,6 +20,8 @@ func main() {
 	router.Use(gin.Recovery())
 
 	config.ConnectDatabase()
+	config.ConnectBlobStore()
+	jobs.Start()
 
 	router.GET("/", func(ctx *gin.Context) { ctx.JSON(http.StatusOK, "Hanger Craft API Service health is OK") })
 	// Liveness Probe: Returns 200 if the app is running
@@ -37,7 +40,8 @@ func main() {
 		c.AbortWithStatus(http.StatusOK)
 	})
 	router.Use(middlewares.CORSMiddleware())
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	// images are compressed already
+	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/images/", "/media/"})))
 
 	routes.CartRoutes(router)
 	routes.CategoryRoutes(router)
@@ -51,6 +55,16 @@ func main() {
 	routes.CuponRoutes(router)
 	routes.AdminDashboardRoutes(router)
 	routes.ContentRoutes(router)
+	routes.PromotionRoutes(router)
+	routes.GiftCardRoutes(router)
+	routes.LoyaltyRoutes(router)
+	routes.TaxRoutes(router)
+	routes.CurrencyRoutes(router)
+	routes.InvoiceRoutes(router)
+	routes.MediaRoutes(router)
+	routes.ImageRoutes(router)
+	routes.CollectionRoutes(router)
+	routes.TagRoutes(router)
 
 	router.Run(":3000")
 }
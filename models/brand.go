@@ -1,8 +1,6 @@
 package models
 
 import (
-	"backend/utils"
-
 	"gopkg.in/guregu/null.v4"
 	"gorm.io/gorm"
 )
@@ -11,44 +9,36 @@ type Brand struct {
 	gorm.Model
 	Name      null.String `gorm:"size:100;not null"`
 	Status    *string     `gorm:"not null;check:status IN ('published', 'unpublished')"`
-	Permalink *string     `gorm:"not null;default:''"`
+	Permalink *string     `gorm:"not null;default:'';uniqueIndex:idx_brands_permalink,where:permalink <> ''"` // Slug of the brand, generated from the name when left empty
 	Logo      *BrandImage `gorm:"foreignKey:BrandID"`
 	Products  []Product   `gorm:"foreignKey:BrandID"`
 }
 
 type BrandImage struct {
-	ID         uint `gorm:"primaryKey"`
-	BrandID    uint
-	Brand      Brand  `gorm:"foreignKey:BrandID" json:"-"`
-	Image      string `gorm:"-" json:"Image"`
-	ImageBytes []byte `gorm:"column:image;type:bytea" json:"-"` // Binary data for the image
+	ID      uint `gorm:"primaryKey"`
+	BrandID uint
+	Brand   Brand `gorm:"foreignKey:BrandID" json:"-"`
+	StoredImage
 }
 
 func (c *BrandImage) AfterFind(tx *gorm.DB) (err error) {
-	c.Image = utils.EncodeImageToBase64(c.ImageBytes)
+	c.resolve()
 
 	return nil
 
 }
 
 func (c *BrandImage) BeforeCreate(tx *gorm.DB) (err error) {
-	bt, err := utils.DecodeBase64Image(c.Image)
-	if err != nil {
-		return err
-	}
-
-	c.ImageBytes = bt
-
-	return nil
-
+	_, err = c.upload(tx)
+	return err
 }
 
-// func (c *Brand) BeforeCreate(tx *gorm.DB) (err error) {
-
-// 	if c.CategoryType.String == "child" && c.ParentID == nil {
-// 		return errors.New("must provide parent category id when creating child category")
-// 	}
-
-// 	return nil
-
-// }
+func (c *Brand) BeforeCreate(tx *gorm.DB) (err error) {
+	text := c.Name.String
+	if c.Permalink != nil && *c.Permalink != "" {
+		text = *c.Permalink
+	}
+	slug, err := UniqueSlug(tx, "brands", "permalink", text, 0)
+	c.Permalink = &slug
+	return err
+}
@@ -8,7 +8,9 @@ type CartItem struct {
 	Cart      ShoppingCart `gorm:"foreignKey:CartID;references:UUID;constraint:OnDelete:CASCADE"`
 	ProductID uint         `gorm:"not null"`
 	Product   Product      `gorm:"foreignKey:ProductID"`
-	Quantity  int          `gorm:"not null"`
+	VariantID *uint
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID"`
+	Quantity  int             `gorm:"not null"`
 }
 type WishList struct {
 	ID        uint    `gorm:"primaryKey"`
@@ -1,55 +1,146 @@
 package models
 
 import (
-	"backend/utils"
 	"errors"
+	"strconv"
+	"strings"
 
 	"gopkg.in/guregu/null.v4"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUnknownParent  = errors.New("the parent category does not exist")
+	ErrCategoryNoPath = errors.New("the category tree is not built yet, run cmd/categorytree")
+)
+
 type Category struct {
 	gorm.Model
-	Name         null.String `gorm:"size:100;not null"`
-	CategoryType null.String `gorm:"size:100;not null;check:category_type IN ('parent', 'child', 'grandchild')"`
-	ParentID     *uint
-	Image        *CategoryImage `gorm:"foreignKey:CategoryID"`
-	Products     []Product      `gorm:"foreignKey:CategoryID"`
+	Name null.String `gorm:"size:100;not null"`
+	// CategoryType follows the depth: parent at the top, child below it and grandchild further down
+	CategoryType null.String `gorm:"size:100;not null"`
+	ParentID     *uint       `gorm:"index"`
+	// Path lists the ids from the top category down to this one, like "/1/4/9/". The categories
+	// below one are those whose path starts with its path.
+	Path     string `gorm:"size:1000;not null;default:''" json:"-"`
+	Depth    int    `gorm:"not null;default:0"` // 0 for top categories
+	Position int    `gorm:"not null;default:0"` // Sort order among the categories of the same parent
+	// Slug addresses the category in storefront URLs, generated from the name when left empty
+	Slug            string         `gorm:"size:200;not null;default:'';uniqueIndex:idx_categories_slug,where:slug <> ''"`
+	MetaTitle       string         `gorm:"size:150"` // Title of the category page, the name when empty
+	MetaDescription string         `gorm:"size:320"`
+	Image           *CategoryImage `gorm:"foreignKey:CategoryID"`
+	Products        []Product      `gorm:"foreignKey:CategoryID"`
 }
 
 type CategoryImage struct {
 	ID         uint `gorm:"primaryKey"`
 	CategoryID uint
 	Category   Category `gorm:"foreignKey:CategoryID" json:"-"`
-	Image      string   `gorm:"-" json:"Image"`
-	ImageBytes []byte   `gorm:"column:image;type:bytea" json:"-"` // Binary data for the image
+	StoredImage
 }
 
 func (c *CategoryImage) AfterFind(tx *gorm.DB) (err error) {
-	c.Image = utils.EncodeImageToBase64(c.ImageBytes)
+	c.resolve()
 
 	return nil
 
 }
 
 func (c *CategoryImage) BeforeCreate(tx *gorm.DB) (err error) {
-	bt, err := utils.DecodeBase64Image(c.Image)
-	if err != nil {
-		return err
+	_, err = c.upload(tx)
+	return err
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+
+	if (c.CategoryType.String == "child" || c.CategoryType.String == "grandchild") && c.ParentID == nil {
+		return errors.New("must provide parent category id when creating sub category")
 	}
 
-	c.ImageBytes = bt
+	// the category goes last among its siblings, at the depth below its parent. Its path extends
+	// the path of the parent, which a tree that was never built doesn't have.
+	db := tx.Session(&gorm.Session{NewDB: true})
+	c.Depth = 0
+	if c.ParentID != nil {
+		var parent Category
+		if err := db.Select("id, depth, path").Where("id = ?", *c.ParentID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUnknownParent
+			}
+			return err
+		}
+		if parent.Path == "" {
+			return ErrCategoryNoPath
+		}
+		c.Depth = parent.Depth + 1
+	}
+	c.CategoryType = null.StringFrom(CategoryTypeAt(c.Depth))
 
-	return nil
+	var last struct{ Position *int }
+	siblings := db.Model(&Category{}).Select("MAX(position) AS position")
+	if c.ParentID == nil {
+		siblings = siblings.Where("parent_id IS NULL")
+	} else {
+		siblings = siblings.Where("parent_id = ?", *c.ParentID)
+	}
+	if err := siblings.Scan(&last).Error; err != nil {
+		return err
+	}
+	c.Position = 0
+	if last.Position != nil {
+		c.Position = *last.Position + 1
+	}
+
+	text := c.Slug
+	if text == "" {
+		text = c.Name.String
+	}
+	c.Slug, err = UniqueSlug(tx, "categories", "slug", text, 0)
+	return err
 
 }
 
-func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+// AfterCreate sets the path, which needs the id of the category
+func (c *Category) AfterCreate(tx *gorm.DB) (err error) {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	parentPath := "/"
+	if c.ParentID != nil {
+		if err := db.Model(&Category{}).Where("id = ?", *c.ParentID).Pluck("path", &parentPath).Error; err != nil {
+			return err
+		}
+	}
+	c.Path = parentPath + strconv.FormatUint(uint64(c.ID), 10) + "/"
+	return db.Model(&Category{}).Where("id = ?", c.ID).Update("path", c.Path).Error
+}
 
-	if (c.CategoryType.String == "child" || c.CategoryType.String == "grandchild") && c.ParentID == nil {
-		return errors.New("must provide parent category id when creating sub category")
+// Ancestors returns the ids of the categories above this one, the top category first
+func (c *Category) Ancestors() []uint {
+	ids := PathIDs(c.Path)
+	if len(ids) == 0 {
+		return nil
 	}
+	return ids[:len(ids)-1]
+}
 
-	return nil
+// PathIDs parses a category path like "/1/4/9/" into its ids
+func PathIDs(path string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if id, err := strconv.ParseUint(part, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
 
+// CategoryTypeAt names the type of the categories at a depth
+func CategoryTypeAt(depth int) string {
+	switch depth {
+	case 0:
+		return "parent"
+	case 1:
+		return "child"
+	}
+	return "grandchild"
 }
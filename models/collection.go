@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag labels products for merchandising, such as "summer" or "gift-ideas"
+type Tag struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"size:100;not null"`
+	Slug      string    `gorm:"size:120;not null;uniqueIndex"`
+	Products  []Product `gorm:"many2many:product_tags;joinForeignKey:TagID;joinReferences:ProductID" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (t *Tag) BeforeCreate(tx *gorm.DB) (err error) {
+	text := t.Slug
+	if text == "" {
+		text = t.Name
+	}
+	t.Slug, err = UniqueSlug(tx, "tags", "slug", text, 0)
+	return err
+}
+
+// Collection is a curated listing of products. A manual collection lists the products picked
+// for it in their order, a rules collection the products matching its rules. It is shown
+// between StartDate and EndDate while active, an empty date leaving that side open.
+type Collection struct {
+	gorm.Model
+	Name            string          `gorm:"size:150;not null"`
+	Slug            string          `gorm:"size:200;not null;uniqueIndex"`
+	Description     string          `gorm:"type:text"`
+	MetaTitle       string          `gorm:"size:150"`
+	MetaDescription string          `gorm:"size:320"`
+	CollectionType  string          `gorm:"size:20;not null;check:collection_type IN ('manual', 'rules')"`
+	Rules           CollectionRules `gorm:"type:jsonb;not null;default:'[]'"`
+	// Match is "all" when a product has to match every rule, "any" when one is enough
+	Match     string              `gorm:"size:3;not null;default:'all';check:match IN ('all', 'any')"`
+	StartDate *time.Time          `gorm:"index"`
+	EndDate   *time.Time          `gorm:"index"`
+	IsActive  bool                `gorm:"default:true"`
+	Products  []CollectionProduct `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE" json:",omitempty"`
+}
+
+// CollectionProduct is a product picked for a manual collection, at Position in its order
+type CollectionProduct struct {
+	CollectionID uint    `gorm:"primaryKey"`
+	ProductID    uint    `gorm:"primaryKey;index"`
+	Product      Product `gorm:"foreignKey:ProductID" json:"-"`
+	Position     int     `gorm:"not null;default:0"`
+}
+
+// CollectionRule is a condition on the products of a rules collection, such as
+// {"Field": "price", "Operator": "lt", "Value": "50"}. See services.CollectionScope for the
+// fields and operators.
+type CollectionRule struct {
+	Field    string `binding:"required"`
+	Operator string `binding:"required"`
+	Value    string
+}
+
+// CollectionRules are stored as a JSON list
+type CollectionRules []CollectionRule
+
+func (r CollectionRules) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	return string(data), err
+}
+
+func (r *CollectionRules) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	}
+	return fmt.Errorf("cannot scan %T into collection rules", value)
+}
+
+func (c *Collection) BeforeCreate(tx *gorm.DB) (err error) {
+	text := c.Slug
+	if text == "" {
+		text = c.Name
+	}
+	c.Slug, err = UniqueSlug(tx, "collections", "slug", text, 0)
+	return err
+}
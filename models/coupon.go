@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/utils"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,17 +9,17 @@ import (
 
 type Coupon struct {
 	gorm.Model
-	Code              string     `gorm:"size:50;unique;not null"`                                         // Unique coupon code
-	Description       string     `gorm:"type:text"`                                                       // Description of the coupon
-	DiscountType      string     `gorm:"size:20;not null;check:discount_type IN ('percentage', 'fixed')"` // Type of discount: 'percentage' or 'fixed'
-	DiscountValue     float64    `gorm:"type:numeric(10,2);not null"`                                     // Discount value (percentage or fixed amount)
-	MinOrderValue     *float64   `gorm:"type:numeric(10,2)"`                                              // Minimum order value required to use the coupon
-	MaxDiscountValue  *float64   `gorm:"type:numeric(10,2)"`                                              // Max discount for percentage-based coupons
-	UsageLimit        *int       // Total times this coupon can be used
-	UsageLimitPerUser int        `gorm:"default:1"` // Times each user can use the coupon
-	StartDate         time.Time  `gorm:"not null"`  // Start date for coupon validity
-	ExpirationDate    *time.Time // Expiration date for coupon validity
-	IsActive          bool       `gorm:"default:true"` // Whether the coupon is active
+	Code              string       `gorm:"size:50;unique;not null"`                                         // Unique coupon code
+	Description       string       `gorm:"type:text"`                                                       // Description of the coupon
+	DiscountType      string       `gorm:"size:20;not null;check:discount_type IN ('percentage', 'fixed')"` // Type of discount: 'percentage' or 'fixed'
+	DiscountValue     utils.Money  `gorm:"type:numeric(10,2);not null"`                                     // Discount value (percentage or fixed amount)
+	MinOrderValue     *utils.Money `gorm:"type:numeric(10,2)"`                                              // Minimum order value required to use the coupon
+	MaxDiscountValue  *utils.Money `gorm:"type:numeric(10,2)"`                                              // Max discount for percentage-based coupons
+	UsageLimit        *int         // Total times this coupon can be used
+	UsageLimitPerUser int          `gorm:"default:1"` // Times each user can use the coupon
+	StartDate         time.Time    `gorm:"not null"`  // Start date for coupon validity
+	ExpirationDate    *time.Time   // Expiration date for coupon validity
+	IsActive          bool         `gorm:"default:true"` // Whether the coupon is active
 }
 
 type CouponUsageHistory struct {
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+)
+
+// Currency is a currency the store sells in. Rate is the number of units of the
+// currency that equal one unit of the base currency and is maintained by an admin.
+type Currency struct {
+	Code      string    `gorm:"primaryKey;size:3"`
+	Name      string    `gorm:"size:100;not null"`
+	Symbol    string    `gorm:"size:10"`
+	Rate      float64   `gorm:"type:numeric(18,8);not null;default:1;check:rate > 0"`
+	IsActive  bool      `gorm:"default:true"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// CurrencySetting holds the base currency revenue is reported in, a single row
+type CurrencySetting struct {
+	ID           uint      `gorm:"primaryKey"`
+	BaseCurrency string    `gorm:"size:3;not null;default:'USD'"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+// ProductPrice is a fixed price of a product in one currency. It takes precedence
+// over converting the product's own price with the exchange rate.
+type ProductPrice struct {
+	ID             uint         `gorm:"primaryKey"`
+	ProductID      uint         `gorm:"not null;uniqueIndex:idx_product_price_currency"`
+	Product        Product      `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"-"`
+	Currency       string       `gorm:"size:3;not null;uniqueIndex:idx_product_price_currency"`
+	Price          utils.Money  `gorm:"type:decimal(10,2);not null"`
+	CompareAtPrice *utils.Money `gorm:"type:decimal(10,2)"`
+	SalePrice      *utils.Money `gorm:"type:decimal(10,2)"` // Follows the sale window of the product
+	UpdatedAt      time.Time    `gorm:"autoUpdateTime"`
+}
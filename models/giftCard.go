@@ -0,0 +1,62 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GiftCard struct {
+	gorm.Model
+	Code           string      `gorm:"size:32;unique;not null;index"`
+	InitialBalance utils.Money `gorm:"type:decimal(10,2);not null"`
+	Balance        utils.Money `gorm:"type:decimal(10,2);not null;check:balance >= 0"`
+	Currency       string      `gorm:"size:3;not null"`
+	Source         string      `gorm:"size:20;not null;check:source IN ('issued', 'purchased')"`
+	PurchasedBy    *uint       // Customer who bought the card, empty for cards issued by an admin
+	User           *User       `gorm:"foreignKey:PurchasedBy" json:"-"`
+	RecipientEmail *string     `gorm:"size:100"`
+	ExpirationDate *time.Time
+	IsActive       bool                  `gorm:"default:false"` // Purchased cards are activated once paid
+	Transactions   []GiftCardTransaction `gorm:"foreignKey:GiftCardID"`
+}
+
+// GiftCardTransaction is a ledger entry for every change to a gift card balance.
+// Amount is positive when value is added to the card and negative when it is spent.
+type GiftCardTransaction struct {
+	ID              uint        `gorm:"primaryKey"`
+	GiftCardID      uint        `gorm:"not null;index"`
+	GiftCard        GiftCard    `gorm:"foreignKey:GiftCardID" json:"-"`
+	OrderID         *uint       `gorm:"index"`
+	UserID          *uint       // Customer redeeming or admin adjusting the card
+	TransactionType string      `gorm:"size:20;not null;check:transaction_type IN ('issue', 'redeem', 'refund', 'reversal', 'adjust')"`
+	Amount          utils.Money `gorm:"type:decimal(10,2);not null"`
+	BalanceAfter    utils.Money `gorm:"type:decimal(10,2);not null"`
+	Note            string      `gorm:"type:text"`
+	CreatedAt       time.Time   `gorm:"autoCreateTime"`
+}
+
+// StoreCreditAccount holds the current store credit balance of a customer
+type StoreCreditAccount struct {
+	ID        uint        `gorm:"primaryKey"`
+	UserID    uint        `gorm:"not null;unique"`
+	User      User        `gorm:"foreignKey:UserID" json:"-"`
+	Balance   utils.Money `gorm:"type:decimal(10,2);default:0;not null;check:balance >= 0"`
+	UpdatedAt time.Time   `gorm:"autoUpdateTime"`
+}
+
+// StoreCreditTransaction is a ledger entry for every change to a customer's store credit.
+// Amount is positive when credit is issued and negative when it is spent.
+type StoreCreditTransaction struct {
+	ID              uint        `gorm:"primaryKey"`
+	UserID          uint        `gorm:"not null;index"`
+	User            User        `gorm:"foreignKey:UserID" json:"-"`
+	OrderID         *uint       `gorm:"index"`
+	TransactionType string      `gorm:"size:20;not null;check:transaction_type IN ('issue', 'refund', 'redeem', 'reversal', 'adjust')"`
+	Amount          utils.Money `gorm:"type:decimal(10,2);not null"`
+	BalanceAfter    utils.Money `gorm:"type:decimal(10,2);not null"`
+	Note            string      `gorm:"type:text"`
+	CreatedBy       *uint       // Admin who issued or adjusted the credit
+	CreatedAt       time.Time   `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"backend/storage"
+	"backend/utils"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Image is an uploaded picture with its renditions. Identical uploads share one Image, so the
+// files are only processed and stored once.
+type Image struct {
+	ID          uint            `gorm:"primaryKey"`
+	Hash        string          `gorm:"size:64;not null;uniqueIndex"` // SHA-256 of the uploaded bytes
+	Format      string          `gorm:"size:10;not null"`             // Format of the upload, such as "jpeg"
+	Width       int             `gorm:"not null"`
+	Height      int             `gorm:"not null"`
+	ContentType string          `gorm:"size:50;not null"`  // Of the original
+	Key         string          `gorm:"size:300;not null"` // Original without its metadata
+	Renditions  ImageRenditions `gorm:"type:jsonb;not null;default:'[]'"`
+	// Defaults of the records the image is attached to, given when it was uploaded
+	AltText   string  `gorm:"size:300;not null;default:''"`
+	Color     *string `gorm:"size:50"` // Color of the product the image shows
+	Position  int     `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// ImageRendition is a scaled down copy of an image in one format
+type ImageRendition struct {
+	Name        string // thumbnail, card or zoom
+	ContentType string
+	Width       int
+	Height      int
+	Key         string
+}
+
+// ImageRenditions is stored as JSON next to the image records showing it
+type ImageRenditions []ImageRendition
+
+func (r ImageRenditions) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	return string(data), err
+}
+
+func (r *ImageRenditions) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	}
+	return fmt.Errorf("cannot scan %T into image renditions", value)
+}
+
+// ImageURL is where the API serves images from, a CDN in front of the API can replace it
+var ImageURL = "/api/images"
+
+// File returns the blob of the original, "original", or of a rendition named like "card" or
+// "card.webp". Without an extension the JPEG or PNG rendition is meant.
+func (i *Image) File(name string) (key string, contentType string, ok bool) {
+	if name == "" || name == "original" {
+		return i.Key, i.ContentType, true
+	}
+	name, webp := strings.CutSuffix(name, ".webp")
+	for _, rendition := range i.Renditions {
+		if rendition.Name == name && (rendition.ContentType == "image/webp") == webp {
+			return rendition.Key, rendition.ContentType, true
+		}
+	}
+	return "", "", false
+}
+
+// ErrUnknownImage is returned when attaching an image ID that was never uploaded
+var ErrUnknownImage = errors.New("no image was uploaded with this ImageID")
+
+// StoredImage is the picture of a product, brand, category or banner image. It is given as the
+// ImageID of an uploaded image, or as base64 encoded data in Image, and answered with the URLs of
+// the original and its renditions.
+type StoredImage struct {
+	ImageID    *uint           `gorm:"index"`
+	AltText    string          `gorm:"size:300;not null;default:''"`          // The alt text of the image when empty
+	ImageKey   string          `gorm:"size:300;not null;default:''" json:"-"` // Blob store key of the original
+	Renditions ImageRenditions `gorm:"type:jsonb" json:"-"`
+	Image      string          `gorm:"-" json:"Image"` // URL of the original, base64 encoded data when creating
+	// Sources are the URLs of the renditions in JPEG, or PNG for images with transparency
+	Sources map[string]string `gorm:"-" json:"Sources,omitempty"`
+	// Srcset lists the renditions by width for each content type, ready for a srcset attribute
+	Srcset map[string]string `gorm:"-" json:"Srcset,omitempty"`
+}
+
+// upload points a new record at its image, processing base64 encoded data or looking up the
+// uploaded image of ImageID, which is returned. Records created with a key, such as a copy of a
+// stored image, keep it.
+func (s *StoredImage) upload(tx *gorm.DB) (*Image, error) {
+	if s.ImageKey != "" || (s.Image == "" && s.ImageID == nil) {
+		s.resolve()
+		return nil, nil
+	}
+
+	var image *Image
+	if s.Image != "" {
+		data, err := utils.DecodeBase64Image(s.Image)
+		if err != nil {
+			return nil, err
+		}
+		if image, err = StoreImage(tx, data); err != nil {
+			return nil, err
+		}
+	} else {
+		image = &Image{}
+		if err := tx.Session(&gorm.Session{NewDB: true}).First(image, *s.ImageID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrUnknownImage
+			}
+			return nil, err
+		}
+	}
+	s.Use(image)
+	return image, nil
+}
+
+// Use points the record at a stored image, taking its alt text unless the record has its own
+func (s *StoredImage) Use(image *Image) {
+	s.ImageID = &image.ID
+	s.ImageKey = image.Key
+	s.Renditions = image.Renditions
+	if s.AltText == "" {
+		s.AltText = image.AltText
+	}
+	s.resolve()
+}
+
+// resolve fills in the URLs of the image. Processed images are served by the API, images stored
+// before they were processed straight from the blob store.
+func (s *StoredImage) resolve() {
+	s.Image = storage.URL(s.ImageKey)
+	s.Sources, s.Srcset = nil, nil
+	if s.ImageID == nil || len(s.Renditions) == 0 {
+		return
+	}
+
+	base := fmt.Sprintf("%s/%d", strings.TrimRight(ImageURL, "/"), *s.ImageID)
+	s.Image = base
+
+	s.Sources = make(map[string]string)
+	s.Srcset = make(map[string]string)
+	widths := make(map[string]int)
+	for _, rendition := range s.Renditions {
+		url := base + "/" + rendition.Name
+		if rendition.ContentType == "image/webp" {
+			url += ".webp"
+		} else {
+			s.Sources[rendition.Name] = url
+		}
+		// an image smaller than a rendition repeats its width, listing it once is enough
+		if rendition.Width <= widths[rendition.ContentType] {
+			continue
+		}
+		widths[rendition.ContentType] = rendition.Width
+		if s.Srcset[rendition.ContentType] != "" {
+			s.Srcset[rendition.ContentType] += ", "
+		}
+		s.Srcset[rendition.ContentType] += fmt.Sprintf("%s %dw", url, rendition.Width)
+	}
+}
+
+// StoreImage runs uploaded image data through the image pipeline and stores the files, or finds
+// the Image of an identical earlier upload
+func StoreImage(tx *gorm.DB, data []byte) (*Image, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var image Image
+	err := db.Where("hash = ?", hash).First(&image).Error
+	if err == nil {
+		return &image, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	processed, err := storage.ProcessImage(data)
+	if err != nil {
+		return nil, err
+	}
+	if storage.Default == nil {
+		return nil, errors.New("no blob store is connected")
+	}
+
+	// keys follow from the hash, so a retried upload overwrites what an interrupted one left
+	folder := path.Join("images", hash[:2], hash)
+	put := func(file storage.ImageFile) (string, error) {
+		key := path.Join(folder, file.Name+imageExtensions[file.ContentType])
+		return key, storage.Default.Put(key, file.Data, file.ContentType)
+	}
+
+	image = Image{
+		Hash:        hash,
+		Format:      processed.Format,
+		Width:       processed.Original.Width,
+		Height:      processed.Original.Height,
+		ContentType: processed.Original.ContentType,
+		Renditions:  ImageRenditions{},
+	}
+	if image.Key, err = put(processed.Original); err != nil {
+		return nil, err
+	}
+	for _, file := range processed.Renditions {
+		key, err := put(file)
+		if err != nil {
+			return nil, err
+		}
+		image.Renditions = append(image.Renditions, ImageRendition{
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Width:       file.Width,
+			Height:      file.Height,
+			Key:         key,
+		})
+	}
+
+	// an identical image uploaded at the same time wins the insert, its files are the same
+	result := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "hash"}}, DoNothing: true}).Create(&image)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := db.Where("hash = ?", hash).First(&image).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// DiscardImageFiles deletes the stored files of images that have no row, such as the images stored
+// by a transaction that was rolled back. Files are shared by every upload of the same data, so
+// the files of an image whose hash is in the table are kept.
+func DiscardImageFiles(db *gorm.DB, images []Image) error {
+	var errs []error
+	for _, image := range images {
+		var count int64
+		if err := db.Model(&Image{}).Where("hash = ?", image.Hash).Count(&count).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if count > 0 || storage.Default == nil {
+			continue
+		}
+		keys := []string{image.Key}
+		for _, rendition := range image.Renditions {
+			keys = append(keys, rendition.Key)
+		}
+		for _, key := range keys {
+			if key == "" {
+				continue
+			}
+			if err := storage.Default.Delete(key); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// IsImageError reports whether err is about the uploaded data rather than a failure to store it
+func IsImageError(err error) bool {
+	var corrupt base64.CorruptInputError
+	return errors.Is(err, storage.ErrUnsupportedImage) || errors.Is(err, storage.ErrImageDimensions) ||
+		errors.Is(err, ErrUnknownImage) || errors.As(err, &corrupt)
+}
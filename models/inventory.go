@@ -10,6 +10,7 @@ type Inventory struct {
 	gorm.Model
 	ProductID  uint    `gorm:"not null"`
 	Product    Product `gorm:"foreignKey:ProductID" json:"-"`
+	VariantID  *uint   `gorm:"index"` // Stock of a variant, empty for the stock of the product itself
 	StockLevel int     `gorm:"not null"`
 	InOpen     int     `gorm:"not null"`
 	ChangeType string  `gorm:"size:50;not null;check:change_type IN ('restock', 'purchase')"`
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+)
+
+// Invoice is an immutable snapshot of an order at the time it was invoiced. Credit notes are
+// invoices of type credit_note that point at the invoice they correct; their amounts are positive.
+type Invoice struct {
+	ID              uint        `gorm:"primaryKey"`
+	Number          string      `gorm:"size:30;not null;unique"`
+	InvoiceType     string      `gorm:"size:20;not null;check:invoice_type IN ('invoice', 'credit_note')"`
+	OrderID         uint        `gorm:"not null;index"`
+	Order           Order       `gorm:"foreignKey:OrderID" json:"-"`
+	InvoiceID       *uint       `gorm:"index"` // Invoice a credit note belongs to
+	Currency        string      `gorm:"size:3;not null"`
+	CustomerName    string      `gorm:"size:100;not null"`
+	CustomerEmail   string      `gorm:"size:100;not null"`
+	ShippingAddress string      `gorm:"type:text"`
+	ItemTotal       utils.Money `gorm:"type:decimal(10,2);not null"`
+	DiscountAmount  utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+	ShippingCost    utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+	TaxAmount       utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+	Total           utils.Money `gorm:"type:decimal(10,2);not null"`
+	Reason          string      `gorm:"type:text"`
+	IssuedBy        *uint
+	IssuedAt        time.Time     `gorm:"not null"`
+	Lines           []InvoiceLine `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
+}
+
+type InvoiceLine struct {
+	ID          uint        `gorm:"primaryKey"`
+	InvoiceID   uint        `gorm:"not null;index" json:"-"`
+	OrderItemID uint        `gorm:"not null"`
+	ProductID   uint        `gorm:"not null"`
+	Description string      `gorm:"size:255;not null"`
+	SKU         string      `gorm:"size:150"`
+	Quantity    int         `gorm:"not null"`
+	UnitPrice   utils.Money `gorm:"type:decimal(10,2);not null"`
+	TaxRate     float64     `gorm:"type:numeric(6,4);default:0;not null"`
+	TaxAmount   utils.Money `gorm:"type:decimal(10,2);default:0;not null"`
+	Total       utils.Money `gorm:"type:decimal(10,2);not null"` // UnitPrice times Quantity
+}
+
+// InvoiceSequence hands out invoice numbers. The row is locked while a number is taken so
+// numbers are only used by committed invoices and never skip.
+type InvoiceSequence struct {
+	Name       string `gorm:"primaryKey;size:20"` // invoice or credit_note
+	Prefix     string `gorm:"size:10;not null"`
+	NextNumber int64  `gorm:"not null;default:1"`
+}
+
+// InvoiceSetting holds the seller details printed on invoices, a single row
+type InvoiceSetting struct {
+	ID          uint      `gorm:"primaryKey"`
+	CompanyName string    `gorm:"size:150;not null;default:''"`
+	Address     string    `gorm:"type:text"`
+	TaxNumber   string    `gorm:"size:50"`
+	Email       string    `gorm:"size:100"`
+	Footer      string    `gorm:"type:text"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// LoyaltySetting holds the store wide loyalty configuration, a single row
+type LoyaltySetting struct {
+	ID              uint      `gorm:"primaryKey"`
+	IsActive        bool      `gorm:"default:false"`
+	EarnRate        float64   `gorm:"type:numeric(10,4);default:1;not null"`    // Points earned per currency unit spent
+	RedemptionValue float64   `gorm:"type:numeric(10,4);default:0.01;not null"` // Currency value of a single point
+	MinRedeemPoints int       `gorm:"default:0;not null"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+// LoyaltyCategoryMultiplier boosts the points earned on products of a category and its sub categories
+type LoyaltyCategoryMultiplier struct {
+	ID         uint     `gorm:"primaryKey"`
+	CategoryID uint     `gorm:"not null;unique"`
+	Category   Category `gorm:"foreignKey:CategoryID" json:"-"`
+	Multiplier float64  `gorm:"type:numeric(6,2);default:1;not null"`
+}
+
+// LoyaltyAccount holds the current points balance of a customer
+type LoyaltyAccount struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;unique"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	Balance   int       `gorm:"default:0;not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// LoyaltyTransaction is a ledger entry for every change to a customer's points.
+// Points are positive when added to the balance and negative when taken away.
+type LoyaltyTransaction struct {
+	ID              uint      `gorm:"primaryKey"`
+	UserID          uint      `gorm:"not null;index"`
+	User            User      `gorm:"foreignKey:UserID" json:"-"`
+	OrderID         *uint     `gorm:"index"`
+	TransactionType string    `gorm:"size:20;not null;check:transaction_type IN ('earn', 'redeem', 'earn_reversal', 'redeem_reversal', 'adjust')"`
+	Points          int       `gorm:"not null"`
+	BalanceAfter    int       `gorm:"not null"`
+	Reason          string    `gorm:"type:text"`
+	CreatedBy       *uint     // Admin who adjusted the balance
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
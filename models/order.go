@@ -8,19 +8,32 @@ import (
 
 type Order struct {
 	gorm.Model
-	OrderIdentifier      string      `gorm:"type:varchar(8); not null;unique;index"`
-	UserID               uint        `gorm:"not null"`
-	User                 User        `gorm:"foreignKey:UserID"`
-	OrderStatus          string      `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled', 'cash_on_delivery')"`
-	Currency             *string     `gorm:"size:3; not null"`
-	TotalPrice           float64     `gorm:"type:decimal(10,2);not null"`
-	ItemPrice            float64     `gorm:"type:decimal(10,2);not null"`
-	DiscountAmount       float64     `gorm:"type:decimal(10,2);default:0;not null"`
-	ShippingCost         float64     `gorm:"type:decimal(10,2);default:0;not null"`
-	OrderItems           []OrderItem `gorm:"foreignKey:OrderID"`
-	OrderShippingAddress string      `gorm:"type:text"`
-	PaymentDetails       *Payment    `gorm:"-"`
-	Coupon               string      `gorm:"-"`
+	OrderIdentifier      string           `gorm:"type:varchar(8); not null;unique;index"`
+	UserID               uint             `gorm:"not null"`
+	User                 User             `gorm:"foreignKey:UserID"`
+	OrderStatus          string           `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled', 'cash_on_delivery')"`
+	Currency             *string          `gorm:"size:3; not null"`
+	ExchangeRate         float64          `gorm:"type:numeric(18,8);default:1;not null"` // Units of Currency per unit of BaseCurrency at purchase
+	BaseCurrency         string           `gorm:"size:3"`
+	TotalPrice           utils.Money      `gorm:"type:decimal(10,2);not null"`
+	ItemPrice            utils.Money      `gorm:"type:decimal(10,2);not null"`
+	DiscountAmount       utils.Money      `gorm:"type:decimal(10,2);default:0;not null"`
+	ShippingCost         utils.Money      `gorm:"type:decimal(10,2);default:0;not null"`
+	TaxAmount            utils.Money      `gorm:"type:decimal(10,2);default:0;not null"` // Tax on items and shipping
+	ShippingTax          utils.Money      `gorm:"type:decimal(10,2);default:0;not null"`
+	PricesIncludeTax     bool             `gorm:"default:false"`
+	ShippingCountry      string           `gorm:"size:100"`
+	ShippingRegion       string           `gorm:"size:100"`
+	PointsRedeemed       int              `gorm:"default:0;not null"`
+	OrderItems           []OrderItem      `gorm:"foreignKey:OrderID"`
+	OrderShippingAddress string           `gorm:"type:text"`
+	PaymentDetails       *Payment         `gorm:"-"`
+	Coupon               string           `gorm:"-"`
+	GiftCardCode         string           `gorm:"-"`
+	UseStoreCredit       bool             `gorm:"-"`
+	RedeemPoints         int              `gorm:"-"`
+	Promotions           []OrderPromotion `gorm:"foreignKey:OrderID"`
+	TaxLines             []OrderTaxLine   `gorm:"foreignKey:OrderID"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
@@ -1,11 +1,17 @@
 package models
 
+import "backend/utils"
+
 type OrderItem struct {
 	ID              uint    `gorm:"primaryKey"`
 	OrderID         uint    `gorm:"not null"`
 	Order           Order   `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
 	ProductID       uint    `gorm:"not null"`
 	Product         Product `gorm:"foreignKey:ProductID"`
-	Quantity        int     `gorm:"not null"`
-	PriceAtPurchase float64 `gorm:"type:decimal(10,2);not null"`
+	VariantID       *uint
+	Variant         *ProductVariant `gorm:"foreignKey:VariantID"`
+	Quantity        int             `gorm:"not null"`
+	PriceAtPurchase utils.Money     `gorm:"type:decimal(10,2);not null"`
+	TaxRate         float64         `gorm:"type:numeric(6,4);default:0;not null"`
+	TaxAmount       utils.Money     `gorm:"type:decimal(10,2);default:0;not null"`
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/utils"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,10 +9,10 @@ import (
 
 type Payment struct {
 	gorm.Model
-	PaymentMethod  string  `gorm:"size:50;not null;check:payment_method IN ('cash_on_delivery', 'paypal')"`
-	PaymentStatus  string  `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed')"`
-	Amount         float64 `gorm:"type:decimal(10,2);not null"`
-	TransanctionID *string `gorm:"size:11;not null"`
+	PaymentMethod  string      `gorm:"size:50;not null;check:payment_method IN ('cash_on_delivery', 'paypal', 'gift_card', 'store_credit')"`
+	PaymentStatus  string      `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed', 'refunded')"`
+	Amount         utils.Money `gorm:"type:decimal(10,2);not null"`
+	TransanctionID *string     `gorm:"size:11;not null"`
 	PaymentDate    *time.Time
 	OrderID        uint  `gorm:"not null"`
 	Order          Order `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
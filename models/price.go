@@ -0,0 +1,35 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+)
+
+// PriceHistory is an audit entry written every time one of a product's prices changes
+type PriceHistory struct {
+	ID        uint         `gorm:"primaryKey"`
+	ProductID uint         `gorm:"not null;index"`
+	Product   Product      `gorm:"foreignKey:ProductID" json:"-"`
+	PriceType string       `gorm:"size:20;not null;check:price_type IN ('price', 'sale_price', 'compare_at_price')"`
+	OldPrice  *utils.Money `gorm:"type:decimal(10,2)"`
+	NewPrice  *utils.Money `gorm:"type:decimal(10,2)"`
+	Source    string       `gorm:"size:20;not null;check:source IN ('manual', 'schedule', 'import')"`
+	ChangedBy *uint        // User who made the change, empty for scheduled changes
+	User      *User        `gorm:"foreignKey:ChangedBy" json:"-"`
+	ChangedAt time.Time    `gorm:"autoCreateTime"`
+}
+
+// PriceSchedule is a price change that is applied to the product at EffectiveAt
+type PriceSchedule struct {
+	ID          uint        `gorm:"primaryKey"`
+	ProductID   uint        `gorm:"not null;index"`
+	Product     Product     `gorm:"foreignKey:ProductID" json:"-"`
+	Price       utils.Money `gorm:"type:decimal(10,2);not null"`
+	EffectiveAt time.Time   `gorm:"not null;index"`
+	AppliedAt   *time.Time  // Set once the scheduler has applied the change, or given up on it
+	// FailureReason is why the scheduler gave up on the change, empty when it was applied
+	FailureReason string    `gorm:"size:300;not null;default:''"`
+	CreatedBy     uint      `gorm:"not null"`
+	User          User      `gorm:"foreignKey:CreatedBy" json:"-"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
@@ -2,56 +2,119 @@ package models
 
 import (
 	"backend/utils"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type Product struct {
 	gorm.Model
-	Name        string   `gorm:"size:150;not null"`
-	Description string   `gorm:"type:text"`
-	SKU         string   `gorm:"size:150;not null;unique;index"`
-	Barcode     *string  `gorm:"size:150"`
-	Price       float64  `gorm:"type:decimal(10,2);not null"`
-	Currency    string   `gorm:"size:3; not null"`
-	CategoryID  uint     `gorm:"not null"`
-	Category    Category `gorm:"foreignKey:CategoryID"`
-	Status      *string  `gorm:"not null;check:status IN ('published', 'unpublished')"`
-	Featured    bool     `gorm:"default:false"`
-	Stock       uint     `gorm:"-"`
-	IsChild     bool     `gorm:"default:false"`
+	Name        string `gorm:"size:150;not null"`
+	Description string `gorm:"type:text"`
+	SKU         string `gorm:"size:150;not null;unique;index"`
+	// Slug addresses the product in storefront URLs, generated from the name when left empty
+	Slug            string      `gorm:"size:200;not null;default:'';uniqueIndex:idx_products_slug,where:slug <> ''"`
+	MetaTitle       string      `gorm:"size:150"` // Title of the product page, the name when empty
+	MetaDescription string      `gorm:"size:320"`
+	Barcode         *string     `gorm:"size:150"`
+	Price           utils.Money `gorm:"type:decimal(10,2);not null"`
+	Currency        string      `gorm:"size:3; not null"`
+	// CompareAtPrice is the "was" price shown next to a lower selling price
+	CompareAtPrice *utils.Money `gorm:"type:decimal(10,2)"`
+	// SalePrice replaces Price between SaleStartDate and SaleEndDate
+	SalePrice     *utils.Money `gorm:"type:decimal(10,2)"`
+	SaleStartDate *time.Time
+	SaleEndDate   *time.Time
+	CategoryID    uint     `gorm:"not null"`
+	Category      Category `gorm:"foreignKey:CategoryID"`
+	Status        *string  `gorm:"not null;check:status IN ('published', 'unpublished')"`
+	// PublishAt and UnpublishAt are when the scheduler changes the status, cleared once done
+	PublishAt   *time.Time `gorm:"index"`
+	UnpublishAt *time.Time `gorm:"index"`
+	Featured    bool       `gorm:"default:false"`
+	Stock       uint       `gorm:"-"`
+	IsChild     bool       `gorm:"default:false"` // Variations used to be child products, see ProductVariant
 	ParentID    *uint
 	Color       string
 	Size        string
 	BrandID     *uint
-	Brand       Brand          `gorm:"foreignKey:BrandID;refrences:BrandID"`
-	Images      []ProductImage `gorm:"foreignKey:ProductID"`
-	Inventory   *Inventory     `gorm:"foreignKey:ProductID;references:ID"`
+	Brand       Brand `gorm:"foreignKey:BrandID;refrences:BrandID"`
+	TaxClassID  *uint
+	TaxClass    *TaxClass        `gorm:"foreignKey:TaxClassID" json:"-"`
+	Images      []ProductImage   `gorm:"foreignKey:ProductID"`
+	Inventory   *Inventory       `gorm:"foreignKey:ProductID;references:ID"` // Stock of a product without variants
+	Variants    []ProductVariant `gorm:"foreignKey:ProductID" json:",omitempty"`
+	// Options are the dimensions the variations of a parent product vary in
+	Options []ProductOption `gorm:"foreignKey:ProductID" json:",omitempty"`
+	// OptionValues are the option values of a variation stored as a child product
+	OptionValues []ProductOptionValue `gorm:"many2many:product_variant_values;joinForeignKey:ProductID;joinReferences:OptionValueID" json:",omitempty"`
+	Tags         []Tag                `gorm:"many2many:product_tags;joinForeignKey:ProductID;joinReferences:TagID" json:",omitempty"`
+	// SearchVector is the weighted search document, maintained by services.RefreshSearchIndex
+	SearchVector string `gorm:"type:tsvector;->:false;<-:false" json:"-"`
 }
 
-type ProductImage struct {
-	ID         uint    `gorm:"primaryKey"`
-	ProductID  uint    // Foreign key to the Product
-	Product    Product `gorm:"foreignKey:ProductID" json:"-"`
-	Color      *string
-	Image      string `gorm:"-" json:"Image"`
-	ImageBytes []byte `gorm:"column:image;type:bytea" json:"-"`
+func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
+	text := p.Slug
+	if text == "" {
+		text = p.Name
+	}
+	p.Slug, err = UniqueSlug(tx, "products", "slug", text, 0)
+	return err
 }
 
-func (c *ProductImage) BeforeCreate(tx *gorm.DB) (err error) {
-
-	bt, err := utils.DecodeBase64Image(c.Image)
-	if err != nil {
-		return err
+// EffectivePrice returns the price the product sells for at the given time
+func (p *Product) EffectivePrice(at time.Time) utils.Money {
+	if p.OnSale(at) {
+		return *p.SalePrice
 	}
+	return p.Price
+}
 
-	c.ImageBytes = bt
+// OnSale reports whether the sale price is active at the given time
+func (p *Product) OnSale(at time.Time) bool {
+	if p.SalePrice == nil {
+		return false
+	}
+	if p.SaleStartDate != nil && at.Before(*p.SaleStartDate) {
+		return false
+	}
+	if p.SaleEndDate != nil && !at.Before(*p.SaleEndDate) {
+		return false
+	}
+	return true
+}
 
-	return nil
+type ProductImage struct {
+	ID        uint    `gorm:"primaryKey"`
+	ProductID uint    `gorm:"uniqueIndex:idx_product_images_primary,where:is_primary;uniqueIndex:idx_product_images_color_primary,where:is_color_primary"`
+	Product   Product `gorm:"foreignKey:ProductID" json:"-"`
+	Color     *string `gorm:"uniqueIndex:idx_product_images_color_primary,where:is_color_primary"`
+	// OptionValueID ties the image to an option value, such as the pictures of one color
+	OptionValueID *uint
+	VariantID     *uint  // Set for images of a single variant
+	SourceURL     string `gorm:"size:1000"`          // Where an imported image was downloaded from
+	Position      int    `gorm:"not null;default:0"` // Sort order among the images of the product
+	// IsPrimary marks the cover of the product, shown in listings. Without one the first image is the cover.
+	IsPrimary bool `gorm:"not null;default:false"`
+	// IsColorPrimary marks the image shown for its color, such as on a color swatch
+	IsColorPrimary bool `gorm:"not null;default:false"`
+	StoredImage
+}
 
+func (c *ProductImage) BeforeCreate(tx *gorm.DB) (err error) {
+	image, err := c.upload(tx)
+	if image != nil {
+		if c.Color == nil {
+			c.Color = image.Color
+		}
+		if c.Position == 0 {
+			c.Position = image.Position
+		}
+	}
+	return err
 }
 func (c *ProductImage) AfterFind(tx *gorm.DB) (err error) {
-	c.Image = utils.EncodeImageToBase64(c.ImageBytes)
+	c.resolve()
 
 	return nil
 
@@ -65,14 +128,24 @@ type ProductAttribute struct {
 	Product     Product `gorm:"foreignKey:ProductID"`
 }
 
+// UniqueColors picks one image per color, the primary image of the color or else the first by
+// position, in the order the colors first appear
 func UniqueColors(images []ProductImage) []ProductImage {
-	seen := make(map[string]bool)
+	seen := make(map[string]int)
 	var result []ProductImage
 
 	for _, img := range images {
-		if !seen[*img.Color] {
-			seen[*img.Color] = true
+		if img.Color == nil {
+			continue
+		}
+		i, ok := seen[*img.Color]
+		if !ok {
+			seen[*img.Color] = len(result)
 			result = append(result, img)
+			continue
+		}
+		if !result[i].IsColorPrimary && (img.IsColorPrimary || img.Position < result[i].Position) {
+			result[i] = img
 		}
 	}
 	return result
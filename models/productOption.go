@@ -0,0 +1,27 @@
+package models
+
+// ProductOption is a dimension a product varies in, such as color, size, fabric, fit or length
+type ProductOption struct {
+	ID        uint                 `gorm:"primaryKey"`
+	ProductID uint                 `gorm:"not null;index;uniqueIndex:idx_product_option_name"`
+	Product   Product              `gorm:"foreignKey:ProductID" json:"-"`
+	Name      string               `gorm:"size:50;not null;uniqueIndex:idx_product_option_name"`
+	Position  int                  `gorm:"not null;default:0"`
+	Values    []ProductOptionValue `gorm:"foreignKey:OptionID;constraint:OnDelete:CASCADE"`
+}
+
+// ProductOptionValue is one of the ordered values of an option
+type ProductOptionValue struct {
+	ID       uint           `gorm:"primaryKey"`
+	OptionID uint           `gorm:"not null;index;uniqueIndex:idx_option_value"`
+	Option   *ProductOption `gorm:"foreignKey:OptionID" json:",omitempty"`
+	Value    string         `gorm:"size:100;not null;uniqueIndex:idx_option_value"`
+	Position int            `gorm:"not null;default:0"`
+}
+
+// ProductVariantValue links a variation stored as a child product to its option values. It is
+// only read when child products are migrated to variants.
+type ProductVariantValue struct {
+	ProductID     uint `gorm:"primaryKey"`
+	OptionValueID uint `gorm:"primaryKey"`
+}
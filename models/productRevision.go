@@ -0,0 +1,124 @@
+package models
+
+import (
+	"backend/utils"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProductContent is what editors change about a product, kept by drafts and revisions. The status
+// is not part of it, publishing is scheduled separately.
+type ProductContent struct {
+	Name            string `binding:"required"`
+	Description     string
+	SKU             string `binding:"required"`
+	Slug            string
+	MetaTitle       string
+	MetaDescription string
+	Barcode         *string
+	Price           utils.Money `binding:"gt=0"`
+	Currency        string      `binding:"required,len=3"`
+	CompareAtPrice  *utils.Money
+	SalePrice       *utils.Money
+	SaleStartDate   *time.Time
+	SaleEndDate     *time.Time
+	CategoryID      uint `binding:"required"`
+	BrandID         *uint
+	TaxClassID      *uint
+	Featured        bool
+}
+
+// ContentOf returns the content of a product
+func ContentOf(p Product) ProductContent {
+	return ProductContent{
+		Name:            p.Name,
+		Description:     p.Description,
+		SKU:             p.SKU,
+		Slug:            p.Slug,
+		MetaTitle:       p.MetaTitle,
+		MetaDescription: p.MetaDescription,
+		Barcode:         p.Barcode,
+		Price:           p.Price,
+		Currency:        p.Currency,
+		CompareAtPrice:  p.CompareAtPrice,
+		SalePrice:       p.SalePrice,
+		SaleStartDate:   p.SaleStartDate,
+		SaleEndDate:     p.SaleEndDate,
+		CategoryID:      p.CategoryID,
+		BrandID:         p.BrandID,
+		TaxClassID:      p.TaxClassID,
+		Featured:        p.Featured,
+	}
+}
+
+// ApplyTo replaces the content of a product, the slug included. Callers changing the slug
+// redirect the old one, see services.ChangeSlug.
+func (c ProductContent) ApplyTo(p *Product) {
+	p.Name = c.Name
+	p.Description = c.Description
+	p.SKU = c.SKU
+	p.Slug = c.Slug
+	p.MetaTitle = c.MetaTitle
+	p.MetaDescription = c.MetaDescription
+	p.Barcode = c.Barcode
+	p.Price = c.Price
+	p.Currency = c.Currency
+	p.CompareAtPrice = c.CompareAtPrice
+	p.SalePrice = c.SalePrice
+	p.SaleStartDate = c.SaleStartDate
+	p.SaleEndDate = c.SaleEndDate
+	p.CategoryID = c.CategoryID
+	p.BrandID = c.BrandID
+	p.TaxClassID = c.TaxClassID
+	p.Featured = c.Featured
+}
+
+func (c ProductContent) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+func (c *ProductContent) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string:
+		return json.Unmarshal([]byte(data), c)
+	}
+	return fmt.Errorf("cannot scan %T into product content", value)
+}
+
+// ProductDraft is the next version of a product, edited without changing the live product until
+// it is published
+type ProductDraft struct {
+	ID        uint           `gorm:"primaryKey"`
+	ProductID uint           `gorm:"not null;uniqueIndex"`
+	Product   Product        `gorm:"foreignKey:ProductID" json:"-"`
+	Content   ProductContent `gorm:"type:jsonb;not null"`
+	// BaseRevision is the revision the draft was started from, the live product changed meanwhile
+	// when it is no longer the latest
+	BaseRevision int        `gorm:"not null;default:0"`
+	PublishAt    *time.Time `gorm:"index"` // Set to have the scheduler publish the draft
+	UpdatedBy    uint       `gorm:"not null"`
+	User         User       `gorm:"foreignKey:UpdatedBy" json:"-"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ProductRevision is the content of a product after one of its changes. Revisions are numbered
+// from 1 for every product.
+type ProductRevision struct {
+	ID        uint           `gorm:"primaryKey"`
+	ProductID uint           `gorm:"not null;uniqueIndex:idx_product_revisions_number"`
+	Product   Product        `gorm:"foreignKey:ProductID" json:"-"`
+	Number    int            `gorm:"not null;uniqueIndex:idx_product_revisions_number"`
+	Content   ProductContent `gorm:"type:jsonb;not null"`
+	// Source is how the product changed. "initial" keeps the content a product had before its
+	// first recorded change.
+	Source    string `gorm:"size:20;not null;check:source IN ('initial', 'create', 'update', 'import', 'draft', 'schedule', 'restore')"`
+	CreatedBy *uint  // User who made the change, empty for scheduled and initial revisions
+	User      *User  `gorm:"foreignKey:CreatedBy" json:"-"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVariant is a sellable combination of option values of a product. Name, description,
+// category, brand and tax class always come from the product; a variant only stores what
+// differs per combination.
+type ProductVariant struct {
+	gorm.Model
+	ProductID uint         `gorm:"not null;index"`
+	Product   Product      `gorm:"foreignKey:ProductID" json:"-"`
+	SKU       string       `gorm:"size:150;not null;unique;index"`
+	Barcode   *string      `gorm:"size:150"`
+	Price     *utils.Money `gorm:"type:decimal(10,2)"` // Overrides the price of the product
+	// SalePrice replaces the price of the variant between SaleStartDate and SaleEndDate
+	SalePrice     *utils.Money `gorm:"type:decimal(10,2)"`
+	SaleStartDate *time.Time
+	SaleEndDate   *time.Time
+	Weight        *float64             `gorm:"type:numeric(10,3)"` // In kilograms
+	Position      int                  `gorm:"not null;default:0"`
+	Images        []ProductImage       `gorm:"foreignKey:VariantID"`
+	Inventory     *Inventory           `gorm:"foreignKey:VariantID"`
+	Values        []ProductOptionValue `gorm:"many2many:variant_option_values;joinForeignKey:VariantID;joinReferences:OptionValueID" json:"Options"`
+	// LegacyProductID is the child product row the variant was migrated from
+	LegacyProductID *uint `gorm:"index" json:"-"`
+}
+
+// EffectivePrice returns the price the variant sells for at the given time. A running sale of
+// the product wins over the sale and the price override of the variant.
+func (v *ProductVariant) EffectivePrice(product Product, at time.Time) utils.Money {
+	if product.OnSale(at) {
+		return product.EffectivePrice(at)
+	}
+	if v.OnSale(at) {
+		return *v.SalePrice
+	}
+	if v.Price == nil {
+		return product.EffectivePrice(at)
+	}
+	return *v.Price
+}
+
+// OnSale reports whether the sale price of the variant is active at the given time
+func (v *ProductVariant) OnSale(at time.Time) bool {
+	return (&Product{SalePrice: v.SalePrice, SaleStartDate: v.SaleStartDate, SaleEndDate: v.SaleEndDate}).OnSale(at)
+}
+
+// VariantOptionValue links a variant to the option values it is a combination of
+type VariantOptionValue struct {
+	VariantID     uint `gorm:"primaryKey"`
+	OptionValueID uint `gorm:"primaryKey"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"backend/utils"
+	"testing"
+	"time"
+)
+
+func TestVariantEffectivePrice(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	money := func(v utils.Money) *utils.Money { return &v }
+
+	product := Product{Price: 1000}
+	onSale := Product{Price: 1000, SalePrice: money(700)}
+
+	tests := []struct {
+		name    string
+		product Product
+		variant ProductVariant
+		want    utils.Money
+	}{
+		{"product price", product, ProductVariant{}, 1000},
+		{"price override", product, ProductVariant{Price: money(1200)}, 1200},
+		{"variant sale", product, ProductVariant{Price: money(1200), SalePrice: money(900)}, 900},
+		{"variant sale not started", product, ProductVariant{Price: money(1200), SalePrice: money(900), SaleStartDate: &future}, 1200},
+		{"variant sale ended", product, ProductVariant{SalePrice: money(900), SaleEndDate: &past}, 1000},
+		{"product sale wins", onSale, ProductVariant{Price: money(1200), SalePrice: money(900)}, 700},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.variant.EffectivePrice(test.product, now); got != test.want {
+				t.Errorf("EffectivePrice = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
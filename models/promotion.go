@@ -0,0 +1,91 @@
+package models
+
+import (
+	"backend/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Promotion struct {
+	gorm.Model
+	Name           string    `gorm:"size:150;not null"`
+	Description    string    `gorm:"type:text"`
+	PromotionType  string    `gorm:"size:20;not null;check:promotion_type IN ('buy_x_get_y', 'tiered', 'category', 'bundle')"`
+	Priority       int       `gorm:"default:0;not null"`    // Higher priority promotions are evaluated first
+	Stackable      bool      `gorm:"default:true;not null"` // Non-stackable promotions only apply alone
+	StartDate      time.Time `gorm:"not null"`
+	ExpirationDate *time.Time
+	IsActive       bool `gorm:"default:true"`
+
+	// buy_x_get_y: buy BuyQuantity of BuyProductID, get GetQuantity of GetProductID at GetDiscountPercent off
+	BuyProductID       *uint
+	BuyQuantity        *int
+	GetProductID       *uint // Defaults to BuyProductID when empty
+	GetQuantity        *int
+	GetDiscountPercent *float64 `gorm:"type:numeric(5,2)"` // 100 means the item is free
+
+	// category: DiscountPercent off every item inside CategoryID (and its sub categories)
+	CategoryID      *uint
+	DiscountPercent *float64 `gorm:"type:numeric(5,2)"`
+
+	// bundle: every item of BundleItems together for BundlePrice
+	BundlePrice *utils.Money `gorm:"type:numeric(10,2)"`
+
+	Tiers       []PromotionTier       `gorm:"foreignKey:PromotionID;constraint:OnDelete:CASCADE"`
+	BundleItems []PromotionBundleItem `gorm:"foreignKey:PromotionID;constraint:OnDelete:CASCADE"`
+}
+
+type PromotionTier struct {
+	ID            uint        `gorm:"primaryKey"`
+	PromotionID   uint        `gorm:"not null" json:"-"`
+	MinOrderValue utils.Money `gorm:"type:numeric(10,2);not null"`
+	DiscountType  string      `gorm:"size:20;not null;check:discount_type IN ('percentage', 'fixed')"`
+	DiscountValue utils.Money `gorm:"type:numeric(10,2);not null"`
+}
+
+type PromotionBundleItem struct {
+	ID          uint    `gorm:"primaryKey"`
+	PromotionID uint    `gorm:"not null" json:"-"`
+	ProductID   uint    `gorm:"not null"`
+	Product     Product `gorm:"foreignKey:ProductID" json:"-"`
+	Quantity    int     `gorm:"default:1;not null"`
+}
+
+// OrderPromotion records a promotion that was applied to an order
+type OrderPromotion struct {
+	ID             uint        `gorm:"primaryKey"`
+	OrderID        uint        `gorm:"not null;index"`
+	Order          Order       `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	PromotionID    uint        `gorm:"not null"`
+	Promotion      Promotion   `gorm:"foreignKey:PromotionID" json:"-"`
+	Name           string      `gorm:"size:150;not null"`
+	DiscountAmount utils.Money `gorm:"type:decimal(10,2);not null"`
+	CreatedAt      time.Time   `gorm:"autoCreateTime"`
+}
+
+func (p *Promotion) BeforeSave(tx *gorm.DB) (err error) {
+
+	switch p.PromotionType {
+	case "buy_x_get_y":
+		if p.BuyProductID == nil || p.BuyQuantity == nil || p.GetQuantity == nil {
+			return errors.New("buy_x_get_y promotion requires BuyProductID, BuyQuantity and GetQuantity")
+		}
+	case "tiered":
+		if len(p.Tiers) == 0 && p.ID == 0 {
+			return errors.New("tiered promotion requires at least one tier")
+		}
+	case "category":
+		if p.CategoryID == nil || p.DiscountPercent == nil {
+			return errors.New("category promotion requires CategoryID and DiscountPercent")
+		}
+	case "bundle":
+		if p.BundlePrice == nil || (len(p.BundleItems) == 0 && p.ID == 0) {
+			return errors.New("bundle promotion requires BundlePrice and bundle items")
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ProductRelation links a product to another one recommended with it, picked by hand. Links go
+// one way, at Position in the order they are shown in.
+type ProductRelation struct {
+	ID               uint    `gorm:"primaryKey"`
+	ProductID        uint    `gorm:"not null;uniqueIndex:idx_product_relation"`
+	RelatedProductID uint    `gorm:"not null;uniqueIndex:idx_product_relation;index"`
+	RelatedProduct   Product `gorm:"foreignKey:RelatedProductID" json:"-"`
+	Position         int     `gorm:"not null;default:0"`
+	CreatedAt        time.Time
+}
+
+// ProductCoPurchase counts the orders having bought a product together with another one. The
+// rows are recomputed from the orders by services.ComputeCoPurchases.
+type ProductCoPurchase struct {
+	ProductID        uint `gorm:"primaryKey"`
+	RelatedProductID uint `gorm:"primaryKey"`
+	Orders           int  `gorm:"not null"`
+	// Confidence is the share of the orders of the product that also had the related product
+	Confidence float64   `gorm:"type:numeric(6,4);not null"`
+	ComputedAt time.Time `gorm:"not null"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/utils"
 	"encoding/json"
 
 	"gorm.io/gorm"
@@ -26,7 +27,7 @@ type ShippingOptions struct {
 	ShipperID               *string
 	ShippingCarrier         *string         `gorm:"not null"`
 	ShipFromAddress         json.RawMessage `gorm:"type:jsonb"`
-	ShippingCost            float64         `gorm:"type:decimal(10,2)"`
+	ShippingCost            utils.Money     `gorm:"type:decimal(10,2)"`
 	EstimatedDeliveryDayMin int             `gorm:"type:int"` // Minimum estimated days for delivery
 	EstimatedDeliveryDayMax int             `gorm:"type:int"`
 	PaymentMethod           *string         `gorm:"size:50;not null;check:payment_method IN ('card', 'bkash', 'rocket', 'nagad', 'cash_on_delivery', 'paypal')"`
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"backend/utils"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SlugRedirect sends an old slug of a product, category or brand to the record that used it,
+// so links keep working after a slug is edited
+type SlugRedirect struct {
+	ID         uint   `gorm:"primaryKey"`
+	EntityType string `gorm:"size:20;not null;uniqueIndex:idx_slug_redirect;check:entity_type IN ('product', 'category', 'brand')"`
+	Slug       string `gorm:"size:200;not null;uniqueIndex:idx_slug_redirect"`
+	EntityID   uint   `gorm:"not null;index"`
+	CreatedAt  time.Time
+}
+
+// UniqueSlug derives a slug from text that no other row of the table uses, numbering it when
+// taken. Deleted rows keep their slug, so it is not handed out again.
+func UniqueSlug(tx *gorm.DB, table string, column string, text string, id uint) (string, error) {
+	base := utils.Slugify(text)
+	if base == "" {
+		base = "item"
+	}
+
+	slug := base
+	for n := 2; ; n++ {
+		var count int64
+		if err := tx.Session(&gorm.Session{NewDB: true}).Table(table).
+			Where(column+" = ? AND id <> ?", slug, id).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"backend/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaxClass groups products that are taxed the same way, e.g. standard, reduced or zero rated
+type TaxClass struct {
+	gorm.Model
+	Name        string    `gorm:"size:100;not null;unique"`
+	Description string    `gorm:"type:text"`
+	Rates       []TaxRate `gorm:"foreignKey:TaxClassID"`
+}
+
+// TaxRate is the percentage charged for a tax class in a country, optionally narrowed to a region
+type TaxRate struct {
+	gorm.Model
+	TaxClassID uint     `gorm:"not null;index"`
+	TaxClass   TaxClass `gorm:"foreignKey:TaxClassID" json:"-"`
+	Name       string   `gorm:"size:100;not null"` // Label shown on invoices, e.g. "VAT"
+	Country    string   `gorm:"size:100;not null"`
+	Region     string   `gorm:"size:100;not null;default:''"` // Empty applies to the whole country
+	Rate       float64  `gorm:"type:numeric(6,4);not null;check:rate >= 0"`
+}
+
+// TaxSetting holds the store wide tax configuration, a single row
+type TaxSetting struct {
+	ID                 uint      `gorm:"primaryKey"`
+	PricesIncludeTax   bool      `gorm:"default:false"`
+	DefaultTaxClassID  *uint     // Used for products without a tax class
+	ShippingTaxClassID *uint     // Shipping is untaxed when empty
+	DefaultCountry     string    `gorm:"size:100;not null;default:''"`
+	UpdatedAt          time.Time `gorm:"autoUpdateTime"`
+}
+
+// OrderTaxLine is the tax charged on an order summarised per rate
+type OrderTaxLine struct {
+	ID            uint        `gorm:"primaryKey"`
+	OrderID       uint        `gorm:"not null;index"`
+	Order         Order       `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	Name          string      `gorm:"size:100;not null"`
+	Rate          float64     `gorm:"type:numeric(6,4);not null"`
+	TaxableAmount utils.Money `gorm:"type:decimal(10,2);not null"`
+	TaxAmount     utils.Money `gorm:"type:decimal(10,2);not null"`
+}
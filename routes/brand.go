@@ -12,7 +12,11 @@ func BrandRoutes(router *gin.Engine) {
 	{
 		brands.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.AddBrand)
 		brands.GET("", controllers.GetBrands)
+		brands.GET("/slug/:slug", controllers.GetBrandBySlug)
 		brands.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateBrand)
 		brands.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteBrand)
+		brands.GET("/trash", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetTrashedBrands)
+		brands.POST("/trash/:id/restore/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.RestoreTrashedBrand)
+		brands.DELETE("/trash/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.PurgeBrand)
 	}
 }
@@ -12,6 +12,8 @@ func CartRoutes(router *gin.Engine) {
 	{
 		cartRoutes.POST("/", middlewares.AuthMiddleware(), controllers.CreateShoppingCart)
 		cartRoutes.GET("", middlewares.AuthMiddleware(), controllers.GetShoppingCartByUserID)
+		cartRoutes.GET("/promotions", middlewares.AuthMiddleware(), controllers.GetCartPromotions)
+		cartRoutes.GET("/recommendations", middlewares.AuthMiddleware(), controllers.GetCartRecommendations)
 		cartRoutes.POST("/item/", middlewares.AuthMiddleware(), controllers.AddCartItem)
 		cartRoutes.PUT("/item/:id/", middlewares.AuthMiddleware(), controllers.UpdateCartItem)
 		cartRoutes.DELETE("/item/:id/", middlewares.AuthMiddleware(), controllers.RemoveCartItem)
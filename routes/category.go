@@ -14,8 +14,15 @@ func CategoryRoutes(router *gin.Engine) {
 		categories.GET("", controllers.GetCategories)
 		categories.GET("/all", controllers.GetNestedCategories)
 		categories.GET("/sub-category/:parent_id", controllers.GetSubCategories)
+		categories.GET("/slug/:slug", controllers.GetCategoryBySlug)
 		categories.GET("/:id", controllers.GetCategory)
+		categories.GET("/:id/breadcrumbs", controllers.GetCategoryBreadcrumbs)
+		categories.PUT("/:id/move/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.MoveCategory)
+		categories.PUT("/order/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.ReorderCategories)
 		categories.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateCategory)
 		categories.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteCategory)
+		categories.GET("/trash", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetTrashedCategories)
+		categories.POST("/trash/:id/restore/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.RestoreTrashedCategory)
+		categories.DELETE("/trash/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.PurgeCategory)
 	}
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CollectionRoutes(router *gin.Engine) {
+	collections := router.Group("/api/collections")
+	{
+		collections.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateCollection)
+		collections.GET("", controllers.GetCollections)
+		collections.GET("/all", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetAllCollections)
+		collections.GET("/slug/:slug", controllers.GetCollectionBySlug)
+		collections.GET("/slug/:slug/products", controllers.GetCollectionProducts)
+		collections.GET("/:id", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetCollection)
+		collections.GET("/:id/products", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.PreviewCollectionProducts)
+		collections.PUT("/:id/products/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetCollectionProducts)
+		collections.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateCollection)
+		collections.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteCollection)
+	}
+}
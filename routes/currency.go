@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CurrencyRoutes(router *gin.Engine) {
+	currencies := router.Group("/api/currencies")
+	{
+		currencies.GET("", controllers.GetCurrencies)
+		currencies.PUT("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetCurrency)
+		currencies.DELETE("/:code/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteCurrency)
+		currencies.PUT("/settings/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateCurrencySettings)
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GiftCardRoutes(router *gin.Engine) {
+	giftCards := router.Group("/api/gift-cards")
+	{
+		giftCards.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.IssueGiftCard)
+		giftCards.POST("/purchase/", middlewares.AuthMiddleware(), controllers.PurchaseGiftCard)
+		giftCards.GET("", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetGiftCards)
+		giftCards.GET("/balance/:code", middlewares.AuthMiddleware(), controllers.CheckGiftCardBalance)
+		giftCards.GET("/:id", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetGiftCard)
+		giftCards.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateGiftCard)
+		giftCards.POST("/:id/adjust/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.AdjustGiftCardBalance)
+	}
+
+	storeCredit := router.Group("/api/store-credit")
+	{
+		storeCredit.GET("", middlewares.AuthMiddleware(), controllers.GetMyStoreCredit)
+		storeCredit.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.AdjustCustomerStoreCredit)
+		storeCredit.GET("/user/:user_id", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetCustomerStoreCredit)
+	}
+}
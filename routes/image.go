@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ImageRoutes(router *gin.Engine) {
+	images := router.Group("/api/images")
+	{
+		images.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UploadImages)
+		images.GET("/:id", controllers.GetImage)
+		images.HEAD("/:id", controllers.GetImage)
+		images.GET("/:id/:rendition", controllers.GetImage)
+		images.HEAD("/:id/:rendition", controllers.GetImage)
+	}
+}
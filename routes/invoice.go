@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InvoiceRoutes(router *gin.Engine) {
+	invoices := router.Group("/api/invoices")
+	{
+		invoices.GET("/settings", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetInvoiceSettings)
+		invoices.PUT("/settings/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateInvoiceSettings)
+		invoices.GET("/:id", middlewares.AuthMiddleware(), controllers.GetInvoiceDocument)
+	}
+}
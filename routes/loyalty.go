@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LoyaltyRoutes(router *gin.Engine) {
+	loyalty := router.Group("/api/loyalty")
+	{
+		loyalty.GET("", middlewares.AuthMiddleware(), controllers.GetMyLoyaltyPoints)
+		loyalty.GET("/settings", controllers.GetLoyaltySettings)
+		loyalty.PUT("/settings/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateLoyaltySettings)
+		loyalty.PUT("/multipliers/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetLoyaltyMultiplier)
+		loyalty.DELETE("/multipliers/:category_id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteLoyaltyMultiplier)
+		loyalty.POST("/adjust/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.AdjustLoyaltyPoints)
+		loyalty.GET("/user/:user_id", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetCustomerLoyaltyPoints)
+	}
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"backend/storage"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaRoutes serves the files of a local blob store. Other stores are downloaded from directly.
+func MediaRoutes(router *gin.Engine) {
+	if local, ok := storage.Default.(*storage.LocalStore); ok && strings.HasPrefix(local.BaseURL, "/") {
+		router.Static(local.BaseURL, local.Dir)
+	}
+}
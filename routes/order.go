@@ -16,6 +16,10 @@ func OrderRoutes(router *gin.Engine) {
 		orders.PUT("/dispatch/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DispatchOrder)
 		orders.PUT("/cancel/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CancelOrder)
 		orders.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateOrderStatus)
+		orders.GET("/:id/invoice", middlewares.AuthMiddleware(), controllers.GetOrderInvoice)
+		orders.GET("/:id/invoices", middlewares.AuthMiddleware(), controllers.GetOrderInvoices)
+		orders.POST("/:id/credit-notes/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateCreditNote)
+		orders.POST("/packing-slips/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetPackingSlips)
 	}
 	shipping := router.Group("/api/shipping")
 	{
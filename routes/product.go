@@ -11,16 +11,46 @@ func ProductRoutes(router *gin.Engine) {
 	products := router.Group("/api/products")
 	{
 		products.GET("/search", controllers.SearchProducts)
+		products.GET("/facets", controllers.GetProductFacets)
 		products.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateProduct)
 		products.POST("/variation/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateVariation)
+		products.POST("/import/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.ImportProducts)
+		products.GET("/export", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.ExportProducts)
 		products.GET("", controllers.GetProducts)
+		products.GET("/slug/:slug", controllers.GetProductBySlug)
 		products.GET("/:id", controllers.GetSingleProductV2)
+		products.GET("/trash", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetTrashedProducts)
+		products.POST("/trash/:id/restore/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.RestoreTrashedProduct)
+		products.DELETE("/trash/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.PurgeProduct)
 		products.GET("/new-arrival", controllers.GetNewArrivalProducts)
 		products.GET("/trending", controllers.GetTrendingProducts)
 		products.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateProduct)
 		products.PUT("/variation/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateVariation)
 		products.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteProduct)
 		products.DELETE("/variation/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteVariation)
+		products.POST("/:id/price-schedules/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreatePriceSchedule)
+		products.GET("/:id/price-schedules", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetPriceSchedules)
+		products.DELETE("/price-schedules/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeletePriceSchedule)
+		products.GET("/:id/images", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetProductGallery)
+		products.POST("/:id/images/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.AddProductImages)
+		products.PUT("/:id/images/order/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.ReorderProductImages)
+		products.PUT("/:id/images/:image_id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateProductImage)
+		products.DELETE("/:id/images/:image_id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteProductImage)
+		products.PUT("/:id/tags/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetProductTags)
+		products.GET("/:id/related", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetRelatedProducts)
+		products.PUT("/:id/related/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetRelatedProducts)
+		products.GET("/:id/draft", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetProductDraft)
+		products.PUT("/:id/draft/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SaveProductDraft)
+		products.DELETE("/:id/draft/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteProductDraft)
+		products.POST("/:id/draft/publish/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.PublishProductDraft)
+		products.PUT("/:id/schedule/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.ScheduleProduct)
+		products.GET("/:id/revisions", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetProductRevisions)
+		products.GET("/:id/revisions/:number", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetProductRevision)
+		products.POST("/:id/revisions/:number/restore/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.RestoreProductRevision)
+		products.GET("/:id/price-history", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetPriceHistory)
+		products.GET("/:id/prices", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetProductPrices)
+		products.PUT("/:id/prices/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.SetProductPrice)
+		products.DELETE("/:id/prices/:currency/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteProductPrice)
 	}
 
 	productAttributes := router.Group("/api/product-attributes")
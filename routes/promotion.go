@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PromotionRoutes(router *gin.Engine) {
+	promotion := router.Group("/api/promotions")
+	{
+		promotion.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreatePromotion)
+		promotion.GET("", controllers.GetPromotions)
+		promotion.GET("/:id", controllers.GetPromotion)
+		promotion.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdatePromotion)
+		promotion.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeletePromotion)
+	}
+}
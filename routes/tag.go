@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TagRoutes(router *gin.Engine) {
+	tags := router.Group("/api/tags")
+	{
+		tags.POST("/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateTag)
+		tags.GET("", controllers.GetTags)
+		tags.GET("/slug/:slug/products", controllers.GetTagProducts)
+		tags.PUT("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateTag)
+		tags.DELETE("/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteTag)
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TaxRoutes(router *gin.Engine) {
+	tax := router.Group("/api/tax")
+	{
+		tax.GET("/classes", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetTaxClasses)
+		tax.POST("/classes/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateTaxClass)
+		tax.PUT("/classes/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateTaxClass)
+		tax.DELETE("/classes/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteTaxClass)
+		tax.GET("/rates", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.GetTaxRates)
+		tax.POST("/rates/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.CreateTaxRate)
+		tax.PUT("/rates/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateTaxRate)
+		tax.DELETE("/rates/:id/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.DeleteTaxRate)
+		tax.GET("/settings", controllers.GetTaxSettings)
+		tax.PUT("/settings/", middlewares.AuthMiddleware(), middlewares.CheckIfAdmin(), controllers.UpdateTaxSettings)
+		tax.POST("/estimate/", controllers.EstimateCartTax)
+	}
+}
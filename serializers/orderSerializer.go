@@ -1,6 +1,7 @@
 package serializers
 
 import (
+	"backend/utils"
 	"time"
 
 	"gopkg.in/guregu/null.v4"
@@ -16,12 +17,12 @@ type User struct {
 
 type Product struct {
 	gorm.Model
-	Name        string  `gorm:"size:150;not null"`
-	Description string  `gorm:"type:text"`
-	SKU         string  `gorm:"size:150;not null;unique;index"`
-	Barcode     *string `gorm:"size:150"`
-	Price       float64 `gorm:"not null"`
-	Currency    string  `gorm:"size:3; not null"`
+	Name        string      `gorm:"size:150;not null"`
+	Description string      `gorm:"type:text"`
+	SKU         string      `gorm:"size:150;not null;unique;index"`
+	Barcode     *string     `gorm:"size:150"`
+	Price       utils.Money `gorm:"not null"`
+	Currency    string      `gorm:"size:3; not null"`
 	Color       string
 	Size        string
 }
@@ -32,16 +33,32 @@ type OrderItem struct {
 	Order           OrderResponse `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
 	ProductID       uint          `gorm:"not null" json:"-"`
 	Product         Product       `gorm:"foreignKey:ProductID"`
-	Quantity        int           `gorm:"not null"`
-	PriceAtPurchase float64       `gorm:"not null"`
+	VariantID       *uint
+	Variant         *ProductVariant `gorm:"foreignKey:VariantID"`
+	Quantity        int             `gorm:"not null"`
+	PriceAtPurchase utils.Money     `gorm:"not null"`
+	TaxRate         float64
+	TaxAmount       utils.Money
+}
+
+type ProductVariant struct {
+	ID     uint                 `gorm:"primarykey"`
+	SKU    string               `gorm:"size:150;not null"`
+	Values []ProductOptionValue `gorm:"many2many:variant_option_values;joinForeignKey:VariantID;joinReferences:OptionValueID" json:"Options"`
+}
+
+type ProductOptionValue struct {
+	ID       uint   `gorm:"primarykey"`
+	OptionID uint   `json:"-"`
+	Value    string `gorm:"size:100;not null"`
 }
 
 type Payment struct {
-	ID             uint    `gorm:"primarykey"`
-	PaymentMethod  string  `gorm:"size:50;not null;check:payment_method IN ('credit_card', 'paypal', 'bank_transfer', 'cash_on_delivery')"`
-	PaymentStatus  string  `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed')"`
-	Amount         float64 `gorm:"not null"`
-	TransanctionID *string `gorm:"size:11;not null"`
+	ID             uint        `gorm:"primarykey"`
+	PaymentMethod  string      `gorm:"size:50;not null;check:payment_method IN ('credit_card', 'paypal', 'bank_transfer', 'cash_on_delivery', 'gift_card', 'store_credit')"`
+	PaymentStatus  string      `gorm:"size:50;not null;check:payment_status IN ('pending', 'completed', 'failed', 'refunded')"`
+	Amount         utils.Money `gorm:"not null"`
+	TransanctionID *string     `gorm:"size:11;not null"`
 	PaymentDate    *time.Time
 	OrderID        uint          `gorm:"not null" json:"-"`
 	Order          OrderResponse `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
@@ -62,14 +79,52 @@ type ShippingAddress struct {
 
 type OrderResponse struct {
 	gorm.Model
-	OrderIdentifier      string      `gorm:"type:varchar(8); not null;unique;index"`
-	UserID               uint        `gorm:"not null" json:"-"`
-	User                 User        `gorm:"foreignKey:UserID" json:"Buyer"`
-	OrderStatus          string      `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled')"`
-	TotalPrice           float64     `gorm:"not null"`
-	OrderItems           []OrderItem `gorm:"foreignKey:OrderID"`
-	OrderShippingAddress *string     `gorm:"type:text"`
-	PaymentDetails       *Payment    `gorm:"foreignKey:OrderID"`
+	OrderIdentifier      string `gorm:"type:varchar(8); not null;unique;index"`
+	UserID               uint   `gorm:"not null" json:"-"`
+	User                 User   `gorm:"foreignKey:UserID" json:"Buyer"`
+	OrderStatus          string `gorm:"size:50;not null;check:order_status IN ('pending', 'shipped', 'delivered', 'cancelled')"`
+	Currency             *string
+	ExchangeRate         float64
+	TotalPrice           utils.Money `gorm:"not null"`
+	TaxAmount            utils.Money
+	ShippingTax          utils.Money
+	PricesIncludeTax     bool
+	PointsRedeemed       int
+	OrderItems           []OrderItem      `gorm:"foreignKey:OrderID"`
+	OrderShippingAddress *string          `gorm:"type:text"`
+	PaymentDetails       *Payment         `gorm:"foreignKey:OrderID"`
+	Payments             []Payment        `gorm:"foreignKey:OrderID"`
+	Promotions           []OrderPromotion `gorm:"foreignKey:OrderID"`
+	TaxLines             []OrderTaxLine   `gorm:"foreignKey:OrderID"`
+	Invoices             []Invoice        `gorm:"foreignKey:OrderID"`
+}
+
+type OrderPromotion struct {
+	ID             uint        `gorm:"primaryKey"`
+	OrderID        uint        `gorm:"not null" json:"-"`
+	PromotionID    uint        `gorm:"not null"`
+	Name           string      `gorm:"size:150;not null"`
+	DiscountAmount utils.Money `gorm:"not null"`
+}
+
+type OrderTaxLine struct {
+	ID            uint        `gorm:"primaryKey"`
+	OrderID       uint        `gorm:"not null" json:"-"`
+	Name          string      `gorm:"size:100;not null"`
+	Rate          float64     `gorm:"not null"`
+	TaxableAmount utils.Money `gorm:"not null"`
+	TaxAmount     utils.Money `gorm:"not null"`
+}
+
+// Invoice lists an invoice or credit note of an order, the document is downloaded from /api/invoices/:id
+type Invoice struct {
+	ID          uint        `gorm:"primaryKey"`
+	OrderID     uint        `gorm:"not null" json:"-"`
+	Number      string      `gorm:"size:30;not null"`
+	InvoiceType string      `gorm:"size:20;not null"`
+	Currency    string      `gorm:"size:3;not null"`
+	Total       utils.Money `gorm:"not null"`
+	IssuedAt    time.Time
 }
 
 type ReviewResponse struct {
@@ -86,8 +141,9 @@ type InventoryResponse struct {
 	gorm.Model
 	ProductID         uint    `gorm:"not null" json:"-"`
 	Product           Product `gorm:"foreignKey:ProductID"`
-	StockLevel        int     `gorm:"not null"`
-	InOpen            int     `gorm:"not null"`
+	VariantID         *uint
+	StockLevel        int `gorm:"not null"`
+	InOpen            int `gorm:"not null"`
 	AvailableQuantity int
 	ChangeType        string `gorm:"size:50;not null;check:change_type IN ('restock', 'purchase')"`
 	ChangeDate        time.Time
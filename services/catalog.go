@@ -0,0 +1,263 @@
+package services
+
+import (
+	"backend/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+var ErrCatalogFormat = errors.New("catalog files must be CSV or XLSX")
+
+// CatalogColumns are the columns of a catalog file in the order they are exported
+var CatalogColumns = []string{
+	"SKU", "ParentSKU", "Name", "Description", "CategoryPath", "Brand", "Price", "Currency",
+	"CompareAtPrice", "SalePrice", "Status", "Options", "Stock", "Barcode", "Weight", "ImageURLs",
+}
+
+const (
+	// CategoryPathSeparator joins the category names from the root down, as in "Men > Shirts > Casual"
+	CategoryPathSeparator = " > "
+	// ImageURLSeparator joins the image URLs of a row
+	ImageURLSeparator = "|"
+)
+
+// CatalogRow is one product or variant of a catalog file. Variant rows name their product in
+// ParentSKU and their option values in Options ("Color=Red;Size=M"), the product columns stay empty.
+type CatalogRow struct {
+	Line           int `json:"-"` // Line in the file, the header being line 1
+	SKU            string
+	ParentSKU      string
+	Name           string
+	Description    string
+	CategoryPath   string
+	Brand          string
+	Price          string
+	Currency       string
+	CompareAtPrice string
+	SalePrice      string
+	Status         string
+	Options        string
+	Stock          string
+	Barcode        string
+	Weight         string
+	ImageURLs      string
+}
+
+// fields returns pointers to the columns of the row in the order of CatalogColumns
+func (r *CatalogRow) fields() []*string {
+	return []*string{
+		&r.SKU, &r.ParentSKU, &r.Name, &r.Description, &r.CategoryPath, &r.Brand, &r.Price, &r.Currency,
+		&r.CompareAtPrice, &r.SalePrice, &r.Status, &r.Options, &r.Stock, &r.Barcode, &r.Weight, &r.ImageURLs,
+	}
+}
+
+// record returns the cells of the row in the order of CatalogColumns
+func (r CatalogRow) record() []string {
+	fields := r.fields()
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = *field
+	}
+	return record
+}
+
+// formulaPrefixes start the cells spreadsheets evaluate as formulas when they open a CSV file
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula quotes a CSV cell that a spreadsheet would run as a formula with a leading '
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeFormula removes the quote escapeFormula put in front of a cell
+func unescapeFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// columnKey normalizes a header so "Parent SKU", "parent_sku" and "ParentSKU" match
+func columnKey(header string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+// ReadCatalog reads the rows of a CSV or XLSX catalog file. Columns are matched by their header
+// in any order, only SKU is required. Empty lines are skipped. CSV cells quoted by WriteCatalog
+// are read back as they were.
+func ReadCatalog(r io.Reader, format string) ([]CatalogRow, error) {
+	var records [][]string
+	switch strings.ToLower(format) {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		var err error
+		if records, err = reader.ReadAll(); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			for i := range record {
+				record[i] = unescapeFormula(record[i])
+			}
+		}
+	case "xlsx":
+		file, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		sheets := file.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("the workbook has no sheets")
+		}
+		if records, err = file.GetRows(sheets[0]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrCatalogFormat
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+
+	known := make(map[string]int)
+	for i, column := range CatalogColumns {
+		known[columnKey(column)] = i
+	}
+	columns := make([]int, len(records[0]))
+	hasSKU := false
+	for i, header := range records[0] {
+		index, ok := known[columnKey(header)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", header)
+		}
+		columns[i] = index
+		hasSKU = hasSKU || index == 0
+	}
+	if !hasSKU {
+		return nil, errors.New("the SKU column is required")
+	}
+
+	var rows []CatalogRow
+	for line, record := range records[1:] {
+		row := CatalogRow{Line: line + 2}
+		fields := row.fields()
+		empty := true
+		for i, cell := range record {
+			if i >= len(columns) {
+				break
+			}
+			*fields[columns[i]] = strings.TrimSpace(cell)
+			empty = empty && strings.TrimSpace(cell) == ""
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// WriteCatalog writes rows as a CSV or XLSX catalog file with a header line. CSV cells that a
+// spreadsheet would run as a formula are quoted with a leading '.
+func WriteCatalog(w io.Writer, rows []CatalogRow, format string) error {
+	switch strings.ToLower(format) {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(CatalogColumns); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			record := row.record()
+			for i := range record {
+				record[i] = escapeFormula(record[i])
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "xlsx":
+		file := excelize.NewFile()
+		defer file.Close()
+		sheet := "Products"
+		if err := file.SetSheetName(file.GetSheetName(0), sheet); err != nil {
+			return err
+		}
+		// every cell is written as text so SKUs such as 00123 keep their leading zeros
+		for i, record := range append([][]string{CatalogColumns}, catalogRecords(rows)...) {
+			cells := make([]interface{}, len(record))
+			for j, value := range record {
+				cells[j] = value
+			}
+			cell, err := excelize.CoordinatesToCellName(1, i+1)
+			if err != nil {
+				return err
+			}
+			if err := file.SetSheetRow(sheet, cell, &cells); err != nil {
+				return err
+			}
+		}
+		return file.Write(w)
+	default:
+		return ErrCatalogFormat
+	}
+}
+
+func catalogRecords(rows []CatalogRow) [][]string {
+	records := make([][]string, len(rows))
+	for i, row := range rows {
+		records[i] = row.record()
+	}
+	return records
+}
+
+// categoryPaths returns the path of every category from its root, such as "Men > Shirts"
+func categoryPaths(db *gorm.DB) (map[uint]string, error) {
+	var categories []models.Category
+	if err := db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Category)
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	paths := make(map[uint]string)
+	for _, category := range categories {
+		names := []string{}
+		seen := make(map[uint]bool)
+		for current, ok := category, true; ok && !seen[current.ID]; {
+			seen[current.ID] = true
+			names = append([]string{strings.TrimSpace(current.Name.String)}, names...)
+			if current.ParentID == nil {
+				break
+			}
+			current, ok = byID[*current.ParentID]
+		}
+		paths[category.ID] = strings.Join(names, CategoryPathSeparator)
+	}
+	return paths, nil
+}
+
+// formatOptions writes option values as "Color=Red;Size=M"
+func formatOptions(values []models.ProductOptionValue) string {
+	pairs := make([]string, 0, len(values))
+	for _, value := range values {
+		if value.Option != nil {
+			pairs = append(pairs, value.Option.Name+"="+value.Value)
+		}
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"backend/models"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// ExportCatalog returns every product followed by its variants in the format ImportCatalog reads,
+// so an exported file can be edited and imported again. Only images that were imported from a
+// URL can be listed in ImageURLs.
+func ExportCatalog(db *gorm.DB) ([]CatalogRow, error) {
+	paths, err := categoryPaths(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []models.Product
+	if err := db.Preload("Brand").
+		Preload("Inventory", "variant_id IS NULL").
+		Preload("Images", "variant_id IS NULL AND source_url <> ''", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC, id ASC")
+		}).
+		Preload("Variants.Values.Option").
+		Preload("Variants.Inventory").
+		Preload("Variants.Images", "source_url <> ''", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Where("is_child = false").Order("id ASC").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []CatalogRow
+	for _, product := range products {
+		row := CatalogRow{
+			SKU:          product.SKU,
+			Name:         product.Name,
+			Description:  product.Description,
+			CategoryPath: paths[product.CategoryID],
+			Brand:        product.Brand.Name.String,
+			Price:        product.Price.String(),
+			Currency:     product.Currency,
+			ImageURLs:    imageURLs(product.Images),
+		}
+		if product.CompareAtPrice != nil {
+			row.CompareAtPrice = product.CompareAtPrice.String()
+		}
+		if product.SalePrice != nil {
+			row.SalePrice = product.SalePrice.String()
+		}
+		if product.Status != nil {
+			row.Status = *product.Status
+		}
+		if product.Barcode != nil {
+			row.Barcode = *product.Barcode
+		}
+		if product.Inventory != nil && len(product.Variants) == 0 {
+			row.Stock = strconv.Itoa(product.Inventory.StockLevel)
+		}
+		rows = append(rows, row)
+
+		for _, variant := range product.Variants {
+			SortVariantValues(variant.Values)
+			row := CatalogRow{
+				SKU:       variant.SKU,
+				ParentSKU: product.SKU,
+				Options:   formatOptions(variant.Values),
+				ImageURLs: imageURLs(variant.Images),
+			}
+			if variant.Price != nil {
+				row.Price = variant.Price.String()
+			}
+			if variant.Inventory != nil {
+				row.Stock = strconv.Itoa(variant.Inventory.StockLevel)
+			}
+			if variant.Barcode != nil {
+				row.Barcode = *variant.Barcode
+			}
+			if variant.Weight != nil {
+				row.Weight = strconv.FormatFloat(*variant.Weight, 'f', -1, 64)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func imageURLs(images []models.ProductImage) string {
+	urls := ""
+	for _, image := range images {
+		if urls != "" {
+			urls += ImageURLSeparator
+		}
+		urls += image.SourceURL
+	}
+	return urls
+}
@@ -0,0 +1,716 @@
+package services
+
+import (
+	"backend/models"
+	"backend/storage"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxImportImageSize limits the size of an image downloaded during an import
+	maxImportImageSize = 10 << 20
+	// maxImportRedirects limits the redirects followed to download an image
+	maxImportRedirects = 3
+)
+
+var ErrPrivateImageHost = errors.New("images are not downloaded from loopback, private or link-local addresses")
+
+// importImageClient downloads images from public addresses only, so an imported URL can't reach
+// the server itself, its network or the metadata service of the cloud it runs in. Proxies are
+// not used, they would connect on the client's behalf.
+var importImageClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: publicAddressOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if len(via) >= maxImportRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxImportRedirects)
+		}
+		if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to an unsupported %s URL", request.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// reservedPrefixes are ranges that are neither private nor loopback but aren't on the internet
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// publicAddressOnly refuses to connect to an address that isn't public. It runs on the resolved
+// address, so host names pointing at internal addresses are refused too.
+func publicAddressOnly(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	// link-local covers the 169.254.169.254 metadata address, private the fd00:ec2::254 one
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return ErrPrivateImageHost
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return ErrPrivateImageHost
+		}
+	}
+	return nil
+}
+
+// CatalogRowError is a problem with one row of an imported catalog file
+type CatalogRowError struct {
+	Row   int
+	SKU   string
+	Error string
+}
+
+// CatalogImportResult reports what an import changed, or would change in a dry run. Nothing is
+// applied when a row has an error.
+type CatalogImportResult struct {
+	DryRun  bool
+	Applied bool
+	Rows    int
+	Created int
+	Updated int
+	Errors  []CatalogRowError
+}
+
+// catalogRecord is a validated catalog row, empty cells are nil and leave the stored value alone
+type catalogRecord struct {
+	row            CatalogRow
+	price          *utils.Money
+	compareAtPrice *utils.Money
+	salePrice      *utils.Money
+	status         *string
+	stock          *int
+	barcode        *string
+	weight         *float64
+	options        []OptionInput // One value per option, in the order of the file
+	images         []string
+}
+
+// catalogImport holds the lookups and state of a running import
+type catalogImport struct {
+	tx           *gorm.DB
+	userID       uint
+	baseCurrency string
+	categories   map[string]uint // Lower case category path to ID
+	brands       map[string]uint // Lower case brand name to ID
+	downloads    map[string][]byte
+	stored       *[]models.Image // Images stored by the import, discarded when it is rolled back
+	result       *CatalogImportResult
+}
+
+// ImportCatalog validates every row and upserts products and variants by SKU in one transaction.
+// Product rows are applied before variant rows, so a file can create a product and its variants
+// together. Nothing is written in a dry run or when any row has an error; images are only
+// downloaded when the import is applied.
+func ImportCatalog(db *gorm.DB, rows []CatalogRow, dryRun bool, userID uint) (CatalogImportResult, error) {
+	result := CatalogImportResult{DryRun: dryRun, Rows: len(rows)}
+
+	setting, err := CurrencySettings(db)
+	if err != nil {
+		return result, err
+	}
+	var currencies []string
+	if err := db.Model(&models.Currency{}).Where("is_active = true").Pluck("code", &currencies).Error; err != nil {
+		return result, err
+	}
+	supported := map[string]bool{strings.ToUpper(setting.BaseCurrency): true}
+	for _, code := range currencies {
+		supported[strings.ToUpper(code)] = true
+	}
+
+	var products, variants []catalogRecord
+	failed := make(map[string]bool)
+	seen := make(map[string]int)
+	for _, row := range rows {
+		record, problems := parseCatalogRow(row, supported)
+		key := strings.ToLower(row.SKU)
+		if line, ok := seen[key]; ok && row.SKU != "" {
+			problems = append(problems, fmt.Sprintf("SKU is repeated from row %d", line))
+		}
+		seen[key] = row.Line
+
+		if len(problems) != 0 {
+			failed[key] = true
+			for _, problem := range problems {
+				result.Errors = append(result.Errors, CatalogRowError{Row: row.Line, SKU: row.SKU, Error: problem})
+			}
+			continue
+		}
+		if row.ParentSKU == "" {
+			products = append(products, record)
+		} else {
+			variants = append(variants, record)
+		}
+	}
+
+	run := &catalogImport{
+		userID:       userID,
+		baseCurrency: strings.ToUpper(setting.BaseCurrency),
+		stored:       &[]models.Image{},
+		result:       &result,
+	}
+	if !dryRun && len(result.Errors) == 0 {
+		// images are fetched before the transaction starts so slow hosts don't hold it open
+		if err := run.download(db, append(append([]catalogRecord{}, products...), variants...)); err != nil {
+			return result, err
+		}
+	}
+
+	tx := db.Begin()
+	run.tx = tx
+	if err := run.loadLookups(); err != nil {
+		tx.Rollback()
+		return result, err
+	}
+
+	for _, record := range products {
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			return run.withTx(tx).upsertProduct(record)
+		}); err != nil {
+			failed[strings.ToLower(record.row.SKU)] = true
+			result.Errors = append(result.Errors, CatalogRowError{Row: record.row.Line, SKU: record.row.SKU, Error: err.Error()})
+		}
+	}
+	for _, record := range variants {
+		if failed[strings.ToLower(record.row.ParentSKU)] {
+			result.Errors = append(result.Errors, CatalogRowError{Row: record.row.Line, SKU: record.row.SKU, Error: "the row of the parent product has errors"})
+			continue
+		}
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			return run.withTx(tx).upsertVariant(record)
+		}); err != nil {
+			result.Errors = append(result.Errors, CatalogRowError{Row: record.row.Line, SKU: record.row.SKU, Error: err.Error()})
+		}
+	}
+
+	if dryRun || len(result.Errors) != 0 {
+		tx.Rollback()
+		return result, models.DiscardImageFiles(db, *run.stored)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return result, errors.Join(err, models.DiscardImageFiles(db, *run.stored))
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// parseCatalogRow checks the cells of a row and converts them to their types
+func parseCatalogRow(row CatalogRow, currencies map[string]bool) (catalogRecord, []string) {
+	record := catalogRecord{row: row}
+	var problems []string
+
+	if row.SKU == "" {
+		problems = append(problems, "SKU is required")
+	} else if len(row.SKU) > 150 {
+		problems = append(problems, "SKU is longer than 150 characters")
+	}
+
+	money := func(column string, cell string) *utils.Money {
+		if cell == "" {
+			return nil
+		}
+		amount, err := utils.ParseMoney(cell)
+		if err != nil || amount < 0 {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid amount", column, cell))
+			return nil
+		}
+		return &amount
+	}
+	record.price = money("Price", row.Price)
+
+	if row.Stock != "" {
+		stock, err := strconv.Atoi(row.Stock)
+		if err != nil || stock < 0 {
+			problems = append(problems, fmt.Sprintf("Stock %q is not a whole number of at least 0", row.Stock))
+		} else {
+			record.stock = &stock
+		}
+	}
+	if row.Barcode != "" {
+		record.barcode = &row.Barcode
+	}
+	for _, link := range strings.Split(row.ImageURLs, ImageURLSeparator) {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("image URL %q is not an http or https URL", link))
+			continue
+		}
+		record.images = append(record.images, link)
+	}
+
+	if row.ParentSKU == "" {
+		// a product row
+		record.compareAtPrice = money("CompareAtPrice", row.CompareAtPrice)
+		record.salePrice = money("SalePrice", row.SalePrice)
+		if row.Currency != "" && !currencies[strings.ToUpper(row.Currency)] {
+			problems = append(problems, fmt.Sprintf("currency %q is not supported", row.Currency))
+		}
+		if row.Status != "" {
+			status := strings.ToLower(row.Status)
+			if status != "published" && status != "unpublished" {
+				problems = append(problems, "Status must be published or unpublished")
+			}
+			record.status = &status
+		}
+		if len(row.Name) > 150 {
+			problems = append(problems, "Name is longer than 150 characters")
+		}
+		if row.Options != "" || row.Weight != "" {
+			problems = append(problems, "Options and Weight belong on the rows of the variants")
+		}
+		return record, problems
+	}
+
+	// a variant row
+	if strings.EqualFold(row.ParentSKU, row.SKU) {
+		problems = append(problems, "a variant can't be its own parent")
+	}
+	for _, cell := range [][2]string{
+		{"Name", row.Name}, {"Description", row.Description}, {"CategoryPath", row.CategoryPath}, {"Brand", row.Brand},
+		{"Currency", row.Currency}, {"CompareAtPrice", row.CompareAtPrice}, {"SalePrice", row.SalePrice}, {"Status", row.Status},
+	} {
+		if cell[1] != "" {
+			problems = append(problems, fmt.Sprintf("%s is taken from the parent product and must be empty on a variant row", cell[0]))
+		}
+	}
+	if row.Weight != "" {
+		weight, err := strconv.ParseFloat(row.Weight, 64)
+		if err != nil || weight < 0 {
+			problems = append(problems, fmt.Sprintf("Weight %q is not a valid number of kilograms", row.Weight))
+		} else {
+			record.weight = &weight
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(row.Options, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			problems = append(problems, fmt.Sprintf("option %q must be written as Name=Value", strings.TrimSpace(pair)))
+			continue
+		}
+		if names[strings.ToLower(name)] {
+			problems = append(problems, fmt.Sprintf("option %s is given twice", name))
+			continue
+		}
+		names[strings.ToLower(name)] = true
+		record.options = append(record.options, OptionInput{Name: name, Values: []OptionValueInput{{Value: value}}})
+	}
+	return record, problems
+}
+
+// withTx returns a copy of the import writing to tx
+func (run *catalogImport) withTx(tx *gorm.DB) *catalogImport {
+	copied := *run
+	copied.tx = tx
+	return &copied
+}
+
+func (run *catalogImport) loadLookups() error {
+	paths, err := categoryPaths(run.tx)
+	if err != nil {
+		return err
+	}
+	run.categories = make(map[string]uint)
+	for id, path := range paths {
+		run.categories[strings.ToLower(path)] = id
+	}
+
+	var brands []models.Brand
+	if err := run.tx.Find(&brands).Error; err != nil {
+		return err
+	}
+	run.brands = make(map[string]uint)
+	for _, brand := range brands {
+		run.brands[strings.ToLower(strings.TrimSpace(brand.Name.String))] = brand.ID
+	}
+	return nil
+}
+
+// download fetches the images of the records that aren't stored yet
+func (run *catalogImport) download(db *gorm.DB, records []catalogRecord) error {
+	var links []string
+	for _, record := range records {
+		links = append(links, record.images...)
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	var stored []string
+	if err := db.Model(&models.ProductImage{}).Where("source_url IN ? AND image_key <> ''", links).Distinct("source_url").Pluck("source_url", &stored).Error; err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, link := range stored {
+		known[link] = true
+	}
+
+	run.downloads = make(map[string][]byte)
+	for _, record := range records {
+		for _, link := range record.images {
+			if _, ok := run.downloads[link]; ok || known[link] {
+				continue
+			}
+			data, err := downloadImage(link)
+			if err != nil {
+				run.result.Errors = append(run.result.Errors, CatalogRowError{Row: record.row.Line, SKU: record.row.SKU, Error: err.Error()})
+				continue
+			}
+			run.downloads[link] = data
+		}
+	}
+	return nil
+}
+
+func downloadImage(link string) ([]byte, error) {
+	response, err := importImageClient.Get(link)
+	if err != nil {
+		return nil, fmt.Errorf("image %s could not be downloaded: %w", link, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image %s could not be downloaded: %s", link, response.Status)
+	}
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "image/") {
+		return nil, fmt.Errorf("%s is not an image", link)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxImportImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("image %s could not be downloaded: %w", link, err)
+	}
+	if len(data) > maxImportImageSize {
+		return nil, fmt.Errorf("image %s is larger than %d MB", link, maxImportImageSize>>20)
+	}
+	if _, err := storage.ValidateImage(data); err != nil {
+		return nil, fmt.Errorf("image %s: %w", link, err)
+	}
+	return data, nil
+}
+
+// upsertProduct creates the product of a row or updates the product with its SKU. Empty cells
+// keep the stored values of an existing product.
+func (run *catalogImport) upsertProduct(record catalogRecord) error {
+	row := record.row
+
+	var variantCount int64
+	if err := run.tx.Model(&models.ProductVariant{}).Where("sku = ?", row.SKU).Count(&variantCount).Error; err != nil {
+		return err
+	}
+	if variantCount > 0 {
+		return errors.New("the SKU belongs to a variant, set ParentSKU to update it")
+	}
+
+	var product models.Product
+	err := run.tx.Where("sku = ? AND is_child = false", row.SKU).First(&product).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	exists := err == nil
+	before := product
+
+	if !exists {
+		var missing []string
+		if row.Name == "" {
+			missing = append(missing, "Name")
+		}
+		if row.CategoryPath == "" {
+			missing = append(missing, "CategoryPath")
+		}
+		if record.price == nil {
+			missing = append(missing, "Price")
+		}
+		if len(missing) != 0 {
+			return fmt.Errorf("a new product needs %s", strings.Join(missing, ", "))
+		}
+		status := "unpublished"
+		product = models.Product{SKU: row.SKU, Currency: run.baseCurrency, Status: &status}
+	}
+
+	if row.Name != "" {
+		product.Name = row.Name
+	}
+	if row.Description != "" {
+		product.Description = row.Description
+	}
+	if row.CategoryPath != "" {
+		parts := strings.Split(row.CategoryPath, ">")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		id, ok := run.categories[strings.ToLower(strings.Join(parts, CategoryPathSeparator))]
+		if !ok {
+			return fmt.Errorf("category %q doesn't exist", row.CategoryPath)
+		}
+		product.CategoryID = id
+	}
+	if row.Brand != "" {
+		id, ok := run.brands[strings.ToLower(row.Brand)]
+		if !ok {
+			return fmt.Errorf("brand %q doesn't exist", row.Brand)
+		}
+		product.BrandID = &id
+	}
+	if record.price != nil {
+		product.Price = *record.price
+	}
+	if row.Currency != "" {
+		product.Currency = strings.ToUpper(row.Currency)
+	}
+	if record.compareAtPrice != nil {
+		product.CompareAtPrice = record.compareAtPrice
+	}
+	if record.salePrice != nil {
+		product.SalePrice = record.salePrice
+	}
+	if record.status != nil {
+		product.Status = record.status
+	}
+	if record.barcode != nil {
+		product.Barcode = record.barcode
+	}
+
+	if exists {
+		if err := run.tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := RecordPriceChanges(run.tx, before, product, "import", &run.userID); err != nil {
+			return err
+		}
+		if err := RecordRevision(run.tx, &before, product, "import", &run.userID); err != nil {
+			return err
+		}
+		run.result.Updated++
+	} else {
+		if err := run.tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := RecordRevision(run.tx, nil, product, "import", &run.userID); err != nil {
+			return err
+		}
+		if record.stock == nil {
+			zero := 0
+			record.stock = &zero
+		}
+		run.result.Created++
+	}
+
+	if record.stock != nil {
+		if err := setStock(run.tx, product.ID, nil, *record.stock); err != nil {
+			return err
+		}
+	}
+	if err := RefreshSearchIndex(run.tx, product.ID); err != nil {
+		return err
+	}
+	return run.attachImages(product.ID, nil, record.images)
+}
+
+// upsertVariant creates the variant of a row under its parent or updates the variant with its SKU
+func (run *catalogImport) upsertVariant(record catalogRecord) error {
+	row := record.row
+
+	var parent models.Product
+	if err := run.tx.Where("sku = ? AND is_child = false", row.ParentSKU).First(&parent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("parent product %q doesn't exist", row.ParentSKU)
+		}
+		return err
+	}
+
+	var productCount int64
+	if err := run.tx.Model(&models.Product{}).Where("sku = ?", row.SKU).Count(&productCount).Error; err != nil {
+		return err
+	}
+	if productCount > 0 {
+		return errors.New("the SKU belongs to a product, leave ParentSKU empty to update it")
+	}
+
+	var variant models.ProductVariant
+	err := run.tx.Preload("Values.Option").Where("sku = ?", row.SKU).First(&variant).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err == nil {
+		if variant.ProductID != parent.ID {
+			return errors.New("the SKU belongs to a variant of another product")
+		}
+		if len(record.options) != 0 {
+			if !sameOptions(variant.Values, record.options) {
+				return errors.New("the options of an existing variant can't be changed, add a new variant instead")
+			}
+		}
+		if record.barcode != nil {
+			variant.Barcode = record.barcode
+		}
+		if record.price != nil {
+			variant.Price = record.price
+		}
+		if record.weight != nil {
+			variant.Weight = record.weight
+		}
+		if err := run.tx.Omit("Values").Save(&variant).Error; err != nil {
+			return err
+		}
+		if record.stock != nil {
+			if err := setStock(run.tx, parent.ID, &variant.ID, *record.stock); err != nil {
+				return err
+			}
+		}
+		run.result.Updated++
+		return run.attachImages(parent.ID, &variant.ID, record.images)
+	}
+
+	if len(record.options) == 0 {
+		return errors.New("a new variant needs Options")
+	}
+
+	// a product without options gets them in the order of the file
+	var optionCount int64
+	if err := run.tx.Model(&models.ProductOption{}).Where("product_id = ?", parent.ID).Count(&optionCount).Error; err != nil {
+		return err
+	}
+	if optionCount == 0 {
+		if _, err := CreateProductOptions(run.tx, parent.ID, record.options); err != nil {
+			return err
+		}
+	}
+
+	selection := make(map[string]string)
+	for _, option := range record.options {
+		selection[option.Name] = option.Values[0].Value
+	}
+	input := VariantInput{SKU: row.SKU, Barcode: record.barcode, Price: record.price, Weight: record.weight}
+	if record.stock != nil {
+		input.Quantity = *record.stock
+	}
+	created, err := AddVariant(run.tx, parent, selection, input)
+	if err != nil {
+		return err
+	}
+	if err := RefreshSearchIndex(run.tx, parent.ID); err != nil {
+		return err
+	}
+	run.result.Created++
+	return run.attachImages(parent.ID, &created.ID, record.images)
+}
+
+// setStock sets the absolute stock level of a product or of one of its variants
+func setStock(tx *gorm.DB, productID uint, variantID *uint, level int) error {
+	query := tx.Where("product_id = ? AND variant_id IS NULL", productID)
+	if variantID != nil {
+		query = tx.Where("product_id = ? AND variant_id = ?", productID, *variantID)
+	}
+
+	var inventory models.Inventory
+	err := query.First(&inventory).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		inventory = models.Inventory{ProductID: productID, VariantID: variantID}
+	} else if err != nil {
+		return err
+	}
+	if inventory.ID != 0 && inventory.StockLevel == level {
+		return nil
+	}
+
+	inventory.StockLevel = level
+	inventory.ChangeType = "restock"
+	inventory.ChangeDate = time.Now()
+	return tx.Save(&inventory).Error
+}
+
+// attachImages stores the downloaded images of a row that the product or variant doesn't have yet
+func (run *catalogImport) attachImages(productID uint, variantID *uint, links []string) error {
+	for _, link := range links {
+		query := run.tx.Model(&models.ProductImage{}).Where("product_id = ? AND source_url = ?", productID, link)
+		if variantID != nil {
+			query = query.Where("variant_id = ?", *variantID)
+		} else {
+			query = query.Where("variant_id IS NULL")
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		image := models.ProductImage{ProductID: productID, VariantID: variantID, SourceURL: link}
+		if data, ok := run.downloads[link]; ok {
+			stored, err := models.StoreImage(run.tx, data)
+			if err != nil {
+				return err
+			}
+			*run.stored = append(*run.stored, *stored)
+			image.Use(stored)
+		} else {
+			// a dry run, or an image another product already imported from the same URL
+			var existing models.ProductImage
+			if err := run.tx.Where("source_url = ? AND image_key <> ''", link).First(&existing).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+			image.StoredImage = existing.StoredImage
+		}
+		if err := run.tx.Create(&image).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameOptions reports whether the option values of a variant are the single valued option inputs
+func sameOptions(values []models.ProductOptionValue, options []OptionInput) bool {
+	if len(values) != len(options) {
+		return false
+	}
+	chosen := make(map[string]string)
+	for _, option := range options {
+		chosen[strings.ToLower(option.Name)] = strings.ToLower(option.Values[0].Value)
+	}
+	for _, value := range values {
+		if value.Option == nil || chosen[strings.ToLower(value.Option.Name)] != strings.ToLower(value.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.5:80", false},
+		{"172.16.3.4:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"[fd00:ec2::254]:80", false}, // cloud metadata over IPv6
+		{"[fe80::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"100.64.0.1:80", false},
+		{"[::ffff:127.0.0.1]:80", false}, // IPv4 mapped loopback
+		{"224.0.0.1:80", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			err := publicAddressOnly("tcp", test.address, nil)
+			if test.public && err != nil {
+				t.Errorf("refused %s: %v", test.address, err)
+			}
+			if !test.public && !errors.Is(err, ErrPrivateImageHost) {
+				t.Errorf("allowed %s, err = %v", test.address, err)
+			}
+		})
+	}
+}
+
+func TestCatalogFormulaEscaping(t *testing.T) {
+	tests := []struct {
+		cell    string
+		written string
+	}{
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1", "'+1"},
+		{"-2", "'-2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"Shirt", "Shirt"},
+		{"'quoted", "'quoted"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.cell, func(t *testing.T) {
+			if got := escapeFormula(test.cell); got != test.written {
+				t.Errorf("escapeFormula(%q) = %q, want %q", test.cell, got, test.written)
+			}
+			if got := unescapeFormula(test.written); got != test.cell {
+				t.Errorf("unescapeFormula(%q) = %q, want %q", test.written, got, test.cell)
+			}
+		})
+	}
+
+	rows := []CatalogRow{{SKU: "SKU-1", Name: "=cmd|' /C calc'!A0", Description: "@risk", Price: "10"}}
+	var buffer bytes.Buffer
+	if err := WriteCatalog(&buffer, rows, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), `'=cmd|' /C calc'!A0`) || !strings.Contains(buffer.String(), "'@risk") {
+		t.Errorf("formula cells are not quoted:\n%s", buffer.String())
+	}
+	read, err := ReadCatalog(&buffer, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows[0].Line = 2
+	if !reflect.DeepEqual(read, rows) {
+		t.Errorf("read back %+v, want %+v", read, rows)
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryCycle  = errors.New("a category cannot move below itself")
+	ErrNotSiblings    = errors.New("the categories must be distinct sub categories of the parent")
+	ErrCategoryNoPath = models.ErrCategoryNoPath
+)
+
+// categoryTypeByDepth names the type of a category moved by a number of levels, see
+// models.CategoryTypeAt
+const categoryTypeByDepth = "CASE WHEN depth + ? = 0 THEN 'parent' WHEN depth + ? = 1 THEN 'child' ELSE 'grandchild' END"
+
+// CategoryNode is a category of the tree with the categories below it
+type CategoryNode struct {
+	ID           uint            `json:"id"`
+	Name         string          `json:"name"`
+	Slug         string          `json:"slug"`
+	ParentID     *uint           `json:"parent_id"` // Nullable for top-level categories
+	Level        int             `json:"level"`     // 1 for top-level categories
+	Position     int             `json:"position"`
+	ProductCount int             `json:"product_count"` // Published products in the category and below it
+	Children     []*CategoryNode `json:"children,omitempty"`
+}
+
+// CategoryCrumb is a step of the breadcrumbs leading to a category
+type CategoryCrumb struct {
+	ID   uint
+	Name string
+	Slug string
+}
+
+// CategorySubtree selects the ids of a category and of every category below it, for use as a
+// subquery such as "category_id IN (?)"
+func CategorySubtree(db *gorm.DB, categoryID uint) *gorm.DB {
+	// a category without a path matches nothing rather than every category
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.Category{}).Select("categories.id").
+		Where("categories.path LIKE (SELECT NULLIF(path, '') FROM categories WHERE id = ?) || '%'", categoryID)
+}
+
+// CategoryTree returns every category nested below its parent, siblings in their order
+func CategoryTree(db *gorm.DB) ([]*CategoryNode, error) {
+	var nodes []*CategoryNode
+	if err := db.Model(&models.Category{}).Select("id, name, slug, parent_id, depth + 1 AS level, position").
+		Order("depth ASC, position ASC, id ASC").Scan(&nodes).Error; err != nil {
+		return nil, err
+	}
+	counts, err := SubtreeProductCounts(db)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*CategoryNode, len(nodes))
+	roots := []*CategoryNode{}
+	for _, node := range nodes {
+		node.ProductCount = counts[node.ID]
+		byID[node.ID] = node
+	}
+	// parents come first, being less deep; categories below a deleted one are left out
+	for _, node := range nodes {
+		if node.ParentID == nil {
+			roots = append(roots, node)
+		} else if parent, ok := byID[*node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return roots, nil
+}
+
+// SubtreeProductCounts counts the published products of every category and the categories below it
+func SubtreeProductCounts(db *gorm.DB) (map[uint]int, error) {
+	var rows []struct {
+		ID    uint
+		Count int
+	}
+	err := db.Raw(`SELECT ancestors.id, COUNT(products.id) AS count
+		FROM categories AS ancestors
+		INNER JOIN categories ON categories.path LIKE ancestors.path || '%' AND categories.deleted_at IS NULL
+		INNER JOIN products ON products.category_id = categories.id AND products.deleted_at IS NULL
+			AND products.is_child = false AND products.status = 'published'
+		WHERE ancestors.deleted_at IS NULL AND ancestors.path <> ''
+		GROUP BY ancestors.id`).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
+
+// Breadcrumbs returns the categories from the top down to the given one
+func Breadcrumbs(db *gorm.DB, categoryID uint) ([]CategoryCrumb, error) {
+	var category models.Category
+	if err := db.Select("id, path").First(&category, categoryID).Error; err != nil {
+		return nil, err
+	}
+	if category.Path == "" {
+		return nil, ErrCategoryNoPath
+	}
+
+	crumbs := []CategoryCrumb{}
+	err := db.Model(&models.Category{}).Select("id, name, slug").
+		Where("id IN ?", models.PathIDs(category.Path)).Order("depth ASC").Scan(&crumbs).Error
+	return crumbs, err
+}
+
+// MoveCategory moves a category with everything below it under another parent, nil for the top
+// level, at position among its new siblings. A nil position puts it last.
+func MoveCategory(tx *gorm.DB, categoryID uint, parentID *uint, position *int) (*models.Category, error) {
+	var category models.Category
+	if err := tx.First(&category, categoryID).Error; err != nil {
+		return nil, err
+	}
+	if category.Path == "" {
+		return nil, ErrCategoryNoPath
+	}
+
+	parentPath, depth := "/", 0
+	if parentID != nil {
+		var parent models.Category
+		if err := tx.First(&parent, *parentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, models.ErrUnknownParent
+			}
+			return nil, err
+		}
+		if parent.Path == "" {
+			return nil, ErrCategoryNoPath
+		}
+		if strings.HasPrefix(parent.Path, category.Path) {
+			return nil, ErrCategoryCycle
+		}
+		parentPath, depth = parent.Path, parent.Depth+1
+	}
+
+	if !sameParent(category.ParentID, parentID) {
+		// categories in the trash move along, so a restore finds them in place
+		path := parentPath + strconv.FormatUint(uint64(category.ID), 10) + "/"
+		delta := depth - category.Depth
+		if err := tx.Unscoped().Model(&models.Category{}).Where("path LIKE ?", category.Path+"%").Updates(map[string]interface{}{
+			"path":          gorm.Expr("? || substr(path, ?)", path, len(category.Path)+1),
+			"depth":         gorm.Expr("depth + ?", delta),
+			"category_type": gorm.Expr(categoryTypeByDepth, delta, delta),
+		}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&category).Update("parent_id", parentID).Error; err != nil {
+			return nil, err
+		}
+		category.ParentID, category.Path, category.Depth = parentID, path, depth
+		category.CategoryType.SetValid(models.CategoryTypeAt(depth))
+	}
+
+	siblings, err := siblingIDs(tx, parentID, category.ID)
+	if err != nil {
+		return nil, err
+	}
+	at := len(siblings)
+	if position != nil && *position >= 0 && *position < at {
+		at = *position
+	}
+	order := append(append(append([]uint{}, siblings[:at]...), category.ID), siblings[at:]...)
+	if err := writePositions(tx, order); err != nil {
+		return nil, err
+	}
+	category.Position = at
+	return &category, nil
+}
+
+// ReorderCategories puts the categories of a parent, nil for the top level, in the order of ids.
+// The categories left out follow in their current order.
+func ReorderCategories(tx *gorm.DB, parentID *uint, ids []uint) error {
+	siblings, err := siblingIDs(tx, parentID, 0)
+	if err != nil {
+		return err
+	}
+	listed := make(map[uint]bool, len(ids))
+	known := make(map[uint]bool, len(siblings))
+	for _, id := range siblings {
+		known[id] = true
+	}
+	for _, id := range ids {
+		if !known[id] || listed[id] {
+			return ErrNotSiblings
+		}
+		listed[id] = true
+	}
+
+	order := append([]uint{}, ids...)
+	for _, id := range siblings {
+		if !listed[id] {
+			order = append(order, id)
+		}
+	}
+	return writePositions(tx, order)
+}
+
+// BuildCategoryTree adds the path, depth and position of categories to the table and fills them
+// in from the parents, dropping the three level limit of category types. It is safe to run
+// repeatedly and returns the number of categories left out of the tree, such as those in a cycle
+// of parents.
+func BuildCategoryTree(db *gorm.DB) (int64, error) {
+	for _, field := range []string{"Path", "Depth", "Position"} {
+		if !db.Migrator().HasColumn(&models.Category{}, field) {
+			if err := db.Migrator().AddColumn(&models.Category{}, field); err != nil {
+				return 0, err
+			}
+		}
+	}
+	statements := []string{
+		"CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id)",
+		"ALTER TABLE categories DROP CONSTRAINT IF EXISTS chk_categories_category_type",
+		"CREATE INDEX IF NOT EXISTS idx_categories_path_pattern ON categories (path text_pattern_ops)",
+		`WITH RECURSIVE tree AS (
+			SELECT id, '/' || id || '/' AS path, 0 AS depth FROM categories WHERE parent_id IS NULL
+			UNION ALL
+			SELECT c.id, tree.path || c.id || '/', tree.depth + 1 FROM categories c INNER JOIN tree ON c.parent_id = tree.id
+		)
+		UPDATE categories SET path = tree.path, depth = tree.depth,
+			category_type = CASE WHEN tree.depth = 0 THEN 'parent' WHEN tree.depth = 1 THEN 'child' ELSE 'grandchild' END
+		FROM tree WHERE categories.id = tree.id`,
+		// siblings never ordered keep the order they were created in
+		`UPDATE categories SET position = ranked.position
+		FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY id) - 1 AS position FROM categories) AS ranked
+		WHERE categories.id = ranked.id AND NOT EXISTS (
+			SELECT 1 FROM categories AS siblings
+			WHERE siblings.parent_id IS NOT DISTINCT FROM categories.parent_id AND siblings.position <> 0
+		)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	var orphans int64
+	err := db.Unscoped().Model(&models.Category{}).Where("path = ''").Count(&orphans).Error
+	return orphans, err
+}
+
+// siblingIDs returns the categories of a parent in their order, leaving out one of them
+func siblingIDs(tx *gorm.DB, parentID *uint, except uint) ([]uint, error) {
+	query := tx.Model(&models.Category{}).Where("id <> ?", except).Order("position ASC, id ASC")
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	var ids []uint
+	err := query.Pluck("id", &ids).Error
+	return ids, err
+}
+
+// writePositions numbers the categories in the order given
+func writePositions(tx *gorm.DB, ids []uint) error {
+	for position, id := range ids {
+		if err := tx.Model(&models.Category{}).Where("id = ? AND position <> ?", id, position).
+			Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameParent(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+)
+
+// findCategories has a dry run session find the given categories, one for each category looked up
+func findCategories(t *testing.T, db *gorm.DB, categories ...models.Category) {
+	t.Helper()
+	err := db.Callback().Query().After("gorm:query").Register("test:categories", func(db *gorm.DB) {
+		if category, ok := db.Statement.Dest.(*models.Category); ok && len(categories) != 0 {
+			*category, categories = categories[0], categories[1:]
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoveCategory(t *testing.T) {
+	category := func(id uint, path string) models.Category {
+		c := models.Category{Path: path, Depth: strings.Count(path, "/") - 2}
+		c.ID = id
+		return c
+	}
+	ptr := func(category models.Category) *models.Category { return &category }
+	shirts := category(4, "/1/4/")
+	shirts.ParentID = uintPtr(1)
+
+	tests := []struct {
+		name   string
+		moved  models.Category
+		parent *models.Category
+		err    error
+		path   string // New path of the moved categories
+	}{
+		{"below itself", shirts, &shirts, ErrCategoryCycle, ""},
+		{"below a sub category", shirts, ptr(category(9, "/1/4/9/")), ErrCategoryCycle, ""},
+		{"below a deeper sub category", shirts, ptr(category(12, "/1/4/9/12/")), ErrCategoryCycle, ""},
+		// the path of category 41 starts with the digits of category 4, not with its path
+		{"below a category with a longer id", shirts, ptr(category(41, "/1/41/")), nil, "/1/41/4/"},
+		{"below another top category", shirts, ptr(category(2, "/2/")), nil, "/2/4/"},
+		{"to the top level", shirts, nil, nil, "/4/"},
+		{"tree not built", category(4, ""), nil, ErrCategoryNoPath, ""},
+		{"parent not in the tree", shirts, ptr(category(2, "")), ErrCategoryNoPath, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, log := dryRun(t)
+			found := []models.Category{test.moved}
+			var parentID *uint
+			if test.parent != nil {
+				found = append(found, *test.parent)
+				parentID = &test.parent.ID
+			}
+			findCategories(t, db, found...)
+
+			moved, err := MoveCategory(db, test.moved.ID, parentID, nil)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("MoveCategory error = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if moved.Path != test.path {
+				t.Errorf("path = %q, want %q", moved.Path, test.path)
+			}
+			// the categories below it move along, trashed ones included
+			moves := ""
+			for _, statement := range log.statements {
+				if strings.HasSuffix(statement, `WHERE path LIKE '/1/4/%'`) {
+					moves = statement
+				}
+			}
+			if !strings.Contains(moves, `"path"='`+test.path+`' || substr(path, 6)`) {
+				t.Errorf("statements = %q, want the paths below /1/4/ moved to %s", log.statements, test.path)
+			}
+		})
+	}
+}
+
+func TestCreateSubCategoryTreeNotBuilt(t *testing.T) {
+	db, _ := dryRun(t)
+	parent := models.Category{}
+	parent.ID = 1
+	findCategories(t, db, parent)
+
+	// without a path the category would get one from the root, at the top of the tree
+	category := models.Category{Name: null.StringFrom("Shirts"), ParentID: uintPtr(1)}
+	if err := db.Create(&category).Error; !errors.Is(err, ErrCategoryNoPath) {
+		t.Errorf("Create error = %v, want %v", err, ErrCategoryNoPath)
+	}
+}
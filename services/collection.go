@@ -0,0 +1,285 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrManualRules     = errors.New("a manual collection lists the products picked for it and has no rules")
+	ErrNoRules         = errors.New("a rules collection needs at least one rule")
+	ErrCollectionDates = errors.New("EndDate must come after StartDate")
+	ErrNotManual       = errors.New("products are only picked for manual collections")
+	ErrUnknownProducts = errors.New("every product must be listed once and be a product, not a variation")
+)
+
+// The fields a collection rule can test, with the operators each accepts. Prices are in the base
+// currency, categories match the products below them too and tags are given by slug.
+const (
+	RuleTag      = "tag"
+	RulePrice    = "price"
+	RuleCategory = "category"
+	RuleBrand    = "brand"
+	RuleFeatured = "featured"
+	RuleInStock  = "in_stock"
+	RuleRating   = "rating"
+)
+
+var ruleOperators = map[string][]string{
+	RuleTag:      {"eq", "ne"},
+	RulePrice:    {"eq", "ne", "lt", "lte", "gt", "gte"},
+	RuleCategory: {"eq", "ne"},
+	RuleBrand:    {"eq", "ne"},
+	RuleFeatured: {"eq"},
+	RuleInStock:  {"eq"},
+	RuleRating:   {"eq", "ne", "lt", "lte", "gt", "gte"},
+}
+
+var comparisons = map[string]string{"eq": "=", "ne": "<>", "lt": "<", "lte": "<=", "gt": ">", "gte": ">="}
+
+// taggedCondition matches products having one of the tags of the given slugs
+const taggedCondition = `EXISTS (
+	SELECT 1
+	FROM product_tags
+	INNER JOIN tags ON tags.id = product_tags.tag_id
+	WHERE product_tags.product_id = products.id
+	AND tags.slug IN ?
+)`
+
+// ruleCondition is the SQL of a rule, built against the query it filters
+type ruleCondition func(db *gorm.DB) clause.Expr
+
+// LiveCollection keeps the collections that are active and within their dates
+func LiveCollection(db *gorm.DB) *gorm.DB {
+	return db.Where("collections.is_active AND (collections.start_date IS NULL OR collections.start_date <= NOW()) " +
+		"AND (collections.end_date IS NULL OR collections.end_date > NOW())")
+}
+
+// CheckCollection validates the type, rules and dates of a collection
+func CheckCollection(collection models.Collection) error {
+	if collection.StartDate != nil && collection.EndDate != nil && !collection.EndDate.After(*collection.StartDate) {
+		return ErrCollectionDates
+	}
+	switch collection.CollectionType {
+	case "manual":
+		if len(collection.Rules) != 0 {
+			return ErrManualRules
+		}
+		return nil
+	case "rules":
+		if len(collection.Rules) == 0 {
+			return ErrNoRules
+		}
+		_, err := parseRules(collection.Rules)
+		return err
+	}
+	return errors.New("CollectionType must be manual or rules")
+}
+
+// CollectionScope restricts a products query to the products of a collection
+func CollectionScope(collection models.Collection) (func(db *gorm.DB) *gorm.DB, error) {
+	if collection.CollectionType == "manual" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("products.id IN (SELECT product_id FROM collection_products WHERE collection_id = ?)", collection.ID)
+		}, nil
+	}
+
+	conditions, err := parseRules(collection.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		exprs := make([]clause.Expression, 0, len(conditions))
+		for _, condition := range conditions {
+			exprs = append(exprs, condition(db))
+		}
+		if collection.Match == "any" {
+			return db.Where(clause.Or(exprs...))
+		}
+		return db.Where(clause.And(exprs...))
+	}, nil
+}
+
+// CuratedOrder orders the products of a manual collection as they were picked
+func CuratedOrder(collectionID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "(SELECT position FROM collection_products WHERE collection_id = ? AND product_id = products.id) ASC, products.id ASC",
+			Vars:               []interface{}{collectionID},
+			WithoutParentheses: true,
+		}})
+	}
+}
+
+// SetCollectionProducts replaces the products picked for a manual collection with productIDs, in
+// their order
+func SetCollectionProducts(tx *gorm.DB, collection models.Collection, productIDs []uint) error {
+	if collection.CollectionType != "manual" {
+		return ErrNotManual
+	}
+	seen := make(map[uint]bool, len(productIDs))
+	for _, id := range productIDs {
+		if seen[id] {
+			return ErrUnknownProducts
+		}
+		seen[id] = true
+	}
+	if len(productIDs) != 0 {
+		var count int64
+		if err := tx.Model(&models.Product{}).Where("id IN ? AND is_child = false", productIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(productIDs) {
+			return ErrUnknownProducts
+		}
+	}
+
+	if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionProduct{}).Error; err != nil {
+		return err
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+	picked := make([]models.CollectionProduct, 0, len(productIDs))
+	for position, id := range productIDs {
+		picked = append(picked, models.CollectionProduct{CollectionID: collection.ID, ProductID: id, Position: position})
+	}
+	return tx.Create(&picked).Error
+}
+
+// SetProductTags replaces the tags of a product with the tags of the given names, creating the
+// tags that do not exist yet. Names are matched by their slug.
+func SetProductTags(tx *gorm.DB, product *models.Product, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		slug := utils.Slugify(name)
+		if slug == "" {
+			return nil, ErrInvalidSlug
+		}
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		tag := models.Tag{Name: strings.TrimSpace(name), Slug: slug}
+		if err := tx.Where("slug = ?", slug).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := tx.Model(product).Association("Tags").Replace(tags); err != nil {
+		return nil, err
+	}
+	product.Tags = tags
+	return tags, nil
+}
+
+// parseRules validates the rules of a collection into their conditions
+func parseRules(rules models.CollectionRules) ([]ruleCondition, error) {
+	conditions := make([]ruleCondition, 0, len(rules))
+	for i, rule := range rules {
+		condition, err := parseRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func parseRule(rule models.CollectionRule) (ruleCondition, error) {
+	field := strings.ToLower(strings.TrimSpace(rule.Field))
+	operator := strings.ToLower(strings.TrimSpace(rule.Operator))
+	value := strings.TrimSpace(rule.Value)
+
+	operators, ok := ruleOperators[field]
+	if !ok {
+		return nil, fmt.Errorf("field must be one of %s, %s, %s, %s, %s, %s or %s",
+			RuleTag, RulePrice, RuleCategory, RuleBrand, RuleFeatured, RuleInStock, RuleRating)
+	}
+	known := false
+	for _, name := range operators {
+		known = known || name == operator
+	}
+	if !known {
+		return nil, fmt.Errorf("%s accepts the operators %s", field, strings.Join(operators, ", "))
+	}
+	negate := func(sql string) string {
+		if operator == "ne" {
+			return "NOT (" + sql + ")"
+		}
+		return sql
+	}
+
+	switch field {
+	case RuleTag:
+		slug := utils.Slugify(value)
+		if slug == "" {
+			return nil, errors.New("tag must be the slug of a tag")
+		}
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: negate(taggedCondition), Vars: []interface{}{[]string{slug}}}
+		}, nil
+	case RulePrice:
+		price, err := utils.ParseMoney(value)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("%q is not a valid price", value)
+		}
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: utils.BasePriceColumn + " " + comparisons[operator] + " ?", Vars: []interface{}{price}}
+		}, nil
+	case RuleCategory:
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("category must be a category ID")
+		}
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: negate("products.category_id IN (?)"), Vars: []interface{}{CategorySubtree(db, uint(id))}}
+		}, nil
+	case RuleBrand:
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("brand must be a brand ID")
+		}
+		// products without a brand are not of any brand
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: negate("products.brand_id IS NOT DISTINCT FROM ?"), Vars: []interface{}{uint(id)}}
+		}, nil
+	case RuleFeatured:
+		featured, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("featured must be true or false")
+		}
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: "products.featured = ?", Vars: []interface{}{featured}}
+		}, nil
+	case RuleInStock:
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("in_stock must be true or false")
+		}
+		return func(db *gorm.DB) clause.Expr {
+			if inStock {
+				return clause.Expr{SQL: inStockCondition}
+			}
+			return clause.Expr{SQL: "NOT " + inStockCondition}
+		}, nil
+	default:
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return nil, errors.New("rating must be a number from 0 to 5")
+		}
+		// products without reviews have no rating to compare
+		return func(db *gorm.DB) clause.Expr {
+			return clause.Expr{SQL: averageRating + " " + comparisons[operator] + " ?", Vars: []interface{}{rating}}
+		}, nil
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnsupportedCurrency = errors.New("currency is not supported")
+
+// CurrencySettings returns the currency configuration, falling back to USD as the base currency
+func CurrencySettings(db *gorm.DB) (models.CurrencySetting, error) {
+	var setting models.CurrencySetting
+	if err := db.Order("id ASC").First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.CurrencySetting{BaseCurrency: "USD"}, nil
+		}
+		return setting, err
+	}
+	return setting, nil
+}
+
+// ProductPricing is the price set of a product in the currency of a Converter
+type ProductPricing struct {
+	Price          utils.Money
+	CompareAtPrice *utils.Money
+	SalePrice      *utils.Money
+}
+
+// Converter converts amounts into a target currency with the rates of the currency table.
+// Fixed prices from the price list of the target currency win over converted prices.
+type Converter struct {
+	Base   string
+	Target string
+	rates  map[string]float64
+	prices map[uint]models.ProductPrice
+}
+
+// NewConverter returns a converter into target, or into the base currency when target is empty
+func NewConverter(db *gorm.DB, target string) (*Converter, error) {
+	setting, err := CurrencySettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var currencies []models.Currency
+	if err := db.Where("is_active = true").Find(&currencies).Error; err != nil {
+		return nil, err
+	}
+
+	converter := &Converter{
+		Base:   strings.ToUpper(setting.BaseCurrency),
+		Target: strings.ToUpper(strings.TrimSpace(target)),
+		rates:  make(map[string]float64),
+		prices: make(map[uint]models.ProductPrice),
+	}
+	for _, currency := range currencies {
+		converter.rates[strings.ToUpper(currency.Code)] = currency.Rate
+	}
+	converter.rates[converter.Base] = 1
+
+	if converter.Target == "" {
+		converter.Target = converter.Base
+	}
+	if _, ok := converter.rates[converter.Target]; !ok {
+		return nil, ErrUnsupportedCurrency
+	}
+
+	return converter, nil
+}
+
+// Rate returns the units of the target currency worth one unit of the base currency
+func (c *Converter) Rate() float64 {
+	return c.rates[c.Target]
+}
+
+// Convert converts an amount in currency from into the target currency, an empty currency being
+// the base currency. Amounts in a currency that is unknown or inactive cannot be converted.
+func (c *Converter) Convert(amount utils.Money, from string) (utils.Money, error) {
+	from = strings.ToUpper(strings.TrimSpace(from))
+	if from == "" {
+		from = c.Base
+	}
+	if from == c.Target {
+		return amount, nil
+	}
+	source, ok := c.rates[from]
+	if !ok || source <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	if from == c.Base {
+		return amount.MulRate(c.Rate()), nil
+	}
+	if c.Target == c.Base {
+		return amount.DivRate(source), nil
+	}
+	return amount.MulRate(c.Rate() / source), nil
+}
+
+// FromBase converts a base currency amount into the target currency
+func (c *Converter) FromBase(amount utils.Money) utils.Money {
+	return amount.MulRate(c.Rate())
+}
+
+// ToBase converts a target currency amount back into the base currency
+func (c *Converter) ToBase(amount utils.Money) utils.Money {
+	return amount.DivRate(c.Rate())
+}
+
+// LoadPriceLists loads the fixed target currency prices of the given products
+func (c *Converter) LoadPriceLists(db *gorm.DB, productIDs []uint) error {
+	if len(productIDs) == 0 || c.Target == c.Base {
+		return nil
+	}
+
+	var prices []models.ProductPrice
+	if err := db.Where("currency = ? AND product_id IN ?", c.Target, productIDs).Find(&prices).Error; err != nil {
+		return err
+	}
+	for _, price := range prices {
+		c.prices[price.ProductID] = price
+	}
+	return nil
+}
+
+// ProductPricing returns the prices of a product in the target currency. LoadPriceLists
+// must have been called for the product for its price list to be used.
+func (c *Converter) ProductPricing(productID uint, from string, price utils.Money, compareAt *utils.Money, sale *utils.Money) (ProductPricing, error) {
+	convert := func(amount *utils.Money) (*utils.Money, error) {
+		if amount == nil {
+			return nil, nil
+		}
+		converted, err := c.Convert(*amount, from)
+		return &converted, err
+	}
+
+	if list, ok := c.prices[productID]; ok {
+		pricing := ProductPricing{Price: list.Price, CompareAtPrice: list.CompareAtPrice, SalePrice: list.SalePrice}
+		if pricing.SalePrice == nil {
+			var err error
+			if pricing.SalePrice, err = convert(sale); err != nil {
+				return ProductPricing{}, err
+			}
+		}
+		return pricing, nil
+	}
+
+	var pricing ProductPricing
+	var err error
+	if pricing.Price, err = c.Convert(price, from); err != nil {
+		return ProductPricing{}, err
+	}
+	if pricing.CompareAtPrice, err = convert(compareAt); err != nil {
+		return ProductPricing{}, err
+	}
+	if pricing.SalePrice, err = convert(sale); err != nil {
+		return ProductPricing{}, err
+	}
+	return pricing, nil
+}
+
+// UnitPrice returns the price a product, or its variant when not nil, sells for at the given time
+// in the target currency. A variant priced on its own is converted from the currency of the
+// product, otherwise the price list of the product is used when LoadPriceLists loaded it.
+func (c *Converter) UnitPrice(product models.Product, variant *models.ProductVariant, at time.Time) (utils.Money, error) {
+	if variant != nil && !product.OnSale(at) && (variant.Price != nil || variant.OnSale(at)) {
+		return c.Convert(variant.EffectivePrice(product, at), product.Currency)
+	}
+	pricing, err := c.ProductPricing(product.ID, product.Currency, product.Price, nil, product.SalePrice)
+	if err != nil {
+		return 0, err
+	}
+	if product.OnSale(at) && pricing.SalePrice != nil {
+		return *pricing.SalePrice, nil
+	}
+	return pricing.Price, nil
+}
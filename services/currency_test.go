@@ -0,0 +1,87 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConverterConvert(t *testing.T) {
+	rates := map[string]float64{"USD": 1, "EUR": 0.9, "GBP": 0.8}
+
+	tests := []struct {
+		name   string
+		target string
+		amount utils.Money
+		from   string
+		want   utils.Money
+		err    error
+	}{
+		{"same currency", "EUR", 1000, "eur", 1000, nil},
+		{"empty is the base currency", "EUR", 1000, "", 900, nil},
+		{"from base", "EUR", 1000, "USD", 900, nil},
+		{"to base", "USD", 900, "EUR", 1000, nil},
+		{"between two currencies", "GBP", 900, "EUR", 800, nil},
+		{"unknown currency", "EUR", 1000, "XYZ", 0, ErrUnsupportedCurrency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := &Converter{Base: "USD", Target: test.target, rates: rates}
+			got, err := converter.Convert(test.amount, test.from)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Convert(%s, %q) error = %v, want %v", test.amount, test.from, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("Convert(%s, %q) = %s, want %s", test.amount, test.from, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConverterUnitPrice(t *testing.T) {
+	now := time.Now()
+	ended := now.Add(-time.Hour)
+	product := func(currency string, price utils.Money, sale *utils.Money, saleEnd *time.Time) models.Product {
+		p := models.Product{Currency: currency, Price: price, SalePrice: sale, SaleEndDate: saleEnd}
+		p.ID = 1
+		return p
+	}
+	listed := map[uint]models.ProductPrice{1: {ProductID: 1, Currency: "EUR", Price: 950}}
+
+	tests := []struct {
+		name    string
+		product models.Product
+		variant *models.ProductVariant
+		prices  map[uint]models.ProductPrice
+		want    utils.Money
+		err     error
+	}{
+		{"converted from the base currency", product("USD", 1000, nil, nil), nil, nil, 900, nil},
+		{"converted from another currency", product("GBP", 800, nil, nil), nil, nil, 900, nil},
+		{"on sale", product("USD", 1000, moneyPtr(800), nil), nil, nil, 720, nil},
+		{"sale ended", product("USD", 1000, moneyPtr(800), &ended), nil, nil, 900, nil},
+		{"price list", product("USD", 1000, nil, nil), nil, listed, 950, nil},
+		{"price list without a sale price", product("USD", 1000, moneyPtr(800), nil), nil, listed, 720, nil},
+		{"variant priced on its own", product("USD", 1000, nil, nil), &models.ProductVariant{Price: moneyPtr(1200)}, listed, 1080, nil},
+		{"variant on sale", product("USD", 1000, nil, nil), &models.ProductVariant{SalePrice: moneyPtr(500)}, nil, 450, nil},
+		{"variant at the product price", product("USD", 1000, nil, nil), &models.ProductVariant{}, listed, 950, nil},
+		{"product sale wins over the variant price", product("USD", 1000, moneyPtr(800), nil), &models.ProductVariant{Price: moneyPtr(1200)}, nil, 720, nil},
+		{"inactive currency", product("XYZ", 1000, nil, nil), nil, nil, 0, ErrUnsupportedCurrency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := &Converter{Base: "USD", Target: "EUR", rates: map[string]float64{"USD": 1, "EUR": 0.9, "GBP": 0.8}, prices: test.prices}
+			got, err := converter.UnitPrice(test.product, test.variant, now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("UnitPrice error = %v, want %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("UnitPrice = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
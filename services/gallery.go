@@ -0,0 +1,214 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotInGallery     = errors.New("the images must belong to the product")
+	ErrForeignVariant   = errors.New("the variant must belong to the product")
+	ErrColorlessPrimary = errors.New("only an image with a color can be the primary image of its color")
+)
+
+// GalleryImageInput is an image added to the gallery of a product
+type GalleryImageInput struct {
+	ImageID        *uint  // Uploaded image
+	Image          string // Base64 encoded image, instead of ImageID
+	AltText        string
+	Color          *string
+	VariantID      *uint // Shows the image for one variant only
+	IsPrimary      bool
+	IsColorPrimary bool
+}
+
+// GalleryImageUpdate replaces the description of a gallery image. Leaving out Color or
+// VariantID clears them.
+type GalleryImageUpdate struct {
+	AltText        string
+	Color          *string
+	VariantID      *uint
+	IsPrimary      bool
+	IsColorPrimary bool
+}
+
+// CoverImage narrows a preload of product images to the cover of each product, its primary
+// image or else the first image by position
+func CoverImage(db *gorm.DB) *gorm.DB {
+	return db.Where(`product_images.id = (SELECT covers.id FROM product_images AS covers
+		WHERE covers.product_id = product_images.product_id AND covers.variant_id IS NULL
+		ORDER BY covers.is_primary DESC, covers.position ASC, covers.id ASC LIMIT 1)`)
+}
+
+// GalleryOrder orders the images of a product as the gallery shows them
+func GalleryOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("product_images.position ASC, product_images.id ASC")
+}
+
+// ProductGallery returns every image of a product, variant images included, in gallery order
+func ProductGallery(db *gorm.DB, productID uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := db.Where("product_id = ?", productID).Scopes(GalleryOrder).Find(&images).Error
+	return images, err
+}
+
+// AddGalleryImages adds images to the end of the gallery of a product
+func AddGalleryImages(tx *gorm.DB, productID uint, inputs []GalleryImageInput) ([]models.ProductImage, error) {
+	var last struct{ Position *int }
+	if err := tx.Model(&models.ProductImage{}).Select("MAX(position) AS position").
+		Where("product_id = ?", productID).Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	position := 0
+	if last.Position != nil {
+		position = *last.Position + 1
+	}
+
+	images := make([]models.ProductImage, 0, len(inputs))
+	for _, input := range inputs {
+		if err := checkGalleryVariant(tx, productID, input.VariantID); err != nil {
+			return nil, err
+		}
+		image := models.ProductImage{
+			ProductID:   productID,
+			Color:       input.Color,
+			VariantID:   input.VariantID,
+			Position:    position,
+			StoredImage: models.StoredImage{ImageID: input.ImageID, Image: input.Image, AltText: input.AltText},
+		}
+		if err := tx.Create(&image).Error; err != nil {
+			return nil, err
+		}
+		position++
+
+		if err := setPrimary(tx, &image, input.IsPrimary, input.IsColorPrimary); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// UpdateGalleryImage describes an image of a product anew
+func UpdateGalleryImage(tx *gorm.DB, productID uint, imageID uint, update GalleryImageUpdate) (*models.ProductImage, error) {
+	image, err := galleryImage(tx, productID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGalleryVariant(tx, productID, update.VariantID); err != nil {
+		return nil, err
+	}
+
+	// the primary image of a color stops being one when its color changes
+	if image.IsColorPrimary && (update.Color == nil || image.Color == nil || *update.Color != *image.Color) {
+		image.IsColorPrimary = false
+	}
+	image.AltText = update.AltText
+	image.Color = update.Color
+	image.VariantID = update.VariantID
+	if err := tx.Model(image).Select("alt_text", "color", "variant_id", "is_color_primary").Updates(image).Error; err != nil {
+		return nil, err
+	}
+	return image, setPrimary(tx, image, update.IsPrimary, update.IsColorPrimary)
+}
+
+// ReorderGallery moves the images listed to the front of the gallery of a product in the order
+// given. The images left out follow in their current order.
+func ReorderGallery(tx *gorm.DB, productID uint, imageIDs []uint) error {
+	images, err := ProductGallery(tx, productID)
+	if err != nil {
+		return err
+	}
+	positions := make(map[uint]int, len(images))
+	for _, image := range images {
+		positions[image.ID] = -1
+	}
+	for i, id := range imageIDs {
+		position, ok := positions[id]
+		if !ok || position != -1 {
+			return ErrNotInGallery
+		}
+		positions[id] = i
+	}
+	next := len(imageIDs)
+	for _, image := range images {
+		if positions[image.ID] == -1 {
+			positions[image.ID] = next
+			next++
+		}
+	}
+
+	for _, image := range images {
+		if image.Position == positions[image.ID] {
+			continue
+		}
+		if err := tx.Model(&models.ProductImage{}).Where("id = ?", image.ID).
+			Update("position", positions[image.ID]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteGalleryImage removes an image from the gallery of a product. The stored files stay, other
+// records may show the same upload.
+func DeleteGalleryImage(tx *gorm.DB, productID uint, imageID uint) error {
+	image, err := galleryImage(tx, productID, imageID)
+	if err != nil {
+		return err
+	}
+	return tx.Delete(image).Error
+}
+
+func galleryImage(tx *gorm.DB, productID uint, imageID uint) (*models.ProductImage, error) {
+	var image models.ProductImage
+	if err := tx.Where("id = ? AND product_id = ?", imageID, productID).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInGallery
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+func checkGalleryVariant(tx *gorm.DB, productID uint, variantID *uint) error {
+	if variantID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *variantID, productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrForeignVariant
+	}
+	return nil
+}
+
+// setPrimary makes an image the cover of its product and of its color, or stops it being one.
+// The image replaces the former primary image.
+func setPrimary(tx *gorm.DB, image *models.ProductImage, primary bool, colorPrimary bool) error {
+	if colorPrimary && image.Color == nil {
+		return ErrColorlessPrimary
+	}
+
+	if primary && !image.IsPrimary {
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ? AND is_primary", image.ProductID).
+			Update("is_primary", false).Error; err != nil {
+			return err
+		}
+	}
+	if colorPrimary && !image.IsColorPrimary {
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ? AND color = ? AND is_color_primary", image.ProductID, *image.Color).
+			Update("is_color_primary", false).Error; err != nil {
+			return err
+		}
+	}
+	if primary != image.IsPrimary || colorPrimary != image.IsColorPrimary {
+		image.IsPrimary, image.IsColorPrimary = primary, colorPrimary
+		return tx.Model(image).Select("is_primary", "is_color_primary").Updates(image).Error
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrGiftCardNotFound     = errors.New("gift card not found or inactive")
+	ErrGiftCardExpired      = errors.New("gift card has expired")
+	ErrGiftCardEmpty        = errors.New("gift card has no balance left")
+	ErrInsufficientCredit   = errors.New("insufficient store credit")
+	ErrInvalidCreditAmount  = errors.New("amount must not be zero")
+	ErrGiftCardCurrencyDiff = errors.New("gift card currency does not match the order currency")
+)
+
+// RedeemGiftCard spends up to amount from the gift card for an order and returns the amount redeemed
+func RedeemGiftCard(tx *gorm.DB, code string, amount utils.Money, currency string, userID uint, orderID uint) (utils.Money, error) {
+	var card models.GiftCard
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ? AND is_active = true", code).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrGiftCardNotFound
+		}
+		return 0, err
+	}
+
+	if card.ExpirationDate != nil && time.Now().After(*card.ExpirationDate) {
+		return 0, ErrGiftCardExpired
+	}
+	if currency != "" && card.Currency != currency {
+		return 0, ErrGiftCardCurrencyDiff
+	}
+	if card.Balance <= 0 {
+		return 0, ErrGiftCardEmpty
+	}
+
+	redeemed := utils.MinMoney(card.Balance, amount)
+	if redeemed <= 0 {
+		return 0, nil
+	}
+
+	card.Balance = card.Balance - redeemed
+	if err := tx.Model(&card).Update("balance", card.Balance).Error; err != nil {
+		return 0, err
+	}
+
+	entry := models.GiftCardTransaction{
+		GiftCardID:      card.ID,
+		OrderID:         &orderID,
+		UserID:          &userID,
+		TransactionType: "redeem",
+		Amount:          -redeemed,
+		BalanceAfter:    card.Balance,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return 0, err
+	}
+
+	return redeemed, nil
+}
+
+// AdjustGiftCard adds (or with a negative amount removes) value from a gift card and ledgers it
+func AdjustGiftCard(tx *gorm.DB, cardID uint, amount utils.Money, transactionType string, orderID *uint, userID *uint, note string) (*models.GiftCardTransaction, error) {
+	if amount == 0 {
+		return nil, ErrInvalidCreditAmount
+	}
+
+	var card models.GiftCard
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, cardID).Error; err != nil {
+		return nil, err
+	}
+
+	balance := card.Balance + amount
+	if balance < 0 {
+		return nil, ErrGiftCardEmpty
+	}
+	if err := tx.Model(&card).Update("balance", balance).Error; err != nil {
+		return nil, err
+	}
+
+	entry := models.GiftCardTransaction{
+		GiftCardID:      card.ID,
+		OrderID:         orderID,
+		UserID:          userID,
+		TransactionType: transactionType,
+		Amount:          amount,
+		BalanceAfter:    balance,
+		Note:            note,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// StoreCreditBalance returns the store credit balance of a customer
+func StoreCreditBalance(db *gorm.DB, userID uint) (utils.Money, error) {
+	var account models.StoreCreditAccount
+	if err := db.Where("user_id = ?", userID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// AdjustStoreCredit changes a customer's store credit by amount and ledgers the change
+func AdjustStoreCredit(tx *gorm.DB, userID uint, amount utils.Money, transactionType string, orderID *uint, createdBy *uint, note string) (*models.StoreCreditTransaction, error) {
+	if amount == 0 {
+		return nil, ErrInvalidCreditAmount
+	}
+
+	account := models.StoreCreditAccount{UserID: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&account).Error; err != nil {
+		return nil, err
+	}
+
+	balance := account.Balance + amount
+	if balance < 0 {
+		return nil, ErrInsufficientCredit
+	}
+	if err := tx.Model(&account).Update("balance", balance).Error; err != nil {
+		return nil, err
+	}
+
+	entry := models.StoreCreditTransaction{
+		UserID:          userID,
+		OrderID:         orderID,
+		TransactionType: transactionType,
+		Amount:          amount,
+		BalanceAfter:    balance,
+		Note:            note,
+		CreatedBy:       createdBy,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// RedeemStoreCredit spends up to amount of the customer's store credit on an order
+// and returns the amount redeemed
+func RedeemStoreCredit(tx *gorm.DB, userID uint, amount utils.Money, orderID uint) (utils.Money, error) {
+	balance, err := StoreCreditBalance(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	redeemed := utils.MinMoney(balance, amount)
+	if redeemed <= 0 {
+		return 0, nil
+	}
+
+	if _, err := AdjustStoreCredit(tx, userID, -redeemed, "redeem", &orderID, nil, ""); err != nil {
+		return 0, err
+	}
+	return redeemed, nil
+}
+
+// ReverseOrderRedemptions gives back every gift card and store credit amount spent on an order and
+// marks their payments refunded, so revenue reports stop counting them. Orders that were already
+// reversed are left untouched.
+func ReverseOrderRedemptions(tx *gorm.DB, orderID uint) error {
+	if err := tx.Model(&models.Payment{}).
+		Where("order_id = ? AND payment_method IN ? AND payment_status = 'completed'", orderID, []string{"gift_card", "store_credit"}).
+		Update("payment_status", "refunded").Error; err != nil {
+		return err
+	}
+
+	var refunds int64
+	if err := tx.Model(&models.GiftCardTransaction{}).Where("order_id = ? AND transaction_type = 'reversal'", orderID).Count(&refunds).Error; err != nil {
+		return err
+	}
+	if refunds == 0 {
+		if err := reverseGiftCardRedemptions(tx, orderID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&models.StoreCreditTransaction{}).Where("order_id = ? AND transaction_type = 'reversal'", orderID).Count(&refunds).Error; err != nil {
+		return err
+	}
+	if refunds == 0 {
+		return reverseStoreCreditRedemptions(tx, orderID)
+	}
+
+	return nil
+}
+
+func reverseGiftCardRedemptions(tx *gorm.DB, orderID uint) error {
+	var cardEntries []models.GiftCardTransaction
+	if err := tx.Where("order_id = ? AND transaction_type = 'redeem'", orderID).Find(&cardEntries).Error; err != nil {
+		return err
+	}
+	for _, entry := range cardEntries {
+		if _, err := AdjustGiftCard(tx, entry.GiftCardID, -entry.Amount, "reversal", &orderID, entry.UserID, "order cancelled"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reverseStoreCreditRedemptions(tx *gorm.DB, orderID uint) error {
+	var creditEntries []models.StoreCreditTransaction
+	if err := tx.Where("order_id = ? AND transaction_type = 'redeem'", orderID).Find(&creditEntries).Error; err != nil {
+		return err
+	}
+	for _, entry := range creditEntries {
+		if _, err := AdjustStoreCredit(tx, entry.UserID, -entry.Amount, "reversal", &orderID, nil, "order cancelled"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"backend/models"
+	"backend/storage"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// imageTables are the image records, which used to keep their data in a bytea "image" column
+var imageTables = []struct {
+	model interface{}
+	table string
+}{
+	{&models.ProductImage{}, "product_images"},
+	{&models.BrandImage{}, "brand_images"},
+	{&models.CategoryImage{}, "category_images"},
+	{&models.ContentImage{}, "content_images"},
+}
+
+// ImageMigrationResult counts what MigrateImagesToStore did
+type ImageMigrationResult struct {
+	Moved     int // Images moved out of the database
+	Processed int // Images already in the blob store given their renditions
+	Skipped   int // Images that aren't valid images, left as they are
+}
+
+// MigrateImagesToStore runs the images still kept in the database, and those stored before the
+// image pipeline existed, through the pipeline into the default blob store. The data of a moved
+// image is cleared so an interrupted run picks up where it stopped. dropColumns removes the
+// emptied bytea columns afterwards.
+func MigrateImagesToStore(db *gorm.DB, batchSize int, dropColumns bool) (ImageMigrationResult, error) {
+	var result ImageMigrationResult
+	if err := db.Migrator().AutoMigrate(&models.Image{}); err != nil {
+		return result, err
+	}
+
+	for _, images := range imageTables {
+		if !db.Migrator().HasTable(images.table) {
+			continue
+		}
+		for _, field := range []string{"ImageID", "ImageKey", "Renditions"} {
+			if !db.Migrator().HasColumn(images.model, field) {
+				if err := db.Migrator().AddColumn(images.model, field); err != nil {
+					return result, err
+				}
+			}
+		}
+
+		hasData := db.Migrator().HasColumn(images.table, "image")
+		lastID := uint(0)
+		for {
+			var rows []struct {
+				ID       uint
+				ImageKey string
+				Image    []byte
+			}
+			query := db.Table(images.table).Where("id > ?", lastID)
+			if hasData {
+				query = query.Select("id, image_key, image").
+					Where("(image IS NOT NULL AND image_key = '') OR (image_key <> '' AND image_id IS NULL)")
+			} else {
+				query = query.Select("id, image_key").Where("image_key <> '' AND image_id IS NULL")
+			}
+			if err := query.Order("id ASC").Limit(batchSize).Scan(&rows).Error; err != nil {
+				return result, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				lastID = row.ID
+				data := row.Image
+				if row.ImageKey != "" {
+					var err error
+					if data, err = storage.Default.Get(row.ImageKey); err != nil {
+						if errors.Is(err, storage.ErrNotFound) {
+							log.Printf("%s %d: blob %s is missing", images.table, row.ID, row.ImageKey)
+							result.Skipped++
+							continue
+						}
+						return result, err
+					}
+				}
+
+				update := map[string]interface{}{}
+				if hasData {
+					update["image"] = nil
+				}
+				if len(data) != 0 {
+					image, err := models.StoreImage(db, data)
+					if models.IsImageError(err) {
+						log.Printf("%s %d: %v", images.table, row.ID, err)
+						result.Skipped++
+						continue
+					}
+					if err != nil {
+						return result, err
+					}
+					update["image_id"] = image.ID
+					update["image_key"] = image.Key
+					update["renditions"] = image.Renditions
+					if row.ImageKey != "" {
+						result.Processed++
+					} else {
+						result.Moved++
+					}
+				}
+				if err := db.Table(images.table).Where("id = ?", row.ID).Updates(update).Error; err != nil {
+					return result, err
+				}
+			}
+			log.Printf("%s: %d moved, %d processed so far", images.table, result.Moved, result.Processed)
+		}
+
+		if dropColumns && hasData {
+			var left int64
+			if err := db.Table(images.table).Where("image IS NOT NULL").Count(&left).Error; err != nil {
+				return result, err
+			}
+			if left > 0 {
+				log.Printf("%s: keeping the image column, %d images could not be moved", images.table, left)
+				continue
+			}
+			if err := db.Migrator().DropColumn(images.table, "image"); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNothingToCredit      = errors.New("credit note has no lines or shipping to credit")
+	ErrCreditExceedsInvoice = errors.New("credit exceeds what is left on the invoice")
+	ErrUnknownInvoiceLine   = errors.New("order item is not on the invoice")
+)
+
+var invoicePrefixes = map[string]string{"invoice": "INV", "credit_note": "CN"}
+
+// InvoiceSettings returns the seller details printed on invoices
+func InvoiceSettings(db *gorm.DB) (models.InvoiceSetting, error) {
+	var setting models.InvoiceSetting
+	if err := db.Order("id ASC").First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.InvoiceSetting{}, nil
+		}
+		return setting, err
+	}
+	return setting, nil
+}
+
+// nextInvoiceNumber takes the next number of a sequence. It must run inside the transaction
+// that stores the invoice, so a rolled back invoice gives its number back.
+func nextInvoiceNumber(tx *gorm.DB, name string) (string, error) {
+	sequence := models.InvoiceSequence{Name: name, Prefix: invoicePrefixes[name], NextNumber: 1}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&sequence).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(&sequence).Error; err != nil {
+		return "", err
+	}
+	// Update writes the new value back into sequence, so the number is taken before it
+	number := fmt.Sprintf("%s-%08d", sequence.Prefix, sequence.NextNumber)
+	if err := tx.Model(&sequence).Update("next_number", sequence.NextNumber+1).Error; err != nil {
+		return "", err
+	}
+	return number, nil
+}
+
+// IssueInvoice returns the invoice of an order, issuing it first when the order has none yet
+func IssueInvoice(tx *gorm.DB, orderID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Preload("Lines").Where("order_id = ? AND invoice_type = 'invoice'", orderID).First(&invoice).Error
+	if err == nil {
+		return &invoice, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// lock the order so two concurrent requests can't both invoice it
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").Preload("OrderItems.Product").Preload("OrderItems.Variant.Values.Option").First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Preload("Lines").Where("order_id = ? AND invoice_type = 'invoice'", orderID).First(&invoice).Error; err == nil {
+		return &invoice, nil
+	}
+
+	number, err := nextInvoiceNumber(tx, "invoice")
+	if err != nil {
+		return nil, err
+	}
+
+	invoice = models.Invoice{
+		Number:          number,
+		InvoiceType:     "invoice",
+		OrderID:         order.ID,
+		CustomerName:    order.User.Name,
+		CustomerEmail:   order.User.Email,
+		ShippingAddress: order.OrderShippingAddress,
+		ItemTotal:       order.ItemPrice,
+		DiscountAmount:  order.DiscountAmount,
+		ShippingCost:    order.ShippingCost,
+		TaxAmount:       order.TaxAmount,
+		Total:           order.TotalPrice,
+		IssuedAt:        time.Now(),
+	}
+	if order.Currency != nil {
+		invoice.Currency = *order.Currency
+	}
+	for _, item := range order.OrderItems {
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Description: itemDescription(item),
+			SKU:         itemSKU(item),
+			Quantity:    item.Quantity,
+			UnitPrice:   item.PriceAtPurchase,
+			TaxRate:     item.TaxRate,
+			TaxAmount:   item.TaxAmount,
+			Total:       item.PriceAtPurchase.Mul(item.Quantity),
+		})
+	}
+
+	if err := tx.Create(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// CreditLine is a quantity of an order item that is credited
+type CreditLine struct {
+	OrderItemID uint `binding:"required"`
+	Quantity    int  `binding:"required,gt=0"`
+}
+
+// IssueCreditNote credits items and shipping of an invoiced order. Discounts and tax are
+// credited in proportion to the credited amounts, and the credited quantities and total can
+// never exceed what is left on the invoice.
+func IssueCreditNote(tx *gorm.DB, orderID uint, lines []CreditLine, shipping utils.Money, reason string, issuedBy *uint) (*models.Invoice, error) {
+	if len(lines) == 0 && shipping <= 0 {
+		return nil, ErrNothingToCredit
+	}
+
+	invoice, err := IssueInvoice(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+
+	var previous []models.Invoice
+	if err := tx.Preload("Lines").Where("invoice_id = ? AND invoice_type = 'credit_note'", invoice.ID).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	credited := make(map[uint]int)
+	var creditedShipping, creditedTotal utils.Money
+	for _, note := range previous {
+		creditedShipping += note.ShippingCost
+		creditedTotal += note.Total
+		for _, line := range note.Lines {
+			credited[line.OrderItemID] += line.Quantity
+		}
+	}
+
+	invoiced := make(map[uint]models.InvoiceLine)
+	for _, line := range invoice.Lines {
+		invoiced[line.OrderItemID] = line
+	}
+
+	note := models.Invoice{
+		InvoiceType:     "credit_note",
+		OrderID:         invoice.OrderID,
+		InvoiceID:       &invoice.ID,
+		Currency:        invoice.Currency,
+		CustomerName:    invoice.CustomerName,
+		CustomerEmail:   invoice.CustomerEmail,
+		ShippingAddress: invoice.ShippingAddress,
+		Reason:          reason,
+		IssuedBy:        issuedBy,
+		IssuedAt:        time.Now(),
+	}
+
+	for _, line := range lines {
+		original, ok := invoiced[line.OrderItemID]
+		if !ok {
+			return nil, ErrUnknownInvoiceLine
+		}
+		if credited[line.OrderItemID]+line.Quantity > original.Quantity {
+			return nil, ErrCreditExceedsInvoice
+		}
+		credited[line.OrderItemID] += line.Quantity
+
+		creditLine := models.InvoiceLine{
+			OrderItemID: original.OrderItemID,
+			ProductID:   original.ProductID,
+			Description: original.Description,
+			SKU:         original.SKU,
+			Quantity:    line.Quantity,
+			UnitPrice:   original.UnitPrice,
+			TaxRate:     original.TaxRate,
+			TaxAmount:   original.TaxAmount.MulDiv(utils.Money(line.Quantity), utils.Money(original.Quantity)),
+			Total:       original.UnitPrice.Mul(line.Quantity),
+		}
+		note.Lines = append(note.Lines, creditLine)
+		note.ItemTotal += creditLine.Total
+		note.TaxAmount += creditLine.TaxAmount
+	}
+
+	if shipping > 0 {
+		if creditedShipping+shipping > invoice.ShippingCost {
+			return nil, ErrCreditExceedsInvoice
+		}
+		note.ShippingCost = shipping
+		note.TaxAmount += order.ShippingTax.MulDiv(shipping, invoice.ShippingCost)
+	}
+
+	note.DiscountAmount = invoice.DiscountAmount.MulDiv(note.ItemTotal, invoice.ItemTotal)
+	note.Total = note.ItemTotal - note.DiscountAmount + note.ShippingCost
+	if !order.PricesIncludeTax {
+		note.Total += note.TaxAmount
+	}
+	if creditedTotal+note.Total > invoice.Total {
+		return nil, ErrCreditExceedsInvoice
+	}
+
+	if note.Number, err = nextInvoiceNumber(tx, "credit_note"); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&note).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// itemDescription names an order line, adding the option values of its variant
+func itemDescription(item models.OrderItem) string {
+	var values []string
+	if item.Variant != nil {
+		SortVariantValues(item.Variant.Values)
+		for _, value := range item.Variant.Values {
+			values = append(values, value.Value)
+		}
+	} else {
+		// lines ordered as child products before variants existed
+		for _, value := range []string{item.Product.Color, item.Product.Size} {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return item.Product.Name
+	}
+	return fmt.Sprintf("%s (%s)", item.Product.Name, strings.Join(values, " / "))
+}
+
+// itemSKU returns the SKU of the variant of an order line, or of its product
+func itemSKU(item models.OrderItem) string {
+	if item.Variant != nil {
+		return item.Variant.SKU
+	}
+	return item.Product.SKU
+}
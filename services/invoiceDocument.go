@@ -0,0 +1,277 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"gorm.io/gorm"
+)
+
+// PackingSlip lists what has to go in the parcel of an order, without any prices
+type PackingSlip struct {
+	OrderIdentifier string
+	OrderDate       string
+	CustomerName    string
+	ShippingAddress string
+	Items           []PackingSlipItem
+}
+
+type PackingSlipItem struct {
+	SKU         string
+	Description string
+	Quantity    int
+}
+
+// LoadPackingSlips builds the packing slips of the given orders in the order they were placed
+func LoadPackingSlips(db *gorm.DB, orderIDs []uint) ([]PackingSlip, error) {
+	var orders []models.Order
+	if err := db.Preload("User").Preload("OrderItems.Product").Preload("OrderItems.Variant.Values.Option").Where("id IN ?", orderIDs).Order("created_at ASC, id ASC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	slips := make([]PackingSlip, 0, len(orders))
+	for _, order := range orders {
+		slip := PackingSlip{
+			OrderIdentifier: order.OrderIdentifier,
+			OrderDate:       order.CreatedAt.Format("2006-01-02"),
+			CustomerName:    order.User.Name,
+			ShippingAddress: order.OrderShippingAddress,
+		}
+		for _, item := range order.OrderItems {
+			slip.Items = append(slip.Items, PackingSlipItem{
+				SKU:         itemSKU(item),
+				Description: itemDescription(item),
+				Quantity:    item.Quantity,
+			})
+		}
+		slips = append(slips, slip)
+	}
+	return slips, nil
+}
+
+// invoiceTitle is the heading of an invoice document
+func invoiceTitle(invoice models.Invoice) string {
+	if invoice.InvoiceType == "credit_note" {
+		return "Credit Note"
+	}
+	return "Invoice"
+}
+
+var documentFuncs = template.FuncMap{
+	"money": func(amount utils.Money) string { return amount.String() },
+	"title": invoiceTitle,
+	"date":  func(invoice models.Invoice) string { return invoice.IssuedAt.Format("2006-01-02") },
+	"lines": func(text string) []string { return strings.Split(strings.TrimSpace(text), "\n") },
+}
+
+const documentStyle = `<style>
+	body { font-family: Helvetica, Arial, sans-serif; font-size: 13px; color: #222; }
+	.page { max-width: 800px; margin: 0 auto 40px; page-break-after: always; }
+	.page:last-child { page-break-after: auto; }
+	h1 { font-size: 22px; margin-bottom: 4px; }
+	table { width: 100%; border-collapse: collapse; margin-top: 16px; }
+	th, td { padding: 6px 4px; border-bottom: 1px solid #ddd; text-align: left; }
+	td.amount, th.amount { text-align: right; }
+	.columns { display: flex; justify-content: space-between; margin-top: 16px; }
+	.totals { width: 300px; margin-left: auto; }
+	.footer { margin-top: 24px; color: #666; font-size: 11px; }
+</style>`
+
+var invoiceHTML = template.Must(template.New("invoice").Funcs(documentFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{title .Invoice}} {{.Invoice.Number}}</title>` + documentStyle + `</head>
+<body><div class="page">
+	<h1>{{title .Invoice}} {{.Invoice.Number}}</h1>
+	<div>Date: {{date .Invoice}}</div>
+	{{if .Invoice.Reason}}<div>Reason: {{.Invoice.Reason}}</div>{{end}}
+	<div class="columns">
+		<div>
+			<strong>{{.Seller.CompanyName}}</strong><br>
+			{{range lines .Seller.Address}}{{.}}<br>{{end}}
+			{{if .Seller.TaxNumber}}Tax number: {{.Seller.TaxNumber}}<br>{{end}}
+			{{.Seller.Email}}
+		</div>
+		<div>
+			<strong>{{.Invoice.CustomerName}}</strong><br>
+			{{.Invoice.CustomerEmail}}<br>
+			{{range lines .Invoice.ShippingAddress}}{{.}}<br>{{end}}
+		</div>
+	</div>
+	<table>
+		<tr><th>SKU</th><th>Description</th><th class="amount">Qty</th><th class="amount">Unit price</th><th class="amount">Tax</th><th class="amount">Total</th></tr>
+		{{range .Invoice.Lines}}
+		<tr><td>{{.SKU}}</td><td>{{.Description}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{money .UnitPrice}}</td><td class="amount">{{money .TaxAmount}}</td><td class="amount">{{money .Total}}</td></tr>
+		{{end}}
+	</table>
+	<table class="totals">
+		<tr><td>Items</td><td class="amount">{{money .Invoice.ItemTotal}}</td></tr>
+		{{if .Invoice.DiscountAmount}}<tr><td>Discount</td><td class="amount">-{{money .Invoice.DiscountAmount}}</td></tr>{{end}}
+		<tr><td>Shipping</td><td class="amount">{{money .Invoice.ShippingCost}}</td></tr>
+		<tr><td>Tax</td><td class="amount">{{money .Invoice.TaxAmount}}</td></tr>
+		<tr><th>Total</th><th class="amount">{{.Invoice.Currency}} {{money .Invoice.Total}}</th></tr>
+	</table>
+	{{if .Seller.Footer}}<div class="footer">{{.Seller.Footer}}</div>{{end}}
+</div></body></html>`))
+
+var packingSlipHTML = template.Must(template.New("packingSlip").Funcs(documentFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Packing slips</title>` + documentStyle + `</head>
+<body>{{range .Slips}}<div class="page">
+	<h1>Packing Slip {{.OrderIdentifier}}</h1>
+	<div>Order date: {{.OrderDate}}</div>
+	<div class="columns">
+		<div><strong>{{$.Seller.CompanyName}}</strong><br>{{range lines $.Seller.Address}}{{.}}<br>{{end}}</div>
+		<div><strong>Ship to: {{.CustomerName}}</strong><br>{{range lines .ShippingAddress}}{{.}}<br>{{end}}</div>
+	</div>
+	<table>
+		<tr><th>SKU</th><th>Description</th><th class="amount">Qty</th></tr>
+		{{range .Items}}<tr><td>{{.SKU}}</td><td>{{.Description}}</td><td class="amount">{{.Quantity}}</td></tr>{{end}}
+	</table>
+</div>{{end}}</body></html>`))
+
+// RenderInvoiceHTML writes an invoice or credit note as an HTML page
+func RenderInvoiceHTML(w io.Writer, invoice models.Invoice, seller models.InvoiceSetting) error {
+	return invoiceHTML.Execute(w, struct {
+		Invoice models.Invoice
+		Seller  models.InvoiceSetting
+	}{invoice, seller})
+}
+
+// RenderPackingSlipsHTML writes the packing slips as one HTML page that prints one slip per sheet
+func RenderPackingSlipsHTML(w io.Writer, slips []PackingSlip, seller models.InvoiceSetting) error {
+	return packingSlipHTML.Execute(w, struct {
+		Slips  []PackingSlip
+		Seller models.InvoiceSetting
+	}{slips, seller})
+}
+
+// newDocumentPDF returns an A4 document and a translator for the core fonts.
+// The core fonts only cover Latin-1, other characters are replaced.
+func newDocumentPDF() (*fpdf.Fpdf, func(string) string) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	return pdf, pdf.UnicodeTranslatorFromDescriptor("")
+}
+
+// pdfAddressBlock prints a multi line block at the given x position and returns the y below it
+func pdfAddressBlock(pdf *fpdf.Fpdf, tr func(string) string, x float64, y float64, heading string, lines ...string) float64 {
+	pdf.SetXY(x, y)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(85, 5, tr(heading), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range lines {
+		for _, part := range strings.Split(strings.TrimSpace(line), "\n") {
+			if part != "" {
+				pdf.SetX(x)
+				pdf.CellFormat(85, 5, tr(part), "", 2, "L", false, 0, "")
+			}
+		}
+	}
+	return pdf.GetY()
+}
+
+// RenderInvoicePDF writes an invoice or credit note as a PDF document
+func RenderInvoicePDF(w io.Writer, invoice models.Invoice, seller models.InvoiceSetting) error {
+	pdf, tr := newDocumentPDF()
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, tr(fmt.Sprintf("%s %s", invoiceTitle(invoice), invoice.Number)), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 5, "Date: "+invoice.IssuedAt.Format("2006-01-02"), "", 1, "L", false, 0, "")
+	if invoice.Reason != "" {
+		pdf.CellFormat(0, 5, tr("Reason: "+invoice.Reason), "", 1, "L", false, 0, "")
+	}
+
+	top := pdf.GetY() + 5
+	taxNumber := ""
+	if seller.TaxNumber != "" {
+		taxNumber = "Tax number: " + seller.TaxNumber
+	}
+	sellerEnd := pdfAddressBlock(pdf, tr, 15, top, seller.CompanyName, seller.Address, taxNumber, seller.Email)
+	customerEnd := pdfAddressBlock(pdf, tr, 110, top, invoice.CustomerName, invoice.CustomerEmail, invoice.ShippingAddress)
+	pdf.SetXY(15, max(sellerEnd, customerEnd)+8)
+
+	widths := []float64{30, 70, 15, 22, 20, 23}
+	pdf.SetFont("Helvetica", "B", 10)
+	for i, heading := range []string{"SKU", "Description", "Qty", "Unit price", "Tax", "Total"} {
+		align := "R"
+		if i < 2 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, heading, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range invoice.Lines {
+		pdf.CellFormat(widths[0], 6, tr(line.SKU), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, tr(line.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 6, fmt.Sprint(line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, line.UnitPrice.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 6, line.TaxAmount.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[5], 6, line.Total.String(), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	total := func(label string, amount string, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.SetX(115)
+		pdf.CellFormat(45, 6, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(35, 6, amount, "", 1, "R", false, 0, "")
+	}
+	total("Items", invoice.ItemTotal.String(), false)
+	if invoice.DiscountAmount != 0 {
+		total("Discount", "-"+invoice.DiscountAmount.String(), false)
+	}
+	total("Shipping", invoice.ShippingCost.String(), false)
+	total("Tax", invoice.TaxAmount.String(), false)
+	total("Total", invoice.Currency+" "+invoice.Total.String(), true)
+
+	if seller.Footer != "" {
+		pdf.Ln(8)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.MultiCell(0, 4, tr(seller.Footer), "", "L", false)
+	}
+
+	return pdf.Output(w)
+}
+
+// RenderPackingSlipsPDF writes the packing slips as one PDF document with a page per order
+func RenderPackingSlipsPDF(w io.Writer, slips []PackingSlip, seller models.InvoiceSetting) error {
+	pdf, tr := newDocumentPDF()
+
+	for _, slip := range slips {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "B", 18)
+		pdf.CellFormat(0, 10, tr("Packing Slip "+slip.OrderIdentifier), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 5, "Order date: "+slip.OrderDate, "", 1, "L", false, 0, "")
+
+		top := pdf.GetY() + 5
+		sellerEnd := pdfAddressBlock(pdf, tr, 15, top, seller.CompanyName, seller.Address)
+		customerEnd := pdfAddressBlock(pdf, tr, 110, top, "Ship to: "+slip.CustomerName, slip.ShippingAddress)
+		pdf.SetXY(15, max(sellerEnd, customerEnd)+8)
+
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, 7, "SKU", "B", 0, "L", false, 0, "")
+		pdf.CellFormat(120, 7, "Description", "B", 0, "L", false, 0, "")
+		pdf.CellFormat(20, 7, "Qty", "B", 1, "R", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		for _, item := range slip.Items {
+			pdf.CellFormat(40, 6, tr(item.SKU), "", 0, "L", false, 0, "")
+			pdf.CellFormat(120, 6, tr(item.Description), "", 0, "L", false, 0, "")
+			pdf.CellFormat(20, 6, fmt.Sprint(item.Quantity), "", 1, "R", false, 0, "")
+		}
+	}
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statementLog records the SQL a dry run session would have sent
+type statementLog struct {
+	logger.Interface
+	statements []string
+}
+
+func (l *statementLog) LogMode(logger.LogLevel) logger.Interface { return l }
+
+func (l *statementLog) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	l.statements = append(l.statements, sql)
+}
+
+// dryRun opens a session that builds the SQL of every query without a database
+func dryRun(t *testing.T) (*gorm.DB, *statementLog) {
+	t.Helper()
+	log := &statementLog{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, log
+}
+
+func TestNextInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		sequence string
+		want     string
+	}{
+		{"invoice", "INV-00000001"},
+		{"credit_note", "CN-00000001"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sequence, func(t *testing.T) {
+			db, log := dryRun(t)
+			number, err := nextInvoiceNumber(db, test.sequence)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if number != test.want {
+				t.Errorf("number = %s, want %s", number, test.want)
+			}
+
+			// the number is read from the locked sequence row and taken in the same transaction,
+			// so a concurrent or rolled back invoice can neither reuse nor skip it
+			want := []string{
+				`INSERT INTO "invoice_sequences"`,
+				`FOR UPDATE`,
+				`UPDATE "invoice_sequences" SET "next_number"=2 WHERE "name" = '` + test.sequence + `'`,
+			}
+			if len(log.statements) != len(want) {
+				t.Fatalf("statements = %q, want %d", log.statements, len(want))
+			}
+			if !strings.Contains(log.statements[0], "ON CONFLICT DO NOTHING") {
+				t.Errorf("sequence row is not created idempotently: %s", log.statements[0])
+			}
+			for i, fragment := range want {
+				if !strings.Contains(log.statements[i], fragment) {
+					t.Errorf("statement %d = %s, want it to contain %s", i, log.statements[i], fragment)
+				}
+			}
+		})
+	}
+}
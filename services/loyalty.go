@@ -0,0 +1,280 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLoyaltyInactive     = errors.New("loyalty program is not active")
+	ErrInsufficientPoints  = errors.New("insufficient loyalty points")
+	ErrBelowMinimumPoints  = errors.New("not enough points to redeem")
+	ErrInvalidPointsAmount = errors.New("points must not be zero")
+)
+
+// LoyaltySettings returns the loyalty configuration, falling back to an inactive default
+func LoyaltySettings(db *gorm.DB) (models.LoyaltySetting, error) {
+	var setting models.LoyaltySetting
+	if err := db.Order("id ASC").First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.LoyaltySetting{EarnRate: 1, RedemptionValue: 0.01}, nil
+		}
+		return setting, err
+	}
+	return setting, nil
+}
+
+// LoyaltyBalance returns the points balance of a customer
+func LoyaltyBalance(db *gorm.DB, userID uint) (int, error) {
+	var account models.LoyaltyAccount
+	if err := db.Where("user_id = ?", userID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// AdjustPoints changes a customer's points by the given amount and ledgers the change.
+// Only reversals may take the balance below zero, so clawing back earned points is always recorded.
+func AdjustPoints(tx *gorm.DB, userID uint, points int, transactionType string, orderID *uint, createdBy *uint, reason string) (*models.LoyaltyTransaction, error) {
+	if points == 0 {
+		return nil, ErrInvalidPointsAmount
+	}
+
+	account := models.LoyaltyAccount{UserID: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&account).Error; err != nil {
+		return nil, err
+	}
+
+	balance := account.Balance + points
+	if balance < 0 && transactionType != "earn_reversal" {
+		return nil, ErrInsufficientPoints
+	}
+	if err := tx.Model(&account).Update("balance", balance).Error; err != nil {
+		return nil, err
+	}
+
+	entry := models.LoyaltyTransaction{
+		UserID:          userID,
+		OrderID:         orderID,
+		TransactionType: transactionType,
+		Points:          points,
+		BalanceAfter:    balance,
+		Reason:          reason,
+		CreatedBy:       createdBy,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// RedeemLoyaltyPoints spends up to points for a discount of at most maxValue on an order.
+// It returns the discount value and the number of points actually used.
+func RedeemLoyaltyPoints(tx *gorm.DB, userID uint, points int, maxValue utils.Money, orderID uint) (utils.Money, int, error) {
+	setting, err := LoyaltySettings(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !setting.IsActive || setting.RedemptionValue <= 0 {
+		return 0, 0, ErrLoyaltyInactive
+	}
+	if points < setting.MinRedeemPoints {
+		return 0, 0, ErrBelowMinimumPoints
+	}
+
+	balance, err := LoyaltyBalance(tx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if points > balance {
+		return 0, 0, ErrInsufficientPoints
+	}
+
+	// never redeem more points than the order can absorb
+	used := min(points, int(math.Floor(maxValue.Float64()/setting.RedemptionValue)))
+	if used <= 0 {
+		return 0, 0, nil
+	}
+
+	if _, err := AdjustPoints(tx, userID, -used, "redeem", &orderID, nil, ""); err != nil {
+		return 0, 0, err
+	}
+	return utils.MinMoney(PointsValue(used, setting), maxValue), used, nil
+}
+
+// PointsValue returns the money a number of points is worth
+func PointsValue(points int, setting models.LoyaltySetting) utils.Money {
+	return utils.MoneyFromFloat(float64(points)).MulRate(setting.RedemptionValue)
+}
+
+// AwardOrderPoints credits the points earned on a delivered order. Orders that
+// already earned points are skipped so the award can safely run more than once.
+func AwardOrderPoints(tx *gorm.DB, orderID uint) (int, error) {
+	setting, err := LoyaltySettings(tx)
+	if err != nil || !setting.IsActive {
+		return 0, err
+	}
+
+	var earned int64
+	if err := tx.Model(&models.LoyaltyTransaction{}).Where("order_id = ? AND transaction_type = 'earn'", orderID).Count(&earned).Error; err != nil {
+		return 0, err
+	}
+	if earned > 0 {
+		return 0, nil
+	}
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return 0, err
+	}
+
+	var lines []struct {
+		PriceAtPurchase utils.Money
+		Quantity        int
+		CategoryID      uint
+	}
+	if err := tx.Model(&models.OrderItem{}).
+		Select("order_items.price_at_purchase, order_items.quantity, products.category_id").
+		Joins("LEFT JOIN products ON products.id = order_items.product_id").
+		Where("order_items.order_id = ?", orderID).
+		Scan(&lines).Error; err != nil {
+		return 0, err
+	}
+
+	multiplier, err := categoryMultipliers(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	// points are earned on what the customer actually paid for the items, in the base currency
+	netRatio := 1.0
+	if order.ItemPrice > 0 {
+		netRatio = math.Max(0, math.Min(1, (order.ItemPrice-order.DiscountAmount).Float64()/order.ItemPrice.Float64()))
+	}
+	if order.ExchangeRate > 0 {
+		netRatio /= order.ExchangeRate
+	}
+
+	total := 0.0
+	for _, line := range lines {
+		total += line.PriceAtPurchase.Mul(line.Quantity).Float64() * netRatio * setting.EarnRate * multiplier(line.CategoryID)
+	}
+
+	points := int(math.Floor(total))
+	if points <= 0 {
+		return 0, nil
+	}
+	if _, err := AdjustPoints(tx, order.UserID, points, "earn", &order.ID, nil, "order delivered"); err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// ReverseRefundedPoints claws back the share of the points earned on an order that a refund of
+// amount, in the currency of the order, makes up of the order total
+func ReverseRefundedPoints(tx *gorm.DB, orderID uint, amount utils.Money, reason string) error {
+	var order models.Order
+	if err := tx.Where("id = ?", orderID).First(&order).Error; err != nil {
+		return err
+	}
+	if amount <= 0 || order.TotalPrice <= 0 {
+		return nil
+	}
+	return ReverseOrderPoints(tx, orderID, amount.Float64()/order.TotalPrice.Float64(), false, reason)
+}
+
+// ReverseOrderPoints claws back the given fraction of the points earned on an order.
+// When restoreRedeemed is set the points spent on the order are given back as well.
+func ReverseOrderPoints(tx *gorm.DB, orderID uint, fraction float64, restoreRedeemed bool, reason string) error {
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return err
+	}
+
+	var totals struct {
+		Earned         int
+		EarnReversed   int
+		Redeemed       int
+		RedeemReversed int
+	}
+	if err := tx.Model(&models.LoyaltyTransaction{}).
+		Select(`
+			COALESCE(SUM(CASE WHEN transaction_type = 'earn' THEN points ELSE 0 END), 0) as earned,
+			COALESCE(SUM(CASE WHEN transaction_type = 'earn_reversal' THEN -points ELSE 0 END), 0) as earn_reversed,
+			COALESCE(SUM(CASE WHEN transaction_type = 'redeem' THEN -points ELSE 0 END), 0) as redeemed,
+			COALESCE(SUM(CASE WHEN transaction_type = 'redeem_reversal' THEN points ELSE 0 END), 0) as redeem_reversed
+		`).
+		Where("order_id = ?", orderID).
+		Scan(&totals).Error; err != nil {
+		return err
+	}
+
+	fraction = math.Max(0, math.Min(1, fraction))
+	reverse := min(int(math.Round(float64(totals.Earned)*fraction)), totals.Earned-totals.EarnReversed)
+	if reverse > 0 {
+		if _, err := AdjustPoints(tx, order.UserID, -reverse, "earn_reversal", &order.ID, nil, reason); err != nil {
+			return err
+		}
+	}
+
+	if restoreRedeemed {
+		if restore := totals.Redeemed - totals.RedeemReversed; restore > 0 {
+			if _, err := AdjustPoints(tx, order.UserID, restore, "redeem_reversal", &order.ID, nil, reason); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// categoryMultipliers returns a lookup of the earn multiplier for a category.
+// A category without its own multiplier inherits the one of its closest ancestor.
+func categoryMultipliers(db *gorm.DB) (func(categoryID uint) float64, error) {
+	var multipliers []models.LoyaltyCategoryMultiplier
+	if err := db.Find(&multipliers).Error; err != nil {
+		return nil, err
+	}
+
+	byCategory := make(map[uint]float64)
+	for _, m := range multipliers {
+		byCategory[m.CategoryID] = m.Multiplier
+	}
+
+	var categories []struct {
+		ID       uint
+		ParentID *uint
+	}
+	if len(byCategory) != 0 {
+		if err := db.Model(&models.Category{}).Select("id, parent_id").Scan(&categories).Error; err != nil {
+			return nil, err
+		}
+	}
+	parents := make(map[uint]*uint)
+	for _, category := range categories {
+		parents[category.ID] = category.ParentID
+	}
+
+	return func(categoryID uint) float64 {
+		id := &categoryID
+		for depth := 0; id != nil && depth < 64; depth++ {
+			if multiplier, ok := byCategory[*id]; ok {
+				return multiplier
+			}
+			id = parents[*id]
+		}
+		return 1
+	}, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordPriceChanges writes a price history entry for every price that differs between before and after
+func RecordPriceChanges(tx *gorm.DB, before models.Product, after models.Product, source string, changedBy *uint) error {
+	var history []models.PriceHistory
+
+	if before.Price != after.Price {
+		oldPrice, newPrice := before.Price, after.Price
+		history = append(history, models.PriceHistory{
+			ProductID: after.ID,
+			PriceType: "price",
+			OldPrice:  &oldPrice,
+			NewPrice:  &newPrice,
+			Source:    source,
+			ChangedBy: changedBy,
+		})
+	}
+	if !samePrice(before.SalePrice, after.SalePrice) {
+		history = append(history, models.PriceHistory{
+			ProductID: after.ID,
+			PriceType: "sale_price",
+			OldPrice:  before.SalePrice,
+			NewPrice:  after.SalePrice,
+			Source:    source,
+			ChangedBy: changedBy,
+		})
+	}
+	if !samePrice(before.CompareAtPrice, after.CompareAtPrice) {
+		history = append(history, models.PriceHistory{
+			ProductID: after.ID,
+			PriceType: "compare_at_price",
+			OldPrice:  before.CompareAtPrice,
+			NewPrice:  after.CompareAtPrice,
+			Source:    source,
+			ChangedBy: changedBy,
+		})
+	}
+
+	if len(history) == 0 {
+		return nil
+	}
+	return tx.Create(&history).Error
+}
+
+// ErrUnknownOrderItem rejects an order line that is not a published product, or a variant of it,
+// ordered at least once
+var ErrUnknownOrderItem = errors.New("every order item must be a published product or one of its variants, ordered at least once")
+
+// PriceOrderItems sets the price of every order item to what its product or variant sells for now
+// in the currency of the converter, whatever price the client sent
+func PriceOrderItems(db *gorm.DB, converter *Converter, items []models.OrderItem) error {
+	var productIDs, variantIDs []uint
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return ErrUnknownOrderItem
+		}
+		productIDs = append(productIDs, item.ProductID)
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, *item.VariantID)
+		}
+	}
+
+	var products []models.Product
+	if err := db.Where("id IN ? AND status = 'published'", productIDs).Find(&products).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+	variants := make(map[uint]models.ProductVariant)
+	if len(variantIDs) != 0 {
+		var found []models.ProductVariant
+		if err := db.Where("id IN ?", variantIDs).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, variant := range found {
+			variants[variant.ID] = variant
+		}
+	}
+	if err := converter.LoadPriceLists(db, productIDs); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			return ErrUnknownOrderItem
+		}
+		var variant *models.ProductVariant
+		if item.VariantID != nil {
+			found, ok := variants[*item.VariantID]
+			if !ok || found.ProductID != product.ID {
+				return ErrUnknownOrderItem
+			}
+			variant = &found
+		}
+		price, err := converter.UnitPrice(product, variant, now)
+		if err != nil {
+			return err
+		}
+		items[i].PriceAtPurchase = price
+	}
+	return nil
+}
+
+// ErrVariationPrices rejects a scheduled price for a product whose variations are priced on their own
+var ErrVariationPrices = errors.New("the product has variations with their own price, schedule their prices instead")
+
+// HasOwnPricedVariations reports whether a product has variants overriding its price or sale
+// price, or variations stored as child products, which keep their own price
+func HasOwnPricedVariations(db *gorm.DB, productID uint) (bool, error) {
+	return anyRows(
+		db.Model(&models.ProductVariant{}).Where("product_id = ? AND (price IS NOT NULL OR sale_price IS NOT NULL)", productID),
+		db.Model(&models.Product{}).Where("parent_id = ? AND is_child", productID),
+	)
+}
+
+// ApplyScheduledPrices applies every scheduled price change that has become due
+// and returns the number of changes applied. A schedule is claimed before it is applied, so
+// runs overlapping on several servers apply it once. One that fails does not hold up the others,
+// one that can no longer be applied is marked failed with the reason and not tried again.
+func ApplyScheduledPrices(db *gorm.DB) (int, error) {
+	var ids []uint
+	if err := db.Model(&models.PriceSchedule{}).Where("applied_at IS NULL AND effective_at <= ?", time.Now()).
+		Order("effective_at ASC, id ASC").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	var failed error
+	for _, id := range ids {
+		claimed := false
+		var rejected error
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// the row stays locked until the change commits, another run finds it applied
+			var schedule models.PriceSchedule
+			claim := tx.Model(&schedule).Clauses(clause.Returning{}).
+				Where("id = ? AND applied_at IS NULL", id).Update("applied_at", time.Now())
+			if claim.Error != nil || claim.RowsAffected == 0 {
+				return claim.Error
+			}
+
+			var product models.Product
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, schedule.ProductID).Error; err != nil {
+				return err
+			}
+			variations, err := HasOwnPricedVariations(tx, product.ID)
+			if err != nil {
+				return err
+			}
+			if variations {
+				rejected = ErrVariationPrices
+				return tx.Model(&schedule).Update("failure_reason", rejected.Error()).Error
+			}
+
+			before := product
+			product.Price = schedule.Price
+			if err := tx.Model(&product).Update("price", schedule.Price).Error; err != nil {
+				return err
+			}
+			claimed = true
+			return RecordPriceChanges(tx, before, product, "schedule", nil)
+		})
+		if err == nil {
+			err = rejected
+		}
+		if err != nil {
+			failed = errors.Join(failed, fmt.Errorf("applying price schedule %d: %w", id, err))
+			continue
+		}
+		if claimed {
+			applied++
+		}
+	}
+
+	return applied, failed
+}
+
+func samePrice(a *utils.Money, b *utils.Money) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
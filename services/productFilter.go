@@ -0,0 +1,426 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// The facets of the product listings. A facet ignores its own filter when its values are
+// counted, so choosing one brand still shows how many products the other brands have.
+const (
+	FacetBrand   = "brand"
+	FacetColor   = "color"
+	FacetSize    = "size"
+	FacetPrice   = "price"
+	FacetRating  = "rating"
+	FacetInStock = "in_stock"
+)
+
+// DefaultPriceBuckets are the bounds of the price facet in the currency of the request
+var DefaultPriceBuckets = []utils.Money{2500, 5000, 10000, 20000}
+
+// PriceRange is a price filter in the base currency, an empty bound is open
+type PriceRange struct {
+	Min *utils.Money
+	Max *utils.Money
+}
+
+// ProductFilter is the validated filter of a product listing. Prices are in the base currency.
+type ProductFilter struct {
+	Month       *int
+	CategoryID  *uint
+	BrandIDs    []uint
+	Colors      []string
+	Sizes       []string
+	Tags        []string // Tag slugs
+	Featured    *bool
+	Status      string
+	Prices      []PriceRange // A product matches any of the ranges
+	MinRating   *int
+	InStock     bool
+	PriceBounds PriceRange // start_price and end_price
+}
+
+// listValues splits repeated and comma separated query values
+func listValues(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
+
+// parseAmount parses a price of the request currency into the base currency
+func parseAmount(text string, converter *Converter) (*utils.Money, error) {
+	amount, err := utils.ParseMoney(text)
+	if err != nil || amount < 0 {
+		return nil, fmt.Errorf("%q is not a valid price", text)
+	}
+	amount = converter.ToBase(amount)
+	return &amount, nil
+}
+
+// NewProductFilter validates the listing parameters. Prices are given in the currency of the
+// converter and converted to the base currency.
+func NewProductFilter(params utils.Parameters, converter *Converter) (ProductFilter, error) {
+	var filter ProductFilter
+
+	if params.Month != "" {
+		month, err := strconv.Atoi(params.Month)
+		if err != nil || month < 1 || month > 12 {
+			return filter, errors.New("month must be a number from 1 to 12")
+		}
+		filter.Month = &month
+	}
+	if params.CategoryID != "" {
+		id, err := strconv.ParseUint(params.CategoryID, 10, 64)
+		if err != nil {
+			return filter, errors.New("category_id must be a category ID")
+		}
+		categoryID := uint(id)
+		filter.CategoryID = &categoryID
+	}
+	for _, value := range listValues(params.BrandID) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, errors.New("brand_id must be a list of brand IDs")
+		}
+		filter.BrandIDs = append(filter.BrandIDs, uint(id))
+	}
+	for _, value := range listValues(params.Colors) {
+		filter.Colors = append(filter.Colors, strings.ToLower(value))
+	}
+	for _, value := range listValues(params.Sizes) {
+		filter.Sizes = append(filter.Sizes, strings.ToLower(value))
+	}
+	for _, value := range listValues(params.Tags) {
+		filter.Tags = append(filter.Tags, utils.Slugify(value))
+	}
+	if params.Featured != "" {
+		featured, err := strconv.ParseBool(params.Featured)
+		if err != nil {
+			return filter, errors.New("featured must be true or false")
+		}
+		filter.Featured = &featured
+	}
+	if params.Status != "" {
+		if params.Status != "published" && params.Status != "unpublished" {
+			return filter, errors.New("status must be published or unpublished")
+		}
+		filter.Status = params.Status
+	}
+	if params.StartPrice != nil {
+		start := converter.ToBase(utils.Money(*params.StartPrice) * 100)
+		filter.PriceBounds.Min = &start
+	}
+	if params.EndPrice != nil {
+		end := converter.ToBase(utils.Money(*params.EndPrice) * 100)
+		filter.PriceBounds.Max = &end
+	}
+	for _, value := range listValues(params.Prices) {
+		low, high, ok := strings.Cut(value, "-")
+		if !ok {
+			return filter, fmt.Errorf("price range %q must be written as min-max", value)
+		}
+		var priceRange PriceRange
+		var err error
+		if strings.TrimSpace(low) != "" {
+			if priceRange.Min, err = parseAmount(low, converter); err != nil {
+				return filter, err
+			}
+		}
+		if strings.TrimSpace(high) != "" {
+			if priceRange.Max, err = parseAmount(high, converter); err != nil {
+				return filter, err
+			}
+		}
+		filter.Prices = append(filter.Prices, priceRange)
+	}
+	if params.Rating != nil {
+		if *params.Rating < 1 || *params.Rating > 5 {
+			return filter, errors.New("rating must be from 1 to 5")
+		}
+		filter.MinRating = params.Rating
+	}
+	filter.InStock = params.InStock
+
+	return filter, nil
+}
+
+// PriceBuckets parses the bounds of the price facet in the currency of the request, such as
+// "25,50,100", falling back to DefaultPriceBuckets
+func PriceBuckets(text string) ([]utils.Money, error) {
+	if strings.TrimSpace(text) == "" {
+		return append([]utils.Money{}, DefaultPriceBuckets...), nil
+	}
+	var buckets []utils.Money
+	for _, part := range listValues([]string{text}) {
+		amount, err := utils.ParseMoney(part)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("price bucket %q is not a valid price", part)
+		}
+		buckets = append(buckets, amount)
+	}
+	sort.Slice(buckets, func(a, b int) bool { return buckets[a] < buckets[b] })
+	return buckets, nil
+}
+
+// optionCondition matches products with a variant having one of the values of an option, or
+// a product keeping the value in its legacy color or size column
+func optionCondition(column string, option string) string {
+	return `(lower(products.` + column + `) IN ? OR EXISTS (
+		SELECT 1
+		FROM product_variants
+		INNER JOIN variant_option_values ON variant_option_values.variant_id = product_variants.id
+		INNER JOIN product_option_values ON product_option_values.id = variant_option_values.option_value_id
+		INNER JOIN product_options ON product_options.id = product_option_values.option_id
+		WHERE product_variants.product_id = products.id
+		AND product_variants.deleted_at IS NULL
+		AND lower(product_options.name) = '` + option + `'
+		AND lower(product_option_values.value) IN ?
+	))`
+}
+
+const averageRating = `(SELECT AVG(reviews.rating) FROM reviews WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL)`
+
+const inStockCondition = `EXISTS (
+	SELECT 1
+	FROM inventories
+	WHERE inventories.product_id = products.id
+	AND inventories.stock_level > 0
+	AND inventories.deleted_at IS NULL
+)`
+
+// Scope applies the filter to a products query, leaving out the filter of the given facet.
+// Every value is passed as a query parameter.
+func (f ProductFilter) Scope(except string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if f.Month != nil {
+			db = db.Where("EXTRACT(MONTH FROM products.created_at) = ?", *f.Month)
+		}
+		if f.CategoryID != nil {
+			db = db.Where("products.category_id IN (?)", CategorySubtree(db, *f.CategoryID))
+		}
+		if len(f.Tags) != 0 {
+			db = db.Where(taggedCondition, f.Tags)
+		}
+		if f.Featured != nil {
+			db = db.Where("products.featured = ?", *f.Featured)
+		}
+		if f.Status != "" {
+			db = db.Where("products.status = ?", f.Status)
+		}
+		if len(f.BrandIDs) != 0 && except != FacetBrand {
+			db = db.Where("products.brand_id IN ?", f.BrandIDs)
+		}
+		if len(f.Colors) != 0 && except != FacetColor {
+			db = db.Where(optionCondition("color", "color"), f.Colors, f.Colors)
+		}
+		if len(f.Sizes) != 0 && except != FacetSize {
+			db = db.Where(optionCondition("size", "size"), f.Sizes, f.Sizes)
+		}
+		if except != FacetPrice {
+			if f.PriceBounds.Min != nil {
+				db = db.Where(utils.BasePriceColumn+" >= ?", *f.PriceBounds.Min)
+			}
+			if f.PriceBounds.Max != nil {
+				db = db.Where(utils.BasePriceColumn+" <= ?", *f.PriceBounds.Max)
+			}
+			if len(f.Prices) != 0 {
+				var conditions []string
+				var args []interface{}
+				for _, priceRange := range f.Prices {
+					condition := "TRUE"
+					if priceRange.Min != nil {
+						condition += " AND " + utils.BasePriceColumn + " >= ?"
+						args = append(args, *priceRange.Min)
+					}
+					if priceRange.Max != nil {
+						condition += " AND " + utils.BasePriceColumn + " < ?"
+						args = append(args, *priceRange.Max)
+					}
+					conditions = append(conditions, "("+condition+")")
+				}
+				db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+			}
+		}
+		if f.MinRating != nil && except != FacetRating {
+			db = db.Where(averageRating+" >= ?", *f.MinRating)
+		}
+		if f.InStock && except != FacetInStock {
+			db = db.Where(inStockCondition)
+		}
+		return db
+	}
+}
+
+// BrandFacet is the number of products of a brand
+type BrandFacet struct {
+	ID    uint
+	Name  string
+	Count int64
+}
+
+// FacetValue is the number of products with an option value
+type FacetValue struct {
+	Value string
+	Count int64
+}
+
+// PriceFacet is the number of products in a price bucket, Max is empty for the last bucket
+type PriceFacet struct {
+	Min   utils.Money
+	Max   *utils.Money
+	Count int64
+}
+
+// RatingFacet is the number of products rated Rating or better on average
+type RatingFacet struct {
+	Rating int
+	Count  int64
+}
+
+// ProductFacets are the counts of the facet values of a filtered listing
+type ProductFacets struct {
+	Currency string // Currency of the price buckets
+	Total    int64
+	Brands   []BrandFacet
+	Colors   []FacetValue
+	Sizes    []FacetValue
+	Prices   []PriceFacet
+	Ratings  []RatingFacet
+	InStock  int64
+}
+
+// LoadProductFacets counts the products of a listing per facet value. The listing is made of
+// the parent products matching the search text and the filter; buckets are the bounds of the
+// price facet in the base currency. Run it in a SearchTransaction when searching.
+func LoadProductFacets(db *gorm.DB, filter ProductFilter, text string, buckets []utils.Money) (ProductFacets, error) {
+	var facets ProductFacets
+
+	products := func(except string) *gorm.DB {
+		query := db.Model(&models.Product{}).Select("products.id").Where("products.is_child = false")
+		return MatchSearch(query, text).Scopes(filter.Scope(except))
+	}
+
+	if err := products("").Count(&facets.Total).Error; err != nil {
+		return facets, err
+	}
+
+	if err := db.Table("products").
+		Select("brands.id, brands.name, COUNT(*) AS count").
+		Joins("INNER JOIN brands ON brands.id = products.brand_id AND brands.deleted_at IS NULL").
+		Where("products.id IN (?)", products(FacetBrand)).
+		Group("brands.id, brands.name").
+		Order("count DESC, brands.name ASC").
+		Scan(&facets.Brands).Error; err != nil {
+		return facets, err
+	}
+
+	var err error
+	if facets.Colors, err = optionFacet(db, "color", products(FacetColor)); err != nil {
+		return facets, err
+	}
+	if facets.Sizes, err = optionFacet(db, "size", products(FacetSize)); err != nil {
+		return facets, err
+	}
+
+	// bucket i holds the prices from bound i-1 up to bound i
+	bucket := "CASE"
+	args := make([]interface{}, 0, len(buckets))
+	for i, bound := range buckets {
+		bucket += fmt.Sprintf(" WHEN %s < ? THEN %d", utils.BasePriceColumn, i)
+		args = append(args, bound)
+	}
+	bucket += fmt.Sprintf(" ELSE %d END", len(buckets))
+	var prices []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := db.Table("products").
+		Select(bucket+" AS bucket, COUNT(*) AS count", args...).
+		Where("products.id IN (?)", products(FacetPrice)).
+		Group("bucket").
+		Scan(&prices).Error; err != nil {
+		return facets, err
+	}
+	counts := make(map[int]int64)
+	for _, price := range prices {
+		counts[price.Bucket] = price.Count
+	}
+	for i := 0; i <= len(buckets); i++ {
+		facet := PriceFacet{Count: counts[i]}
+		if i > 0 {
+			facet.Min = buckets[i-1]
+		}
+		if i < len(buckets) {
+			facet.Max = &buckets[i]
+		}
+		facets.Prices = append(facets.Prices, facet)
+	}
+
+	var ratings []struct {
+		Rating int
+		Count  int64
+	}
+	if err := db.Table("(?) AS rated", db.Table("products").
+		Select(averageRating+" AS average").
+		Where("products.id IN (?)", products(FacetRating))).
+		Select("FLOOR(average)::int AS rating, COUNT(*) AS count").
+		Where("average IS NOT NULL").
+		Group("FLOOR(average)::int").
+		Scan(&ratings).Error; err != nil {
+		return facets, err
+	}
+	// ratings are offered as "4 and up", so each count includes the better rated products
+	for rating := 4; rating >= 1; rating-- {
+		var count int64
+		for _, row := range ratings {
+			if row.Rating >= rating {
+				count += row.Count
+			}
+		}
+		facets.Ratings = append(facets.Ratings, RatingFacet{Rating: rating, Count: count})
+	}
+
+	if err := products(FacetInStock).Where(inStockCondition).Count(&facets.InStock).Error; err != nil {
+		return facets, err
+	}
+
+	return facets, nil
+}
+
+// optionFacet counts the products per value of an option, merging values that differ in case
+func optionFacet(db *gorm.DB, option string, products *gorm.DB) ([]FacetValue, error) {
+	var values []FacetValue
+	err := db.Raw(`SELECT MIN(value) AS value, COUNT(DISTINCT product_id) AS count
+		FROM (
+			SELECT product_variants.product_id, product_option_values.value
+			FROM product_variants
+			INNER JOIN variant_option_values ON variant_option_values.variant_id = product_variants.id
+			INNER JOIN product_option_values ON product_option_values.id = variant_option_values.option_value_id
+			INNER JOIN product_options ON product_options.id = product_option_values.option_id
+			WHERE product_variants.deleted_at IS NULL
+			AND lower(product_options.name) = ?
+			AND product_variants.product_id IN (?)
+			UNION ALL
+			SELECT products.id, products.`+option+`
+			FROM products
+			WHERE products.`+option+` <> ''
+			AND products.id IN (?)
+		) option_values
+		GROUP BY lower(value)
+		ORDER BY count DESC, value ASC`, option, products, products).Scan(&values).Error
+	return values, err
+}
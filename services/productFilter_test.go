@@ -0,0 +1,80 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewProductFilter(t *testing.T) {
+	converter := &Converter{Base: "USD", Target: "EUR", rates: map[string]float64{"USD": 1, "EUR": 0.9}}
+
+	tests := []struct {
+		name   string
+		params utils.Parameters
+		want   ProductFilter
+		err    bool
+	}{
+		{"empty", utils.Parameters{}, ProductFilter{}, false},
+		{"month", utils.Parameters{Month: "12"}, ProductFilter{Month: intPtr(12)}, false},
+		{"month out of range", utils.Parameters{Month: "13"}, ProductFilter{}, true},
+		{"month not a number", utils.Parameters{Month: "may"}, ProductFilter{}, true},
+		{"category", utils.Parameters{CategoryID: "7"}, ProductFilter{CategoryID: uintPtr(7)}, false},
+		{"negative category", utils.Parameters{CategoryID: "-1"}, ProductFilter{}, true},
+		{"repeated and comma separated brands", utils.Parameters{BrandID: []string{"1, 2", "3"}},
+			ProductFilter{BrandIDs: []uint{1, 2, 3}}, false},
+		{"brand not an ID", utils.Parameters{BrandID: []string{"1,acme"}}, ProductFilter{}, true},
+		{"options are lower cased", utils.Parameters{Colors: []string{"Red,BLUE"}, Sizes: []string{" XL "}},
+			ProductFilter{Colors: []string{"red", "blue"}, Sizes: []string{"xl"}}, false},
+		{"tags are slugified", utils.Parameters{Tags: []string{"Summer Sale"}}, ProductFilter{Tags: []string{"summer-sale"}}, false},
+		{"featured", utils.Parameters{Featured: "false"}, ProductFilter{Featured: new(bool)}, false},
+		{"featured not a bool", utils.Parameters{Featured: "maybe"}, ProductFilter{}, true},
+		{"status", utils.Parameters{Status: "published"}, ProductFilter{Status: "published"}, false},
+		{"unknown status", utils.Parameters{Status: "draft"}, ProductFilter{}, true},
+		// 9 and 18 EUR are 10 and 20 USD
+		{"price bounds in the base currency", utils.Parameters{StartPrice: intPtr(9), EndPrice: intPtr(18)},
+			ProductFilter{PriceBounds: PriceRange{Min: moneyPtr(1000), Max: moneyPtr(2000)}}, false},
+		{"price ranges", utils.Parameters{Prices: []string{"9-18,27-"}},
+			ProductFilter{Prices: []PriceRange{{Min: moneyPtr(1000), Max: moneyPtr(2000)}, {Min: moneyPtr(3000)}}}, false},
+		{"price range without an upper bound", utils.Parameters{Prices: []string{"-4.50"}},
+			ProductFilter{Prices: []PriceRange{{Max: moneyPtr(500)}}}, false},
+		{"price range without a dash", utils.Parameters{Prices: []string{"25"}}, ProductFilter{}, true},
+		{"negative price", utils.Parameters{Prices: []string{"-5-10"}}, ProductFilter{}, true},
+		{"price not a number", utils.Parameters{Prices: []string{"a-b"}}, ProductFilter{}, true},
+		{"rating", utils.Parameters{Rating: intPtr(4)}, ProductFilter{MinRating: intPtr(4)}, false},
+		{"rating out of range", utils.Parameters{Rating: intPtr(6)}, ProductFilter{}, true},
+		{"in stock", utils.Parameters{InStock: true}, ProductFilter{InStock: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewProductFilter(test.params, converter)
+			if (err != nil) != test.err {
+				t.Fatalf("NewProductFilter(%+v) error = %v, want error %v", test.params, err, test.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NewProductFilter(%+v) = %+v, want %+v", test.params, got, test.want)
+			}
+		})
+	}
+}
+
+func TestProductFilterPricesInBaseCurrency(t *testing.T) {
+	filter := ProductFilter{PriceBounds: PriceRange{Min: moneyPtr(1000)}, Prices: []PriceRange{{Max: moneyPtr(2000)}}}
+	db, log := dryRun(t)
+	var products []models.Product
+	db.Model(&models.Product{}).Scopes(filter.Scope("")).Find(&products)
+	if len(log.statements) != 1 {
+		t.Fatalf("statements = %q, want 1", log.statements)
+	}
+
+	// every product price is converted from its own currency before it is compared
+	for _, bound := range []string{" >= '10.00'", " < '20.00'"} {
+		if !strings.Contains(log.statements[0], "WHERE currencies.code = products.currency") ||
+			!strings.Contains(log.statements[0], "), 1), 2)"+bound) {
+			t.Errorf("statement = %s, want the base price compared %s", log.statements[0], bound)
+		}
+	}
+}
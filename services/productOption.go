@@ -0,0 +1,378 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxVariants bounds the variations of a product, the size of its variant matrix
+const MaxVariants = 100
+
+var (
+	ErrDuplicateOption  = errors.New("option names and option values must be unique")
+	ErrVariantExists    = errors.New("a variation with these option values already exists")
+	ErrIncompleteOption = errors.New("a value is required for every option of the product")
+	ErrTooManyVariants  = fmt.Errorf("a product can have at most %d variations", MaxVariants)
+)
+
+// OptionInput is an option with its values in display order
+type OptionInput struct {
+	Name   string             `binding:"required"`
+	Values []OptionValueInput `binding:"required,min=1,dive"`
+}
+
+type OptionValueInput struct {
+	Value   string `binding:"required"`
+	Image   string // Base64 image shown for the value, such as a picture of a color
+	ImageID *uint  // Uploaded image shown for the value, instead of Image
+}
+
+// VariantInput describes one combination of the variant matrix. Values are given in the order
+// of the options.
+type VariantInput struct {
+	Values   []string `binding:"required,min=1"`
+	SKU      string   // Overrides the generated SKU
+	Barcode  *string
+	Price    *utils.Money // Overrides the price of the product
+	Weight   *float64
+	Quantity int `binding:"gte=0"`
+}
+
+// VariantOptions are the options of a product and its variants with their option values
+type VariantOptions struct {
+	Options  []models.ProductOption
+	Variants []models.ProductVariant
+}
+
+// isOption reports whether an option is the legacy dimension kept in the Color or Size column
+func isOption(option models.ProductOption, name string) bool {
+	return strings.EqualFold(strings.TrimSpace(option.Name), name)
+}
+
+// CreateProductOptions stores the options of a product in the given order, together with the
+// images of their values
+func CreateProductOptions(tx *gorm.DB, productID uint, inputs []OptionInput) ([]models.ProductOption, error) {
+	sizes := make([]int, len(inputs))
+	for i, input := range inputs {
+		sizes[i] = len(input.Values)
+	}
+	if err := checkMatrixSize(sizes); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	options := make([]models.ProductOption, 0, len(inputs))
+
+	for i, input := range inputs {
+		name := strings.TrimSpace(input.Name)
+		if names[strings.ToLower(name)] {
+			return nil, ErrDuplicateOption
+		}
+		names[strings.ToLower(name)] = true
+
+		option := models.ProductOption{ProductID: productID, Name: name, Position: i}
+		values := make(map[string]bool)
+		for j, value := range input.Values {
+			text := strings.TrimSpace(value.Value)
+			if values[strings.ToLower(text)] {
+				return nil, ErrDuplicateOption
+			}
+			values[strings.ToLower(text)] = true
+			option.Values = append(option.Values, models.ProductOptionValue{Value: text, Position: j})
+		}
+		options = append(options, option)
+	}
+
+	if len(options) == 0 {
+		return options, nil
+	}
+	if err := tx.Create(&options).Error; err != nil {
+		return nil, err
+	}
+
+	var images []models.ProductImage
+	for i, input := range inputs {
+		for j, value := range input.Values {
+			if value.Image == "" && value.ImageID == nil {
+				continue
+			}
+			image := models.ProductImage{ProductID: productID, StoredImage: models.StoredImage{Image: value.Image, ImageID: value.ImageID}, OptionValueID: &options[i].Values[j].ID}
+			if isOption(options[i], "color") {
+				image.Color = &options[i].Values[j].Value
+			}
+			images = append(images, image)
+		}
+	}
+	if len(images) != 0 {
+		if err := tx.Create(&images).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+// checkMatrixSize fails when the options of the given numbers of values make more than
+// MaxVariants combinations
+func checkMatrixSize(sizes []int) error {
+	combinations := 1
+	for _, size := range sizes {
+		combinations *= size
+		if combinations > MaxVariants {
+			return ErrTooManyVariants
+		}
+	}
+	return nil
+}
+
+// VariantMatrix returns every combination of the option values, the first option varying slowest.
+// Matrices of more than MaxVariants combinations are refused with ErrTooManyVariants.
+func VariantMatrix(options []models.ProductOption) ([][]models.ProductOptionValue, error) {
+	if len(options) == 0 {
+		return nil, nil
+	}
+	sizes := make([]int, len(options))
+	for i, option := range options {
+		sizes[i] = len(option.Values)
+	}
+	if err := checkMatrixSize(sizes); err != nil {
+		return nil, err
+	}
+
+	matrix := [][]models.ProductOptionValue{{}}
+	for _, option := range options {
+		var next [][]models.ProductOptionValue
+		for _, combination := range matrix {
+			for _, value := range option.Values {
+				row := append(append([]models.ProductOptionValue{}, combination...), value)
+				next = append(next, row)
+			}
+		}
+		matrix = next
+	}
+	return matrix, nil
+}
+
+// VariantKey identifies a combination of option values independent of letter case
+func VariantKey(values []string) string {
+	key := make([]string, len(values))
+	for i, value := range values {
+		key[i] = strings.ToLower(strings.TrimSpace(value))
+	}
+	return strings.Join(key, "/")
+}
+
+// VariantSKU derives the SKU of a variation from the SKU of its parent and its option values
+func VariantSKU(parentSKU string, values []models.ProductOptionValue) string {
+	parts := []string{parentSKU}
+	for _, value := range values {
+		parts = append(parts, strings.Join(strings.Fields(value.Value), "-"))
+	}
+	return strings.Join(parts, "-")
+}
+
+// NewVariant builds a variant of parent for a combination of option values
+func NewVariant(parent models.Product, values []models.ProductOptionValue, input VariantInput) models.ProductVariant {
+	variant := models.ProductVariant{
+		ProductID: parent.ID,
+		SKU:       VariantSKU(parent.SKU, values),
+		Barcode:   input.Barcode,
+		Price:     input.Price,
+		Weight:    input.Weight,
+		Values:    values,
+		Inventory: &models.Inventory{
+			ProductID:  parent.ID,
+			StockLevel: input.Quantity,
+			InOpen:     0,
+			ChangeType: "restock",
+			ChangeDate: time.Now(),
+		},
+	}
+	if input.SKU != "" {
+		variant.SKU = input.SKU
+	}
+	return variant
+}
+
+// CreateVariantMatrix creates a variant for every combination of the option values. Stock, SKUs
+// and prices are taken from the matching inputs, combinations without an input start out of stock.
+func CreateVariantMatrix(tx *gorm.DB, parent models.Product, options []models.ProductOption, inputs []VariantInput) ([]models.ProductVariant, error) {
+	byKey := make(map[string]VariantInput)
+	for _, input := range inputs {
+		if len(input.Values) != len(options) {
+			return nil, ErrIncompleteOption
+		}
+		byKey[VariantKey(input.Values)] = input
+	}
+
+	matrix, err := VariantMatrix(options)
+	if err != nil {
+		return nil, err
+	}
+	var variants []models.ProductVariant
+	for i, values := range matrix {
+		key := make([]string, len(values))
+		for j, value := range values {
+			key[j] = value.Value
+		}
+
+		variant := NewVariant(parent, values, byKey[VariantKey(key)])
+		variant.Position = i
+		variants = append(variants, variant)
+	}
+
+	if len(variants) == 0 {
+		return variants, nil
+	}
+	if err := tx.Omit("Values.*").Create(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// AddVariant adds a variant for the given option name to value pairs, creating options and
+// values the product doesn't have yet
+func AddVariant(tx *gorm.DB, parent models.Product, selection map[string]string, input VariantInput) (*models.ProductVariant, error) {
+	var options []models.ProductOption
+	if err := tx.Preload("Values", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("product_id = ?", parent.ID).Order("position ASC").Find(&options).Error; err != nil {
+		return nil, err
+	}
+
+	chosen := make(map[string]string)
+	for name, value := range selection {
+		if strings.TrimSpace(value) != "" {
+			chosen[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	if len(chosen) == 0 {
+		return nil, ErrIncompleteOption
+	}
+
+	if len(options) != 0 {
+		// a new dimension would leave the existing variants without a value for it
+		for name := range chosen {
+			found := false
+			for _, option := range options {
+				found = found || strings.EqualFold(option.Name, name)
+			}
+			if !found {
+				return nil, ErrIncompleteOption
+			}
+		}
+	}
+
+	// products without options get one for every dimension given, in a stable order
+	if len(options) == 0 {
+		names := make([]string, 0, len(selection))
+		for name, value := range selection {
+			if strings.TrimSpace(value) != "" {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			option := models.ProductOption{ProductID: parent.ID, Name: name, Position: i}
+			if err := tx.Create(&option).Error; err != nil {
+				return nil, err
+			}
+			options = append(options, option)
+		}
+	}
+
+	values := make([]models.ProductOptionValue, 0, len(options))
+	for i := range options {
+		text, ok := chosen[strings.ToLower(options[i].Name)]
+		if !ok {
+			return nil, ErrIncompleteOption
+		}
+		value, err := findOrCreateValue(tx, &options[i], text)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, *value)
+	}
+
+	ids := make([]uint, len(values))
+	for i, value := range values {
+		ids[i] = value.ID
+	}
+	var existing []uint
+	if err := tx.Model(&models.VariantOptionValue{}).
+		Joins("JOIN product_variants ON product_variants.id = variant_option_values.variant_id AND product_variants.deleted_at IS NULL").
+		Where("product_variants.product_id = ? AND variant_option_values.option_value_id IN ?", parent.ID, ids).
+		Group("variant_option_values.variant_id").
+		Having("COUNT(*) = ?", len(ids)).
+		Pluck("variant_option_values.variant_id", &existing).Error; err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, ErrVariantExists
+	}
+
+	var count int64
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", parent.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= MaxVariants {
+		return nil, ErrTooManyVariants
+	}
+
+	variant := NewVariant(parent, values, input)
+	variant.Position = int(count)
+	if err := tx.Omit("Values.*").Create(&variant).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// findOrCreateValue returns the value of an option matching text, adding it to the option when missing
+func findOrCreateValue(tx *gorm.DB, option *models.ProductOption, text string) (*models.ProductOptionValue, error) {
+	for j := range option.Values {
+		if strings.EqualFold(option.Values[j].Value, text) {
+			return &option.Values[j], nil
+		}
+	}
+	value := models.ProductOptionValue{OptionID: option.ID, Value: text, Position: len(option.Values)}
+	if err := tx.Create(&value).Error; err != nil {
+		return nil, err
+	}
+	option.Values = append(option.Values, value)
+	return &value, nil
+}
+
+// LoadVariantOptions loads the options of a product and its variants
+func LoadVariantOptions(db *gorm.DB, productID uint) (*VariantOptions, error) {
+	result := &VariantOptions{}
+
+	if err := db.Preload("Values", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC, id ASC")
+	}).Where("product_id = ?", productID).Order("position ASC, id ASC").Find(&result.Options).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Preload("Images", GalleryOrder).Preload("Inventory").Preload("Values.Option").
+		Where("product_id = ?", productID).Order("position ASC, id ASC").Find(&result.Variants).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range result.Variants {
+		SortVariantValues(result.Variants[i].Values)
+	}
+	return result, nil
+}
+
+// SortVariantValues puts the option values of a variant in the order of their options.
+// The options of the values must be loaded.
+func SortVariantValues(values []models.ProductOptionValue) {
+	sort.SliceStable(values, func(a, b int) bool {
+		return values[a].Option != nil && values[b].Option != nil && values[a].Option.Position < values[b].Option.Position
+	})
+}
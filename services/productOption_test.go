@@ -0,0 +1,72 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVariantMatrix(t *testing.T) {
+	option := func(name string, values ...string) models.ProductOption {
+		option := models.ProductOption{Name: name}
+		for _, value := range values {
+			option.Values = append(option.Values, models.ProductOptionValue{Value: value})
+		}
+		return option
+	}
+	sized := func(n int) models.ProductOption {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = fmt.Sprint(i)
+		}
+		return option("Option", values...)
+	}
+
+	tests := []struct {
+		name    string
+		options []models.ProductOption
+		want    []string // Joined values of each combination, in order
+		count   int      // Number of combinations, when want is not listed
+		err     error
+	}{
+		{"no options", nil, nil, 0, nil},
+		{"one option", []models.ProductOption{option("Color", "Red", "Blue")}, []string{"Red", "Blue"}, 0, nil},
+		{"first option varies slowest", []models.ProductOption{option("Color", "Red", "Blue"), option("Size", "S", "M", "L")},
+			[]string{"Red/S", "Red/M", "Red/L", "Blue/S", "Blue/M", "Blue/L"}, 0, nil},
+		{"three dimensions", []models.ProductOption{option("Color", "Red"), option("Size", "S", "M"), option("Fit", "Slim", "Wide")},
+			[]string{"Red/S/Slim", "Red/S/Wide", "Red/M/Slim", "Red/M/Wide"}, 0, nil},
+		{"option without values", []models.ProductOption{option("Color", "Red"), option("Size")}, nil, 0, nil},
+		{"at the maximum", []models.ProductOption{sized(10), sized(10)}, nil, MaxVariants, nil},
+		{"above the maximum", []models.ProductOption{sized(11), sized(10)}, nil, 0, ErrTooManyVariants},
+		{"refused before multiplying out", []models.ProductOption{sized(1000), sized(1000), sized(1000)}, nil, 0, ErrTooManyVariants},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matrix, err := VariantMatrix(test.options)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if test.count != 0 {
+				if len(matrix) != test.count {
+					t.Errorf("%d combinations, want %d", len(matrix), test.count)
+				}
+				return
+			}
+			var got []string
+			for _, values := range matrix {
+				key := make([]string, len(values))
+				for i, value := range values {
+					key[i] = value.Value
+				}
+				got = append(got, strings.Join(key, "/"))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("combinations = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
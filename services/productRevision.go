@@ -0,0 +1,239 @@
+package services
+
+import (
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPastSchedule   = errors.New("scheduled times must be in the future")
+	ErrScheduleOrder  = errors.New("UnpublishAt must come after PublishAt")
+	ErrSameAsRevision = errors.New("the product already has the content of the revision")
+)
+
+// ContentChange is a field that differs between two versions of a product
+type ContentChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// DiffContent lists the fields changed from one version of a product to the next, in the order of
+// ProductContent
+func DiffContent(old models.ProductContent, new models.ProductContent) []ContentChange {
+	changes := []ContentChange{}
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		a, b := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		// compared as JSON, times read back from a revision lose their location
+		oldJSON, _ := json.Marshal(a)
+		newJSON, _ := json.Marshal(b)
+		if string(oldJSON) != string(newJSON) {
+			changes = append(changes, ContentChange{Field: oldValue.Type().Field(i).Name, Old: a, New: b})
+		}
+	}
+	return changes
+}
+
+// LatestRevision returns the number of the last revision of a product, 0 without any
+func LatestRevision(db *gorm.DB, productID uint) (int, error) {
+	var latest struct{ Number *int }
+	if err := db.Model(&models.ProductRevision{}).Select("MAX(number) AS number").
+		Where("product_id = ?", productID).Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	if latest.Number == nil {
+		return 0, nil
+	}
+	return *latest.Number, nil
+}
+
+// RecordRevision keeps the content of a product after a change. before is the product as it was,
+// nil for a new product, and is kept too when the product has no revision yet. Nothing is recorded
+// when the content did not change.
+func RecordRevision(tx *gorm.DB, before *models.Product, after models.Product, source string, changedBy *uint) error {
+	content := models.ContentOf(after)
+	// concurrent changes of the product wait on its row, so each numbers its revision after the last
+	var locked models.Product
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", after.ID).First(&locked).Error; err != nil {
+		return err
+	}
+	var latest models.ProductRevision
+	err := tx.Where("product_id = ?", after.ID).Order("number DESC").First(&latest).Error
+	switch {
+	case err == nil:
+		if len(DiffContent(latest.Content, content)) == 0 {
+			return nil
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	case before != nil:
+		if len(DiffContent(models.ContentOf(*before), content)) == 0 {
+			return nil
+		}
+		latest = models.ProductRevision{ProductID: after.ID, Number: 1, Content: models.ContentOf(*before), Source: "initial"}
+		if err := tx.Create(&latest).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&models.ProductRevision{
+		ProductID: after.ID,
+		Number:    latest.Number + 1,
+		Content:   content,
+		Source:    source,
+		CreatedBy: changedBy,
+	}).Error
+}
+
+// ApplyContent replaces the live content of a product, redirecting its old slug and recording
+// the price changes and a revision
+func ApplyContent(tx *gorm.DB, product *models.Product, content models.ProductContent, source string, changedBy *uint) error {
+	before := *product
+	content.ApplyTo(product)
+
+	// the slug is only changed along with a redirect from the old one
+	product.Slug = before.Slug
+	if content.Slug != before.Slug {
+		slug, err := ChangeSlug(tx, SlugProduct, product.ID, before.Slug, content.Slug)
+		if err != nil {
+			return err
+		}
+		product.Slug = slug
+	}
+	if err := tx.Save(product).Error; err != nil {
+		return err
+	}
+	if err := RefreshSearchIndex(tx, product.ID); err != nil {
+		return err
+	}
+
+	priceSource := "manual"
+	if source == "schedule" {
+		priceSource = "schedule"
+	}
+	if err := RecordPriceChanges(tx, before, *product, priceSource, changedBy); err != nil {
+		return err
+	}
+	return RecordRevision(tx, &before, *product, source, changedBy)
+}
+
+// PublishDraft makes the draft of a product its live content and discards the draft. source is
+// "draft" when an editor publishes it and "schedule" when the scheduler does.
+func PublishDraft(tx *gorm.DB, draft models.ProductDraft, source string, publishedBy *uint) (*models.Product, error) {
+	var product models.Product
+	if err := tx.First(&product, draft.ProductID).Error; err != nil {
+		return nil, err
+	}
+	if err := ApplyContent(tx, &product, draft.Content, source, publishedBy); err != nil {
+		return nil, err
+	}
+	// the draft was published or discarded meanwhile
+	deleted := tx.Delete(&draft)
+	if deleted.Error != nil {
+		return nil, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+// RestoreRevision brings back the content a product had in one of its revisions, as a new revision
+func RestoreRevision(tx *gorm.DB, productID uint, number int, restoredBy *uint) (*models.Product, error) {
+	var revision models.ProductRevision
+	if err := tx.Where("product_id = ? AND number = ?", productID, number).First(&revision).Error; err != nil {
+		return nil, err
+	}
+	var product models.Product
+	if err := tx.First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+	if len(DiffContent(models.ContentOf(product), revision.Content)) == 0 {
+		return nil, ErrSameAsRevision
+	}
+	if err := ApplyContent(tx, &product, revision.Content, "restore", restoredBy); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// CheckPublishSchedule validates the times a product is published and unpublished at, either may
+// be left out
+func CheckPublishSchedule(publishAt *time.Time, unpublishAt *time.Time) error {
+	now := time.Now()
+	if (publishAt != nil && publishAt.Before(now)) || (unpublishAt != nil && unpublishAt.Before(now)) {
+		return ErrPastSchedule
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return ErrScheduleOrder
+	}
+	return nil
+}
+
+// ApplyScheduledPublishing publishes the drafts and changes the status of the products whose
+// scheduled time has come and returns the number of changes made. A draft that cannot be
+// published, such as one taking the slug of another product, does not hold up the others.
+func ApplyScheduledPublishing(db *gorm.DB) (int, error) {
+	now := time.Now()
+	applied := 0
+	var failed error
+
+	var drafts []models.ProductDraft
+	// drafts of products in the trash wait for a restore
+	live := db.Model(&models.Product{}).Select("id")
+	if err := db.Where("publish_at <= ? AND product_id IN (?)", now, live).Order("publish_at ASC, id ASC").Find(&drafts).Error; err != nil {
+		return applied, err
+	}
+	for _, draft := range drafts {
+		published := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// an editor may have changed, rescheduled or published the draft since it was listed,
+			// a draft still due is published by the next run
+			var current models.ProductDraft
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND publish_at <= ?", draft.ID, now).First(&current).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !current.UpdatedAt.Equal(draft.UpdatedAt)) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := PublishDraft(tx, current, "schedule", nil); err != nil {
+				return err
+			}
+			published = true
+			return nil
+		})
+		if err != nil {
+			failed = errors.Join(failed, fmt.Errorf("draft of product %d: %w", draft.ProductID, err))
+			continue
+		}
+		if published {
+			applied++
+		}
+	}
+
+	// publishing goes first, a product whose both times passed ends unpublished
+	published := db.Model(&models.Product{}).Where("publish_at <= ?", now).
+		Updates(map[string]interface{}{"status": "published", "publish_at": nil})
+	if published.Error != nil {
+		return applied, published.Error
+	}
+	applied += int(published.RowsAffected)
+
+	unpublished := db.Model(&models.Product{}).Where("unpublish_at <= ?", now).
+		Updates(map[string]interface{}{"status": "unpublished", "unpublish_at": nil})
+	if unpublished.Error != nil {
+		return applied, unpublished.Error
+	}
+	applied += int(unpublished.RowsAffected)
+
+	return applied, failed
+}
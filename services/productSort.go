@@ -0,0 +1,115 @@
+package services
+
+import (
+	"backend/utils"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The sort orders of the product listings. Every order ends with the product ID so products
+// that tie keep their place from one page to the next.
+const (
+	SortRelevance   = "relevance" // Search results only
+	SortNewest      = "newest"
+	SortPriceAsc    = "price_asc"
+	SortPriceDesc   = "price_desc"
+	SortRating      = "rating"
+	SortBestSelling = "best_selling"
+	SortTrending    = "trending"
+	SortName        = "name"
+)
+
+const (
+	// DefaultSalesWindow is the number of days best selling and trending products are ranked by
+	DefaultSalesWindow = 30
+	// MaxSalesWindow bounds the window a request can ask for
+	MaxSalesWindow = 365
+	// TrendingHalfLife is the age in days at which a sale counts half towards trending
+	TrendingHalfLife = 7
+)
+
+var sortOrders = []string{SortRelevance, SortNewest, SortPriceAsc, SortPriceDesc, SortRating, SortBestSelling, SortTrending, SortName}
+
+// ProductSort is the validated sort order of a product listing
+type ProductSort struct {
+	Order  string
+	Window int // Days of sales counted by best_selling and trending
+}
+
+// NewProductSort validates the sort and window_days parameters, using fallback when no order is
+// given. Ordering by relevance is only possible when searching.
+func NewProductSort(order string, window *int, fallback string, searching bool) (ProductSort, error) {
+	sort := ProductSort{Order: strings.ToLower(strings.TrimSpace(order)), Window: DefaultSalesWindow}
+	if sort.Order == "" {
+		sort.Order = fallback
+	}
+
+	orders := sortOrders[1:]
+	if searching {
+		orders = sortOrders
+	}
+	known := false
+	for _, name := range orders {
+		known = known || name == sort.Order
+	}
+	if !known {
+		return sort, fmt.Errorf("sort must be one of %s", strings.Join(orders, ", "))
+	}
+
+	if window != nil {
+		if *window < 1 || *window > MaxSalesWindow {
+			return sort, fmt.Errorf("window_days must be from 1 to %d", MaxSalesWindow)
+		}
+		sort.Window = *window
+	}
+	return sort, nil
+}
+
+// salesSince sums the quantities of a product sold by orders placed in the last days, skipping
+// cancelled orders. weight scales every sold quantity.
+func salesSince(weight string) string {
+	return `(SELECT COALESCE(SUM(order_items.quantity * ` + weight + `), 0)
+		FROM order_items
+		INNER JOIN orders ON orders.id = order_items.order_id
+		WHERE order_items.product_id = products.id
+		AND orders.deleted_at IS NULL
+		AND orders.order_status <> 'cancelled'
+		AND orders.created_at >= NOW() - make_interval(days => ?))`
+}
+
+// Scope orders a products query. The relevance order needs the rank column of ProductSearch.
+func (s ProductSort) Scope() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch s.Order {
+		case SortRelevance:
+			return db.Order("rank DESC, products.id ASC")
+		case SortNewest:
+			return db.Order("products.created_at DESC, products.id DESC")
+		case SortPriceAsc:
+			return db.Order(utils.BasePriceColumn + " ASC, products.id ASC")
+		case SortPriceDesc:
+			return db.Order(utils.BasePriceColumn + " DESC, products.id ASC")
+		case SortRating:
+			return db.Order(averageRating + " DESC NULLS LAST, " +
+				"(SELECT COUNT(*) FROM reviews WHERE reviews.product_id = products.id AND reviews.deleted_at IS NULL) DESC, products.id ASC")
+		case SortBestSelling:
+			return db.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                salesSince("1") + " DESC, products.id ASC",
+				Vars:               []interface{}{s.Window},
+				WithoutParentheses: true,
+			}})
+		case SortTrending:
+			// a sale counts less the older it is, halving every TrendingHalfLife days
+			return db.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                salesSince("POWER(0.5, EXTRACT(EPOCH FROM NOW() - orders.created_at) / 86400 / ?)") + " DESC, products.id ASC",
+				Vars:               []interface{}{TrendingHalfLife, s.Window},
+				WithoutParentheses: true,
+			}})
+		default:
+			return db.Order("lower(products.name) ASC, products.id ASC")
+		}
+	}
+}
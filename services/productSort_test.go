@@ -0,0 +1,37 @@
+package services
+
+import "testing"
+
+func TestNewProductSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		order     string
+		window    *int
+		fallback  string
+		searching bool
+		want      ProductSort
+		err       bool
+	}{
+		{"fallback when empty", "", nil, SortNewest, false, ProductSort{SortNewest, DefaultSalesWindow}, false},
+		{"trimmed and lower cased", " Price_Desc ", nil, SortNewest, false, ProductSort{SortPriceDesc, DefaultSalesWindow}, false},
+		{"unknown order", "cheapest", nil, SortNewest, false, ProductSort{}, true},
+		{"relevance needs a search", SortRelevance, nil, SortNewest, false, ProductSort{}, true},
+		{"relevance when searching", SortRelevance, nil, SortNewest, true, ProductSort{SortRelevance, DefaultSalesWindow}, false},
+		{"window", SortTrending, intPtr(7), SortNewest, false, ProductSort{SortTrending, 7}, false},
+		{"longest window", SortBestSelling, intPtr(MaxSalesWindow), SortNewest, false, ProductSort{SortBestSelling, MaxSalesWindow}, false},
+		{"empty window", SortBestSelling, intPtr(0), SortNewest, false, ProductSort{}, true},
+		{"window too long", SortBestSelling, intPtr(MaxSalesWindow + 1), SortNewest, false, ProductSort{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewProductSort(test.order, test.window, test.fallback, test.searching)
+			if (err != nil) != test.err {
+				t.Fatalf("NewProductSort(%q) error = %v, want error %v", test.order, err, test.err)
+			}
+			if err == nil && got != test.want {
+				t.Errorf("NewProductSort(%q) = %+v, want %+v", test.order, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CartLine is a single product line evaluated by the promotion engine
+type CartLine struct {
+	ProductID  uint
+	VariantID  *uint
+	ParentID   *uint
+	CategoryID uint
+	TaxClassID *uint // Variations without their own tax class use the one of their parent
+	Quantity   int
+	UnitPrice  utils.Money
+}
+
+// AppliedPromotion is a promotion that matched the cart and the discount it produced
+type AppliedPromotion struct {
+	PromotionID    uint
+	Name           string
+	DiscountAmount utils.Money
+}
+
+// LoadCartLines fills in the parent and category of each line from the products table.
+// Lines without a unit price fall back to the current effective price of the variant or product.
+func LoadCartLines(db *gorm.DB, lines []CartLine) ([]CartLine, error) {
+	if len(lines) == 0 {
+		return lines, nil
+	}
+
+	ids := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ProductID)
+	}
+
+	var products []models.Product
+	if err := db.Select("id, parent_id, category_id, tax_class_id, price, sale_price, sale_start_date, sale_end_date").Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	productMap := make(map[uint]models.Product)
+	var parentIDs []uint
+	for _, product := range products {
+		productMap[product.ID] = product
+		if product.TaxClassID == nil && product.ParentID != nil {
+			parentIDs = append(parentIDs, *product.ParentID)
+		}
+	}
+
+	parentTaxClass := make(map[uint]*uint)
+	if len(parentIDs) != 0 {
+		var parents []models.Product
+		if err := db.Select("id, tax_class_id").Where("id IN ?", parentIDs).Find(&parents).Error; err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			parentTaxClass[parent.ID] = parent.TaxClassID
+		}
+	}
+
+	variants := make(map[uint]models.ProductVariant)
+	var variantIDs []uint
+	for _, line := range lines {
+		if line.VariantID != nil {
+			variantIDs = append(variantIDs, *line.VariantID)
+		}
+	}
+	if len(variantIDs) != 0 {
+		var found []models.ProductVariant
+		if err := db.Select("id, product_id, price").Where("id IN ?", variantIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, variant := range found {
+			variants[variant.ID] = variant
+		}
+	}
+
+	for i := range lines {
+		product, ok := productMap[lines[i].ProductID]
+		if !ok {
+			continue
+		}
+		lines[i].ParentID = product.ParentID
+		lines[i].CategoryID = product.CategoryID
+		lines[i].TaxClassID = product.TaxClassID
+		if product.TaxClassID == nil && product.ParentID != nil {
+			lines[i].TaxClassID = parentTaxClass[*product.ParentID]
+		}
+		if lines[i].UnitPrice == 0 {
+			lines[i].UnitPrice = product.EffectivePrice(time.Now())
+			if lines[i].VariantID != nil {
+				if variant, ok := variants[*lines[i].VariantID]; ok && variant.ProductID == product.ID {
+					lines[i].UnitPrice = variant.EffectivePrice(product, time.Now())
+				}
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// ActivePromotions returns every promotion running at the given time, highest priority first
+func ActivePromotions(db *gorm.DB, at time.Time) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+
+	err := db.Preload("Tiers").Preload("BundleItems").
+		Where("is_active = true AND start_date <= ? AND (expiration_date IS NULL OR expiration_date >= ?)", at, at).
+		Order("priority DESC, id ASC").
+		Find(&promotions).Error
+
+	return promotions, err
+}
+
+// EvaluatePromotions evaluates all active promotions against the cart and returns
+// the promotions that applied together with the total discount
+func EvaluatePromotions(db *gorm.DB, lines []CartLine) ([]AppliedPromotion, utils.Money, error) {
+	promotions, err := ActivePromotions(db, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	categoryTrees := make(map[uint]map[uint]bool)
+	for _, promotion := range promotions {
+		if promotion.PromotionType != "category" || promotion.CategoryID == nil {
+			continue
+		}
+		if _, ok := categoryTrees[*promotion.CategoryID]; ok {
+			continue
+		}
+		tree, err := categorySubtree(db, *promotion.CategoryID)
+		if err != nil {
+			return nil, 0, err
+		}
+		categoryTrees[*promotion.CategoryID] = tree
+	}
+
+	applied, total := ApplyPromotions(promotions, lines, categoryTrees)
+	return applied, total, nil
+}
+
+// ApplyPromotions runs the promotions against the cart lines in priority order.
+// A non-stackable promotion only applies when nothing has been applied before it
+// and stops every promotion after it. A unit discounted or used to qualify by one promotion
+// is not used by the promotions after it, and tiers are reached by the subtotal left after the
+// promotions before them. The total discount never exceeds the cart subtotal.
+func ApplyPromotions(promotions []models.Promotion, lines []CartLine, categoryTrees map[uint]map[uint]bool) ([]AppliedPromotion, utils.Money) {
+	sorted := make([]models.Promotion, len(promotions))
+	copy(sorted, promotions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority > sorted[j].Priority })
+
+	var subtotal utils.Money
+	free := make([]int, len(lines)) // Units of each line no promotion has used yet
+	for i, line := range lines {
+		subtotal += line.UnitPrice.Mul(line.Quantity)
+		free[i] = max(line.Quantity, 0)
+	}
+
+	var applied []AppliedPromotion
+	var total utils.Money
+
+	for _, promotion := range sorted {
+		if !promotion.Stackable && len(applied) > 0 {
+			continue
+		}
+
+		// the units are only used up once the promotion applies
+		left := append([]int(nil), free...)
+		var discount utils.Money
+		switch promotion.PromotionType {
+		case "buy_x_get_y":
+			discount = buyXGetYDiscount(promotion, lines, left)
+		case "tiered":
+			discount = tieredDiscount(promotion, subtotal-total)
+		case "category":
+			discount = categoryDiscount(promotion, lines, left, categoryTrees[derefUint(promotion.CategoryID)])
+		case "bundle":
+			discount = bundleDiscount(promotion, lines, left)
+		}
+
+		discount = utils.MinMoney(discount, subtotal-total)
+		if discount <= 0 {
+			continue
+		}
+
+		applied = append(applied, AppliedPromotion{
+			PromotionID:    promotion.ID,
+			Name:           promotion.Name,
+			DiscountAmount: discount,
+		})
+		total += discount
+		free = left
+
+		if !promotion.Stackable {
+			break
+		}
+	}
+
+	return applied, total
+}
+
+// takeUnits uses up to n free units of the lines of a product, the cheapest first or the
+// dearest first, and returns how many it took and what they cost. perUnit maps the price of a
+// unit to the amount counted for it.
+func takeUnits(lines []CartLine, free []int, productID uint, n int, cheapest bool, perUnit func(utils.Money) utils.Money) (int, utils.Money) {
+	var matching []int
+	for i, line := range lines {
+		if free[i] > 0 && lineMatches(line, productID) {
+			matching = append(matching, i)
+		}
+	}
+	sort.SliceStable(matching, func(a, b int) bool {
+		if cheapest {
+			return lines[matching[a]].UnitPrice < lines[matching[b]].UnitPrice
+		}
+		return lines[matching[a]].UnitPrice > lines[matching[b]].UnitPrice
+	})
+
+	taken := 0
+	var amount utils.Money
+	for _, i := range matching {
+		units := min(free[i], n-taken)
+		free[i] -= units
+		taken += units
+		amount += perUnit(lines[i].UnitPrice).Mul(units)
+		if taken == n {
+			break
+		}
+	}
+	return taken, amount
+}
+
+// freeUnits counts the free units of the lines of a product
+func freeUnits(lines []CartLine, free []int, productID uint) int {
+	units := 0
+	for i, line := range lines {
+		if lineMatches(line, productID) {
+			units += free[i]
+		}
+	}
+	return units
+}
+
+func unitPrice(price utils.Money) utils.Money { return price }
+
+func buyXGetYDiscount(promotion models.Promotion, lines []CartLine, free []int) utils.Money {
+	buyID := derefUint(promotion.BuyProductID)
+	getID := buyID
+	if promotion.GetProductID != nil {
+		getID = *promotion.GetProductID
+	}
+	buyQuantity := derefInt(promotion.BuyQuantity)
+	getQuantity := derefInt(promotion.GetQuantity)
+	if buyQuantity <= 0 || getQuantity <= 0 {
+		return 0
+	}
+	percent := 100.0
+	if promotion.GetDiscountPercent != nil {
+		percent = *promotion.GetDiscountPercent
+	}
+	reduced := func(price utils.Money) utils.Money { return price.Percent(percent) }
+
+	var times int
+	if getID == buyID {
+		times = freeUnits(lines, free, buyID) / (buyQuantity + getQuantity)
+	} else {
+		times = min(freeUnits(lines, free, buyID)/buyQuantity, freeUnits(lines, free, getID)/getQuantity)
+	}
+	if times == 0 {
+		return 0
+	}
+
+	// the cheapest matching units are the discounted ones, the dearest ones are bought
+	_, discount := takeUnits(lines, free, getID, times*getQuantity, true, reduced)
+	takeUnits(lines, free, buyID, times*buyQuantity, false, unitPrice)
+	return discount
+}
+
+func tieredDiscount(promotion models.Promotion, subtotal utils.Money) utils.Money {
+	var best *models.PromotionTier
+	for i, tier := range promotion.Tiers {
+		if tier.MinOrderValue <= subtotal && (best == nil || tier.MinOrderValue > best.MinOrderValue) {
+			best = &promotion.Tiers[i]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+
+	if best.DiscountType == "percentage" {
+		return subtotal.Percent(best.DiscountValue.Float64())
+	}
+	return best.DiscountValue
+}
+
+func categoryDiscount(promotion models.Promotion, lines []CartLine, free []int, tree map[uint]bool) utils.Money {
+	if promotion.DiscountPercent == nil || tree == nil {
+		return 0
+	}
+
+	var eligible utils.Money
+	for i, line := range lines {
+		if tree[line.CategoryID] {
+			eligible += line.UnitPrice.Mul(free[i])
+			free[i] = 0
+		}
+	}
+
+	return eligible.Percent(*promotion.DiscountPercent)
+}
+
+func bundleDiscount(promotion models.Promotion, lines []CartLine, free []int) utils.Money {
+	if promotion.BundlePrice == nil || len(promotion.BundleItems) == 0 {
+		return 0
+	}
+
+	// an item listed twice needs the units of both
+	need := make(map[uint]int)
+	var products []uint
+	for _, item := range promotion.BundleItems {
+		if item.Quantity <= 0 {
+			return 0
+		}
+		if _, ok := need[item.ProductID]; !ok {
+			products = append(products, item.ProductID)
+		}
+		need[item.ProductID] += item.Quantity
+	}
+
+	times := math.MaxInt
+	for _, productID := range products {
+		times = min(times, freeUnits(lines, free, productID)/need[productID])
+	}
+	if times == 0 {
+		return 0
+	}
+
+	var regular utils.Money
+	for _, productID := range products {
+		_, amount := takeUnits(lines, free, productID, times*need[productID], true, unitPrice)
+		regular += amount
+	}
+
+	saving := regular - promotion.BundlePrice.Mul(times)
+	if saving <= 0 {
+		return 0
+	}
+	return saving
+}
+
+// categorySubtree returns the ids of a category and every category below it
+func categorySubtree(db *gorm.DB, categoryID uint) (map[uint]bool, error) {
+	var ids []uint
+	if err := CategorySubtree(db, categoryID).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	tree := make(map[uint]bool)
+	for _, id := range ids {
+		tree[id] = true
+	}
+	return tree, nil
+}
+
+// lineMatches reports whether a line is the product itself or one of its variations
+func lineMatches(line CartLine, productID uint) bool {
+	return line.ProductID == productID || (line.ParentID != nil && *line.ParentID == productID)
+}
+
+func derefUint(value *uint) uint {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func derefInt(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
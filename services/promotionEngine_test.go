@@ -0,0 +1,81 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"testing"
+)
+
+func intPtr(v int) *int                   { return &v }
+func uintPtr(v uint) *uint                { return &v }
+func floatPtr(v float64) *float64         { return &v }
+func moneyPtr(v utils.Money) *utils.Money { return &v }
+
+func TestApplyPromotions(t *testing.T) {
+	bogo := models.Promotion{PromotionType: "buy_x_get_y", Priority: 30, Stackable: true,
+		BuyProductID: uintPtr(1), BuyQuantity: intPtr(1), GetQuantity: intPtr(1)}
+	bogo.ID = 1
+	category := models.Promotion{PromotionType: "category", Priority: 20, Stackable: true,
+		CategoryID: uintPtr(10), DiscountPercent: floatPtr(10)}
+	category.ID = 2
+	tiered := models.Promotion{PromotionType: "tiered", Priority: 10, Stackable: true,
+		Tiers: []models.PromotionTier{{MinOrderValue: 10000, DiscountType: "fixed", DiscountValue: 1500}}}
+	tiered.ID = 3
+	bundle := models.Promotion{PromotionType: "bundle", Priority: 25, Stackable: true, BundlePrice: moneyPtr(2500),
+		BundleItems: []models.PromotionBundleItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}}}
+	bundle.ID = 4
+	exclusive := models.Promotion{PromotionType: "category", Priority: 40, Stackable: false,
+		CategoryID: uintPtr(10), DiscountPercent: floatPtr(50)}
+	exclusive.ID = 5
+
+	trees := map[uint]map[uint]bool{10: {10: true}}
+	shirts := CartLine{ProductID: 1, CategoryID: 10, Quantity: 2, UnitPrice: 2000}
+	hats := CartLine{ProductID: 2, CategoryID: 10, Quantity: 1, UnitPrice: 1500}
+	shoes := CartLine{ProductID: 3, CategoryID: 20, Quantity: 1, UnitPrice: 9000}
+
+	tests := []struct {
+		name       string
+		promotions []models.Promotion
+		lines      []CartLine
+		want       []utils.Money // Discount of each applied promotion, in order
+		total      utils.Money
+	}{
+		{"buy one get one free", []models.Promotion{bogo}, []CartLine{shirts}, []utils.Money{2000}, 2000},
+		{"bogo needs both units", []models.Promotion{bogo}, []CartLine{{ProductID: 1, Quantity: 1, UnitPrice: 2000}}, nil, 0},
+		// the shirts are used by the bogo, only the hat is left for the category
+		{"units are not discounted twice", []models.Promotion{bogo, category}, []CartLine{shirts, hats}, []utils.Money{2000, 150}, 2150},
+		// 4000 + 1500 + 9000 = 14500, 12500 left after the bogo still reaches the tier
+		{"tier after bogo", []models.Promotion{bogo, tiered}, []CartLine{shirts, hats, shoes}, []utils.Money{2000, 1500}, 3500},
+		// 4000 + 9000 = 13000, 11000 left after the bogo, 10900 after the category promotion
+		{"tier reached by the subtotal left", []models.Promotion{bogo, category, tiered},
+			[]CartLine{shirts, {ProductID: 4, CategoryID: 10, Quantity: 1, UnitPrice: 1000}, shoes}, []utils.Money{2000, 100, 1500}, 3600},
+		{"tier missed after discounts", []models.Promotion{bogo, tiered},
+			[]CartLine{shirts, {ProductID: 3, Quantity: 1, UnitPrice: 7000}}, []utils.Money{2000}, 2000},
+		// the bogo uses both shirts, the bundle finds none left for the hat
+		{"bundle after bogo", []models.Promotion{bogo, bundle}, []CartLine{shirts, hats}, []utils.Money{2000}, 2000},
+		// a shirt and the hat make the bundle, the other shirt has no free one
+		{"bundle with one shirt", []models.Promotion{bogo, bundle}, []CartLine{{ProductID: 1, Quantity: 1, UnitPrice: 2000}, hats}, []utils.Money{1000}, 1000},
+		{"non-stackable stops the rest", []models.Promotion{exclusive, bogo, tiered}, []CartLine{shirts, shoes}, []utils.Money{2000}, 2000},
+		{"non-stackable skipped after another", []models.Promotion{bogo, {PromotionType: "tiered", Priority: 5, Stackable: false,
+			Tiers: []models.PromotionTier{{MinOrderValue: 0, DiscountType: "percentage", DiscountValue: 1000}}}}, []CartLine{shirts}, []utils.Money{2000}, 2000},
+		{"capped at the subtotal", []models.Promotion{{PromotionType: "tiered", Stackable: true,
+			Tiers: []models.PromotionTier{{MinOrderValue: 0, DiscountType: "fixed", DiscountValue: 99999}}}}, []CartLine{hats}, []utils.Money{1500}, 1500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applied, total := ApplyPromotions(test.promotions, test.lines, trees)
+			if total != test.total {
+				t.Errorf("total = %s, want %s", total, test.total)
+			}
+			if len(applied) != len(test.want) {
+				t.Fatalf("applied %d promotions %+v, want %d", len(applied), applied, len(test.want))
+			}
+			for i, promotion := range applied {
+				if promotion.DiscountAmount != test.want[i] {
+					t.Errorf("promotion %d discount = %s, want %s", i, promotion.DiscountAmount, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownRelated = errors.New("related products must be listed once, be products rather than variations and not the product itself")
+
+const (
+	// DefaultCoPurchaseWindow is the number of days of orders co-purchases are counted over
+	DefaultCoPurchaseWindow = 365
+	// MinCoPurchaseOrders is the number of orders a pair of products needs to be recommended
+	MinCoPurchaseOrders = 2
+	// MaxCoPurchases bounds the co-purchases kept per product, the most frequent first
+	MaxCoPurchases = 20
+	// DefaultRecommendations is the number of products of each kind of recommendation
+	DefaultRecommendations = 8
+	// SimilarPriceBand is how far, as a share of its price, the price of a similar product may be
+	SimilarPriceBand = 0.25
+)
+
+// parentProduct maps a variation stored as a child product to its parent product
+const parentProduct = "CASE WHEN products.is_child AND products.parent_id IS NOT NULL THEN products.parent_id ELSE products.id END"
+
+// Recommendations are the products recommended next to a product, best first. A product only
+// shows in the first list it belongs to.
+type Recommendations struct {
+	Related        []uint // Linked by hand
+	BoughtTogether []uint // Often in the same orders
+	Similar        []uint // Of the same category or brand at a similar price
+}
+
+// recommendable keeps the published parent products
+func recommendable(db *gorm.DB) *gorm.DB {
+	return db.Where("products.status = ? AND products.is_child = false", "published")
+}
+
+// Recommend returns up to limit products of each kind of recommendation for a product
+func Recommend(db *gorm.DB, productID uint, limit int) (Recommendations, error) {
+	var recommendations Recommendations
+	seen := map[uint]bool{productID: true}
+	keep := func(ids []uint) []uint {
+		kept := []uint{}
+		for _, id := range ids {
+			if !seen[id] && len(kept) < limit {
+				seen[id] = true
+				kept = append(kept, id)
+			}
+		}
+		return kept
+	}
+
+	var ids []uint
+	if err := db.Model(&models.ProductRelation{}).
+		Joins("INNER JOIN products ON products.id = product_relations.related_product_id AND products.deleted_at IS NULL").
+		Scopes(recommendable).Where("product_relations.product_id = ?", productID).
+		Order("product_relations.position ASC, product_relations.id ASC").
+		Pluck("product_relations.related_product_id", &ids).Error; err != nil {
+		return recommendations, err
+	}
+	recommendations.Related = keep(ids)
+
+	ids = nil
+	if err := db.Model(&models.ProductCoPurchase{}).
+		Joins("INNER JOIN products ON products.id = product_co_purchases.related_product_id AND products.deleted_at IS NULL").
+		Scopes(recommendable).Where("product_co_purchases.product_id = ?", productID).
+		Order("product_co_purchases.orders DESC, product_co_purchases.confidence DESC, product_co_purchases.related_product_id ASC").
+		Limit(limit+len(seen)).Pluck("product_co_purchases.related_product_id", &ids).Error; err != nil {
+		return recommendations, err
+	}
+	recommendations.BoughtTogether = keep(ids)
+
+	ids, err := similarProducts(db, productID, limit+len(seen))
+	if err != nil {
+		return recommendations, err
+	}
+	recommendations.Similar = keep(ids)
+	return recommendations, nil
+}
+
+// similarProducts ranks the products of the same category or brand, the same category counting
+// most, then the same brand and a price within SimilarPriceBand, prices compared in the base currency
+func similarProducts(db *gorm.DB, productID uint, limit int) ([]uint, error) {
+	var product struct {
+		CategoryID uint
+		BrandID    *uint
+		BasePrice  utils.Money
+	}
+	if err := db.Model(&models.Product{}).Select("category_id, brand_id, "+utils.BasePriceColumn+" AS base_price").
+		Where("id = ?", productID).Take(&product).Error; err != nil {
+		return nil, err
+	}
+
+	band := utils.MoneyFromFloat(product.BasePrice.Float64() * SimilarPriceBand)
+	low, high := product.BasePrice-band, product.BasePrice+band
+	score := `(CASE WHEN products.category_id = ? THEN 2 ELSE 0 END)
+		+ (CASE WHEN products.brand_id = ? THEN 1 ELSE 0 END)
+		+ (CASE WHEN ` + utils.BasePriceColumn + ` BETWEEN ? AND ? THEN 1 ELSE 0 END)`
+
+	var ids []uint
+	err := db.Model(&models.Product{}).Scopes(recommendable).
+		Where("products.id <> ? AND (products.category_id = ? OR products.brand_id = ?)", productID, product.CategoryID, product.BrandID).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                score + " DESC, ABS(" + utils.BasePriceColumn + " - ?) ASC, products.id ASC",
+			Vars:               []interface{}{product.CategoryID, product.BrandID, low, high, product.BasePrice},
+			WithoutParentheses: true,
+		}}).
+		Limit(limit).Pluck("products.id", &ids).Error
+	return ids, err
+}
+
+// RecommendForCart returns up to limit products often bought with the products of a cart, the
+// products linked to them by hand following, leaving out what the cart already has
+func RecommendForCart(db *gorm.DB, productIDs []uint, limit int) ([]uint, error) {
+	recommended := []uint{}
+	if len(productIDs) == 0 {
+		return recommended, nil
+	}
+	var parents []uint
+	if err := db.Unscoped().Model(&models.Product{}).Where("id IN ?", productIDs).
+		Distinct().Pluck(parentProduct, &parents).Error; err != nil {
+		return nil, err
+	}
+
+	var boughtTogether []uint
+	if err := db.Model(&models.ProductCoPurchase{}).
+		Joins("INNER JOIN products ON products.id = product_co_purchases.related_product_id AND products.deleted_at IS NULL").
+		Scopes(recommendable).
+		Where("product_co_purchases.product_id IN ? AND product_co_purchases.related_product_id NOT IN ?", parents, parents).
+		Group("product_co_purchases.related_product_id").
+		Order("SUM(product_co_purchases.confidence) DESC, SUM(product_co_purchases.orders) DESC, product_co_purchases.related_product_id ASC").
+		Limit(limit).Pluck("product_co_purchases.related_product_id", &boughtTogether).Error; err != nil {
+		return nil, err
+	}
+
+	var related []uint
+	if err := db.Model(&models.ProductRelation{}).
+		Joins("INNER JOIN products ON products.id = product_relations.related_product_id AND products.deleted_at IS NULL").
+		Scopes(recommendable).
+		Where("product_relations.product_id IN ? AND product_relations.related_product_id NOT IN ?", parents, parents).
+		Order("product_relations.position ASC, product_relations.id ASC").
+		Pluck("product_relations.related_product_id", &related).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	for _, id := range append(boughtTogether, related...) {
+		if !seen[id] && len(recommended) < limit {
+			seen[id] = true
+			recommended = append(recommended, id)
+		}
+	}
+	return recommended, nil
+}
+
+// SetRelatedProducts replaces the products linked to a product by hand with relatedIDs, in their
+// order
+func SetRelatedProducts(tx *gorm.DB, productID uint, relatedIDs []uint) error {
+	seen := map[uint]bool{productID: true}
+	for _, id := range relatedIDs {
+		if seen[id] {
+			return ErrUnknownRelated
+		}
+		seen[id] = true
+	}
+	if len(relatedIDs) != 0 {
+		var count int64
+		if err := tx.Model(&models.Product{}).Where("id IN ? AND is_child = false", relatedIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(relatedIDs) {
+			return ErrUnknownRelated
+		}
+	}
+
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductRelation{}).Error; err != nil {
+		return err
+	}
+	if len(relatedIDs) == 0 {
+		return nil
+	}
+	relations := make([]models.ProductRelation, 0, len(relatedIDs))
+	for position, id := range relatedIDs {
+		relations = append(relations, models.ProductRelation{ProductID: productID, RelatedProductID: id, Position: position})
+	}
+	return tx.Create(&relations).Error
+}
+
+// ComputeCoPurchases recounts the products bought together from the orders placed in the last
+// days, skipping cancelled orders, and replaces the stored co-purchases. Variations count as
+// their parent product. It returns the number of pairs kept.
+func ComputeCoPurchases(db *gorm.DB, days int) (int64, error) {
+	var kept int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.ProductCoPurchase{}).Error; err != nil {
+			return err
+		}
+		result := tx.Exec(`WITH lines AS (
+				SELECT DISTINCT order_items.order_id, `+parentProduct+` AS product_id
+				FROM order_items
+				INNER JOIN orders ON orders.id = order_items.order_id
+				INNER JOIN products ON products.id = order_items.product_id
+				WHERE orders.deleted_at IS NULL
+				AND orders.order_status <> 'cancelled'
+				AND orders.created_at >= NOW() - make_interval(days => ?)
+			),
+			totals AS (
+				SELECT product_id, COUNT(*) AS orders FROM lines GROUP BY product_id
+			),
+			pairs AS (
+				SELECT a.product_id, b.product_id AS related_product_id, COUNT(*) AS orders
+				FROM lines AS a
+				INNER JOIN lines AS b ON b.order_id = a.order_id AND b.product_id <> a.product_id
+				GROUP BY a.product_id, b.product_id
+				HAVING COUNT(*) >= ?
+			)
+			INSERT INTO product_co_purchases (product_id, related_product_id, orders, confidence, computed_at)
+			SELECT product_id, related_product_id, orders, confidence, NOW()
+			FROM (
+				SELECT pairs.product_id, pairs.related_product_id, pairs.orders,
+					ROUND(pairs.orders::numeric / totals.orders, 4) AS confidence,
+					ROW_NUMBER() OVER (PARTITION BY pairs.product_id ORDER BY pairs.orders DESC, pairs.related_product_id ASC) AS rank
+				FROM pairs
+				INNER JOIN totals ON totals.product_id = pairs.product_id
+			) AS ranked
+			WHERE rank <= ?`, days, MinCoPurchaseOrders, MaxCoPurchases)
+		kept = result.RowsAffected
+		return result.Error
+	})
+	return kept, err
+}
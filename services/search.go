@@ -0,0 +1,154 @@
+package services
+
+import (
+	"backend/models"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchSimilarity is the trigram word similarity from which a product name matches a misspelled
+// query, such as "shrit" for "Shirt". SearchTransaction sets it for the <% operator.
+const searchSimilarity = 0.3
+
+// searchHeadline marks the matched words of a highlighted text
+const searchHeadline = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \""
+
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// escapeHTML is the SQL escaping the HTML special characters of a text column, so highlights
+// only ever hold the tags of searchHeadline
+func escapeHTML(column string) string {
+	return `replace(replace(replace(replace(replace(` + column +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// searchVector builds the search document of a product. The simple configuration doesn't stem,
+// prefix matching of the query covers plurals and words that are still being typed.
+// Name and SKU weigh most, then the brand, the category path and option values, then the description.
+const searchVector = `
+	setweight(to_tsvector('simple', coalesce(products.name, '') || ' ' || coalesce(products.sku, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce((SELECT brands.name FROM brands WHERE brands.id = products.brand_id), '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce((
+		SELECT string_agg(ancestors.name, ' ' ORDER BY ancestors.depth)
+		FROM categories AS ancestors
+		INNER JOIN categories ON categories.path LIKE ancestors.path || '%'
+		WHERE categories.id = products.category_id AND ancestors.path <> ''
+	), '') || ' ' || coalesce((
+		SELECT string_agg(DISTINCT product_option_values.value, ' ')
+		FROM product_options
+		INNER JOIN product_option_values ON product_option_values.option_id = product_options.id
+		WHERE product_options.product_id = products.id
+	), '')), 'C') ||
+	setweight(to_tsvector('simple', coalesce(products.description, '')), 'D')`
+
+// SearchTerms turns what a customer typed into a prefix matching tsquery, "linen shi" becomes
+// "linen:* & shi:*". Anything that isn't a letter or digit is dropped, so the result is safe
+// to pass to to_tsquery. It is empty when nothing searchable is left.
+func SearchTerms(text string) string {
+	words := searchWord.FindAllString(strings.ToLower(text), -1)
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// ProductSearch narrows a products query to the products matching text, by full text or by a
+// similar name for misspellings. Next to the given columns it selects the relevance as rank,
+// name_highlight with the matched words marked and a highlighted description snippet, both HTML
+// with the product text escaped. Run it in a SearchTransaction.
+func ProductSearch(query *gorm.DB, text string, columns string) *gorm.DB {
+	text = strings.TrimSpace(text)
+	terms := SearchTerms(text)
+	if terms == "" {
+		return query.Select(columns + `, 0 AS rank, ` + escapeHTML("products.name") + ` AS name_highlight, '' AS snippet`)
+	}
+
+	named := map[string]interface{}{"terms": terms, "text": text, "headline": searchHeadline}
+	return MatchSearch(query, text).
+		Select(columns+`,
+			ts_rank_cd(products.search_vector, to_tsquery('simple', @terms), 32) + word_similarity(@text, products.name) AS rank,
+			ts_headline('simple', `+escapeHTML("products.name")+`, to_tsquery('simple', @terms), 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>') AS name_highlight,
+			ts_headline('simple', `+escapeHTML("coalesce(products.description, '')")+`, to_tsquery('simple', @terms), @headline) AS snippet`, named)
+}
+
+// MatchSearch narrows a products query to the products matching text, by full text or by a
+// similar name for misspellings. An empty text matches every product. Both conditions can use
+// an index; the <% operator matches names from the similarity SearchTransaction sets.
+func MatchSearch(query *gorm.DB, text string) *gorm.DB {
+	text = strings.TrimSpace(text)
+	terms := SearchTerms(text)
+	if terms == "" {
+		return query
+	}
+	return query.Where("(products.search_vector @@ to_tsquery('simple', @terms) OR @text <% products.name)",
+		map[string]interface{}{"terms": terms, "text": text})
+}
+
+// SearchTransaction runs fn in a transaction in which MatchSearch takes a name as a misspelling
+// of the query from searchSimilarity on. The setting ends with the transaction.
+func SearchTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		threshold := strconv.FormatFloat(searchSimilarity, 'f', -1, 64)
+		if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", threshold).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// RefreshSearchIndex rebuilds the search document of the given products, or of every product
+// when no IDs are given. Call it after anything the document is built from has changed.
+func RefreshSearchIndex(db *gorm.DB, productIDs ...uint) error {
+	// the column is written by table name, the model field is hidden from gorm so saving a
+	// product never overwrites its document
+	query := db.Table("products").Session(&gorm.Session{AllowGlobalUpdate: true})
+	if len(productIDs) != 0 {
+		query = query.Where("id IN ?", productIDs)
+	}
+	return query.UpdateColumn("search_vector", gorm.Expr(searchVector)).Error
+}
+
+// RefreshBrandSearch rebuilds the search documents of the products of a brand
+func RefreshBrandSearch(db *gorm.DB, brandID uint) error {
+	var ids []uint
+	if err := db.Model(&models.Product{}).Where("brand_id = ?", brandID).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return RefreshSearchIndex(db, ids...)
+}
+
+// RefreshCategorySearch rebuilds the search documents of the products in a category and its
+// subcategories, as their documents contain the names of all ancestors
+func RefreshCategorySearch(db *gorm.DB, categoryID uint) error {
+	var ids []uint
+	if err := db.Model(&models.Product{}).Where("category_id IN (?)", CategorySubtree(db, categoryID)).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return RefreshSearchIndex(db, ids...)
+}
+
+// PrepareSearchIndex installs the trigram extension and the indexes search relies on. It is
+// safe to run repeatedly.
+func PrepareSearchIndex(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector",
+		"CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector)",
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING gin (name gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
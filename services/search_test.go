@@ -0,0 +1,60 @@
+package services
+
+import (
+	"backend/models"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"single word", "Shirt", "shirt:*"},
+		{"words still being typed", "linen shi", "linen:* & shi:*"},
+		{"digits", "iPhone 15", "iphone:* & 15:*"},
+		{"accents", "Café Crème", "café:* & crème:*"},
+		{"extra spaces", "  red   dress ", "red:* & dress:*"},
+		{"hyphens split words", "t-shirt", "t:* & shirt:*"},
+		{"tsquery operators are dropped", "a & !b | (c:*) <-> d", "a:* & b:* & c:* & d:*"},
+		{"quotes are dropped", "'); DROP TABLE products; --", "drop:* & table:* & products:*"},
+		{"nothing searchable", "!!! ???", ""},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SearchTerms(test.text); got != test.want {
+				t.Errorf("SearchTerms(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestProductSearch(t *testing.T) {
+	db, log := dryRun(t)
+	var products []models.Product
+	ProductSearch(db.Model(&models.Product{}), " shrit ", "products.id").Find(&products)
+	if len(log.statements) != 1 {
+		t.Fatalf("statements = %q, want 1", log.statements)
+	}
+	statement := log.statements[0]
+
+	want := []string{
+		// the trigram index only serves the operator, not a comparison of word_similarity
+		`'shrit' <% products.name`,
+		// the product text is escaped before ts_headline adds its tags
+		`ts_headline('simple', replace(replace(replace(replace(replace(products.name, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),`,
+		`ts_headline('simple', replace(replace(replace(replace(replace(coalesce(products.description, ''), '&', '&amp;')`,
+	}
+	for _, fragment := range want {
+		if !strings.Contains(statement, fragment) {
+			t.Errorf("statement = %s, want it to contain %s", statement, fragment)
+		}
+	}
+	if strings.Contains(statement, ">= 0.3") {
+		t.Errorf("statement = %s, want no similarity comparison", statement)
+	}
+}
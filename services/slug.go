@@ -0,0 +1,123 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The records addressed by slugs
+const (
+	SlugProduct  = "product"
+	SlugCategory = "category"
+	SlugBrand    = "brand"
+)
+
+var (
+	ErrInvalidSlug = errors.New("a slug needs at least one letter or digit")
+	ErrSlugTaken   = errors.New("the slug is already used")
+)
+
+// slugColumns are the table and column holding the slugs of each record type
+var slugColumns = map[string][2]string{
+	SlugProduct:  {"products", "slug"},
+	SlugCategory: {"categories", "slug"},
+	SlugBrand:    {"brands", "permalink"},
+}
+
+// ChangeSlug gives a record the slug requested, normalized, and redirects its old slug to it.
+// An old slug redirecting elsewhere is taken over when requested again.
+func ChangeSlug(tx *gorm.DB, entityType string, id uint, current string, requested string) (string, error) {
+	slug := utils.Slugify(requested)
+	if slug == "" {
+		return current, ErrInvalidSlug
+	}
+	if slug == current {
+		return current, nil
+	}
+
+	table, column := slugColumns[entityType][0], slugColumns[entityType][1]
+	var count int64
+	if err := tx.Table(table).Where(column+" = ? AND id <> ?", slug, id).Count(&count).Error; err != nil {
+		return current, err
+	}
+	if count > 0 {
+		return current, ErrSlugTaken
+	}
+
+	if err := tx.Where("entity_type = ? AND slug = ?", entityType, slug).Delete(&models.SlugRedirect{}).Error; err != nil {
+		return current, err
+	}
+	if current != "" {
+		redirect := models.SlugRedirect{EntityType: entityType, Slug: current, EntityID: id}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "entity_type"}, {Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"entity_id"}),
+		}).Create(&redirect).Error; err != nil {
+			return current, err
+		}
+	}
+
+	if err := tx.Table(table).Where("id = ?", id).Update(column, slug).Error; err != nil {
+		return current, err
+	}
+	return slug, nil
+}
+
+// ResolveSlug finds the record of a slug. When the slug is an old one, current is the slug the
+// record has now and the caller should redirect to it.
+func ResolveSlug(db *gorm.DB, entityType string, slug string) (id uint, current string, err error) {
+	table, column := slugColumns[entityType][0], slugColumns[entityType][1]
+
+	var ids []uint
+	if err := db.Table(table).Where(column+" = ? AND deleted_at IS NULL", slug).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, "", err
+	}
+	if len(ids) != 0 {
+		return ids[0], slug, nil
+	}
+
+	var redirect models.SlugRedirect
+	if err := db.Where("entity_type = ? AND slug = ?", entityType, slug).First(&redirect).Error; err != nil {
+		return 0, "", err
+	}
+	var slugs []string
+	if err := db.Table(table).Where("id = ? AND deleted_at IS NULL", redirect.EntityID).Limit(1).Pluck(column, &slugs).Error; err != nil {
+		return 0, "", err
+	}
+	if len(slugs) == 0 {
+		return 0, "", gorm.ErrRecordNotFound
+	}
+	return redirect.EntityID, slugs[0], nil
+}
+
+// BackfillSlugs generates the slugs of the products, categories and brands created before slugs
+// existed and returns how many were set
+func BackfillSlugs(db *gorm.DB) (int, error) {
+	filled := 0
+	for _, entityType := range []string{SlugProduct, SlugCategory, SlugBrand} {
+		table, column := slugColumns[entityType][0], slugColumns[entityType][1]
+
+		var rows []struct {
+			ID   uint
+			Name string
+		}
+		if err := db.Table(table).Select("id, name").Where(column + " = '' OR " + column + " IS NULL").Order("id ASC").Scan(&rows).Error; err != nil {
+			return filled, err
+		}
+		for _, row := range rows {
+			slug, err := models.UniqueSlug(db, table, column, row.Name, row.ID)
+			if err != nil {
+				return filled, err
+			}
+			if err := db.Table(table).Where("id = ?", row.ID).Update(column, slug).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+	return filled, nil
+}
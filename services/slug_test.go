@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChangeSlug(t *testing.T) {
+	tests := []struct {
+		name       string
+		entityType string
+		current    string
+		requested  string
+		want       string
+		err        error
+		statements []string // Fragments of the statements sent, in order
+	}{
+		{"nothing to slugify", SlugProduct, "red-shirt", " -- ", "red-shirt", ErrInvalidSlug, nil},
+		{"same slug once normalized", SlugProduct, "red-shirt", "Red Shirt", "red-shirt", nil, nil},
+		// the old slug redirects to the record, taking over a redirect it had to another record
+		{"product", SlugProduct, "red-shirt", "Crimson Shirt", "crimson-shirt", nil, []string{
+			`SELECT count(*) FROM "products" WHERE slug = 'crimson-shirt' AND id <> 4`,
+			`DELETE FROM "slug_redirects" WHERE entity_type = 'product' AND slug = 'crimson-shirt'`,
+			`ON CONFLICT ("entity_type","slug") DO UPDATE SET "entity_id"="excluded"."entity_id"`,
+			`UPDATE "products" SET "slug"='crimson-shirt' WHERE id = 4`,
+		}},
+		{"brand permalink", SlugBrand, "acme", "Acme Inc", "acme-inc", nil, []string{
+			`SELECT count(*) FROM "brands" WHERE permalink = 'acme-inc' AND id <> 4`,
+			`DELETE FROM "slug_redirects" WHERE entity_type = 'brand' AND slug = 'acme-inc'`,
+			`ON CONFLICT ("entity_type","slug") DO UPDATE SET "entity_id"="excluded"."entity_id"`,
+			`UPDATE "brands" SET "permalink"='acme-inc' WHERE id = 4`,
+		}},
+		{"no old slug to redirect", SlugCategory, "", "Shoes", "shoes", nil, []string{
+			`SELECT count(*) FROM "categories" WHERE slug = 'shoes' AND id <> 4`,
+			`DELETE FROM "slug_redirects" WHERE entity_type = 'category' AND slug = 'shoes'`,
+			`UPDATE "categories" SET "slug"='shoes' WHERE id = 4`,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, log := dryRun(t)
+			got, err := ChangeSlug(db, test.entityType, 4, test.current, test.requested)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ChangeSlug(%q) error = %v, want %v", test.requested, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("ChangeSlug(%q) = %q, want %q", test.requested, got, test.want)
+			}
+			if len(log.statements) != len(test.statements) {
+				t.Fatalf("statements = %q, want %d", log.statements, len(test.statements))
+			}
+			for i, fragment := range test.statements {
+				if !strings.Contains(log.statements[i], fragment) {
+					t.Errorf("statement %d = %s, want it to contain %s", i, log.statements[i], fragment)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TaxAddress is the destination an order is taxed for
+type TaxAddress struct {
+	Country    string
+	Region     string
+	PostalCode string
+}
+
+// TaxLine is a single taxable line. Amount is the line total after discounts.
+type TaxLine struct {
+	Reference  int // Index of the line in the caller's slice
+	ProductID  uint
+	TaxClassID *uint
+	Amount     utils.Money
+}
+
+type TaxRequest struct {
+	Address          TaxAddress
+	Lines            []TaxLine
+	Shipping         utils.Money
+	PricesIncludeTax bool
+}
+
+type TaxLineResult struct {
+	Reference int
+	Rate      float64
+	TaxAmount utils.Money
+}
+
+// TaxBreakdown is the tax charged for one named rate across the whole request
+type TaxBreakdown struct {
+	Name          string
+	Rate          float64
+	TaxableAmount utils.Money
+	TaxAmount     utils.Money
+}
+
+type TaxResult struct {
+	Lines        []TaxLineResult
+	ShippingRate float64
+	ShippingTax  utils.Money
+	TotalTax     utils.Money // Line tax plus shipping tax
+	Breakdown    []TaxBreakdown
+}
+
+// TaxCalculator computes the tax of an order. The built-in implementation uses the
+// local rate table; an external tax service can be plugged in through NewTaxCalculator.
+type TaxCalculator interface {
+	Calculate(request TaxRequest) (*TaxResult, error)
+}
+
+// NewTaxCalculator returns the calculator used at checkout
+var NewTaxCalculator = func(db *gorm.DB) TaxCalculator {
+	return &RateTableCalculator{DB: db}
+}
+
+// TaxSettings returns the tax configuration, falling back to exclusive pricing without tax
+func TaxSettings(db *gorm.DB) (models.TaxSetting, error) {
+	var setting models.TaxSetting
+	if err := db.Order("id ASC").First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.TaxSetting{}, nil
+		}
+		return setting, err
+	}
+	return setting, nil
+}
+
+// RateTableCalculator calculates tax from the tax_rates table
+type RateTableCalculator struct {
+	DB *gorm.DB
+}
+
+func (r *RateTableCalculator) Calculate(request TaxRequest) (*TaxResult, error) {
+	setting, err := TaxSettings(r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	country := request.Address.Country
+	if country == "" {
+		country = setting.DefaultCountry
+	}
+
+	var rates []models.TaxRate
+	if country != "" {
+		if err := r.DB.Where("LOWER(country) = LOWER(?) AND (region = '' OR LOWER(region) = LOWER(?))", country, request.Address.Region).
+			Order("id ASC").Find(&rates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	ratesFor := func(classID *uint) []models.TaxRate {
+		if classID == nil {
+			classID = setting.DefaultTaxClassID
+		}
+		if classID == nil {
+			return nil
+		}
+		return applicableRates(rates, *classID)
+	}
+
+	result := &TaxResult{}
+	breakdown := make(map[string]*TaxBreakdown)
+
+	charge := func(amount utils.Money, classRates []models.TaxRate) (float64, utils.Money) {
+		combined := 0.0
+		weights := make([]utils.Money, len(classRates))
+		for i, rate := range classRates {
+			combined += rate.Rate
+			weights[i] = utils.Money(math.Round(rate.Rate * 10000))
+		}
+		if combined == 0 || amount == 0 {
+			return 0, 0
+		}
+
+		total := taxOn(amount, combined, request.PricesIncludeTax)
+		taxable := amount
+		if request.PricesIncludeTax {
+			taxable = amount - total
+		}
+		// the tax of stacked rates is split between them without losing a cent
+		shares := total.Allocate(weights)
+		for i, rate := range classRates {
+			key := fmt.Sprintf("%s|%v", rate.Name, rate.Rate)
+			entry, ok := breakdown[key]
+			if !ok {
+				entry = &TaxBreakdown{Name: rate.Name, Rate: rate.Rate}
+				breakdown[key] = entry
+			}
+			entry.TaxableAmount += taxable
+			entry.TaxAmount += shares[i]
+		}
+		return combined, total
+	}
+
+	for _, line := range request.Lines {
+		rate, tax := charge(line.Amount, ratesFor(line.TaxClassID))
+		result.Lines = append(result.Lines, TaxLineResult{Reference: line.Reference, Rate: rate, TaxAmount: tax})
+		result.TotalTax += tax
+	}
+
+	if setting.ShippingTaxClassID != nil {
+		result.ShippingRate, result.ShippingTax = charge(request.Shipping, applicableRates(rates, *setting.ShippingTaxClassID))
+		result.TotalTax += result.ShippingTax
+	}
+
+	for _, entry := range breakdown {
+		result.Breakdown = append(result.Breakdown, *entry)
+	}
+	sort.Slice(result.Breakdown, func(i, j int) bool { return result.Breakdown[i].Name < result.Breakdown[j].Name })
+
+	return result, nil
+}
+
+// applicableRates picks the rates of a tax class, preferring region specific rates over country wide ones.
+// Several rates at the same level (e.g. state and county) are charged together.
+func applicableRates(rates []models.TaxRate, classID uint) []models.TaxRate {
+	var country, region []models.TaxRate
+	for _, rate := range rates {
+		if rate.TaxClassID != classID {
+			continue
+		}
+		if strings.TrimSpace(rate.Region) == "" {
+			country = append(country, rate)
+		} else {
+			region = append(region, rate)
+		}
+	}
+	if len(region) != 0 {
+		return region
+	}
+	return country
+}
+
+// taxOn returns the tax for an amount at rate percent, rounded half away from zero per line.
+// Inclusive amounts already contain the tax.
+func taxOn(amount utils.Money, rate float64, inclusive bool) utils.Money {
+	if inclusive {
+		return amount - amount.DivRate(1+rate/100)
+	}
+	return amount.Percent(rate)
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"backend/models"
+	"backend/utils"
+	"reflect"
+	"testing"
+)
+
+func TestTaxOn(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    utils.Money
+		rate      float64
+		inclusive bool
+		want      utils.Money
+	}{
+		{"exclusive", 1000, 20, false, 200},
+		{"inclusive", 1200, 20, true, 200},
+		{"exclusive rounds down", 1005, 7.5, false, 75}, // 75.375
+		{"exclusive rounds up", 1010, 7.5, false, 76},   // 75.75
+		{"half a cent rounds away from zero", 10, 5, false, 1},
+		{"inclusive net rounds to the cent", 999, 20, true, 166}, // net 832.5 rounds to 833
+		{"negative amount", -1010, 7.5, false, -76},
+		{"zero rate", 1000, 0, false, 0},
+		{"zero rate inclusive", 1000, 0, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := taxOn(test.amount, test.rate, test.inclusive); got != test.want {
+				t.Errorf("taxOn(%s, %v, %v) = %s, want %s", test.amount, test.rate, test.inclusive, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplicableRates(t *testing.T) {
+	rate := func(id uint, classID uint, region string) models.TaxRate {
+		r := models.TaxRate{TaxClassID: classID, Region: region}
+		r.ID = id
+		return r
+	}
+	rates := []models.TaxRate{
+		rate(1, 1, ""),
+		rate(2, 1, "CA"),
+		rate(3, 1, "CA"),
+		rate(4, 2, " "),
+		rate(5, 3, "NY"),
+	}
+
+	tests := []struct {
+		name    string
+		classID uint
+		want    []uint
+	}{
+		{"region rates win and stack", 1, []uint{2, 3}},
+		{"blank region is country wide", 2, []uint{4}},
+		{"region rate alone", 3, []uint{5}},
+		{"class without rates", 4, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []uint
+			for _, r := range applicableRates(rates, test.classID) {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("applicableRates(class %d) = %v, want %v", test.classID, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryInUse = errors.New("the category still has products or sub categories")
+	ErrBrandInUse    = errors.New("the brand still has products")
+	ErrTrashedParent = errors.New("the category or brand it belongs to is in the trash, restore it first")
+	ErrStillReferred = errors.New("orders, invoices, promotions or other records still refer to it")
+)
+
+// TrashRetention is how long deleted products, categories and brands stay in the trash before
+// they are purged
+var TrashRetention = 30 * 24 * time.Hour
+
+// TrashProduct soft deletes a product with its variations, variants and stock. They are all
+// stamped with the same time, so a restore brings back exactly what was deleted together.
+func TrashProduct(tx *gorm.DB, product models.Product) error {
+	ids, err := familyOf(tx, product.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, model := range []interface{}{&models.Product{}, &models.ProductVariant{}, &models.Inventory{}} {
+		column := "product_id"
+		if _, ok := model.(*models.Product); ok {
+			column = "id"
+		}
+		if err := tx.Model(model).Where(column+" IN ?", ids).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreProduct brings a product back from the trash with what was deleted along with it
+func RestoreProduct(tx *gorm.DB, id uint) (*models.Product, error) {
+	var product models.Product
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL AND is_child = false").First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkLive(tx, &models.Category{}, &product.CategoryID); err != nil {
+		return nil, err
+	}
+	if err := checkLive(tx, &models.Brand{}, product.BrandID); err != nil {
+		return nil, err
+	}
+
+	ids, err := familyOf(tx.Unscoped(), product.ID)
+	if err != nil {
+		return nil, err
+	}
+	deletedAt := product.DeletedAt.Time
+	for _, model := range []interface{}{&models.Product{}, &models.ProductVariant{}, &models.Inventory{}} {
+		column := "product_id"
+		if _, ok := model.(*models.Product); ok {
+			column = "id"
+		}
+		if err := tx.Unscoped().Model(model).Where(column+" IN ? AND deleted_at = ?", ids, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	product.DeletedAt = gorm.DeletedAt{}
+	return &product, nil
+}
+
+// PurgeProduct permanently deletes a product in the trash and everything kept about it. Products
+// that were ordered stay, the orders and invoices refer to them. The uploaded images only the
+// product showed are deleted and returned, their files are left to the caller to discard with
+// models.DiscardImageFiles once the transaction commits.
+func PurgeProduct(tx *gorm.DB, id uint) ([]models.Image, error) {
+	var product models.Product
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL AND is_child = false").First(&product, id).Error; err != nil {
+		return nil, err
+	}
+	ids, err := familyOf(tx.Unscoped(), product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	referred, err := anyRows(
+		tx.Model(&models.OrderItem{}).Where("product_id IN ?", ids),
+		tx.Model(&models.InvoiceLine{}).Where("product_id IN ?", ids),
+		tx.Model(&models.Promotion{}).Unscoped().Where("buy_product_id IN ? OR get_product_id IN ?", ids, ids),
+		tx.Model(&models.PromotionBundleItem{}).Where("product_id IN ?", ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if referred {
+		return nil, ErrStillReferred
+	}
+
+	var imageIDs []uint
+	if err := tx.Model(&models.ProductImage{}).Distinct("image_id").
+		Where("product_id IN ? AND image_id IS NOT NULL", ids).Pluck("image_id", &imageIDs).Error; err != nil {
+		return nil, err
+	}
+
+	variants := tx.Unscoped().Model(&models.ProductVariant{}).Select("id").Where("product_id IN ?", ids)
+	options := tx.Model(&models.ProductOption{}).Select("id").Where("product_id IN ?", ids)
+	deletes := []struct {
+		model interface{}
+		query string
+		args  []interface{}
+	}{
+		{&models.VariantOptionValue{}, "variant_id IN (?)", []interface{}{variants}},
+		{&models.ProductVariantValue{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductOptionValue{}, "option_id IN (?)", []interface{}{options}},
+		{&models.ProductOption{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductImage{}, "product_id IN ?", []interface{}{ids}},
+		{&models.Inventory{}, "product_id IN ?", []interface{}{ids}},
+		{&models.CartItem{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductVariant{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductPrice{}, "product_id IN ?", []interface{}{ids}},
+		{&models.PriceHistory{}, "product_id IN ?", []interface{}{ids}},
+		{&models.PriceSchedule{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductDraft{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductRevision{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductAttribute{}, "product_id IN ?", []interface{}{ids}},
+		{&models.Review{}, "product_id IN ?", []interface{}{ids}},
+		{&models.WishList{}, "product_id IN ?", []interface{}{ids}},
+		{&models.CollectionProduct{}, "product_id IN ?", []interface{}{ids}},
+		{&models.ProductRelation{}, "product_id IN ? OR related_product_id IN ?", []interface{}{ids, ids}},
+		{&models.ProductCoPurchase{}, "product_id IN ? OR related_product_id IN ?", []interface{}{ids, ids}},
+		{&models.SlugRedirect{}, "entity_type = ? AND entity_id IN ?", []interface{}{SlugProduct, ids}},
+		{&models.Product{}, "id IN ?", []interface{}{ids}},
+	}
+	if err := tx.Exec("DELETE FROM product_tags WHERE product_id IN ?", ids).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range deletes {
+		if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+			return nil, err
+		}
+	}
+	return deleteUnusedImages(tx, imageIDs)
+}
+
+// deleteUnusedImages deletes the uploaded images of ids that no product, category, brand or
+// content image shows anymore and returns them
+func deleteUnusedImages(tx *gorm.DB, ids []uint) ([]models.Image, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	unused := tx.Where("id IN ?", ids)
+	for _, table := range []string{"product_images", "category_images", "brand_images", "content_images"} {
+		unused = unused.Where("NOT EXISTS (SELECT 1 FROM " + table + " WHERE " + table + ".image_id = images.id)")
+	}
+	var images []models.Image
+	if err := unused.Find(&images).Error; err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+	if err := tx.Delete(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// TrashCategory soft deletes a category that has no products or sub categories left
+func TrashCategory(tx *gorm.DB, category models.Category) error {
+	inUse, err := anyRows(
+		tx.Model(&models.Product{}).Where("category_id = ?", category.ID),
+		tx.Model(&models.Category{}).Where("parent_id = ?", category.ID),
+	)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+	return tx.Delete(&category).Error
+}
+
+// RestoreCategory brings a category back from the trash, after its parent
+func RestoreCategory(tx *gorm.DB, id uint) (*models.Category, error) {
+	var category models.Category
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkLive(tx, &models.Category{}, category.ParentID); err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Model(&category).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// PurgeCategory permanently deletes a category in the trash, once no product or sub category
+// refers to it, even from the trash
+func PurgeCategory(tx *gorm.DB, id uint) error {
+	var category models.Category
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&category, id).Error; err != nil {
+		return err
+	}
+	referred, err := anyRows(
+		tx.Unscoped().Model(&models.Product{}).Where("category_id = ?", id),
+		tx.Unscoped().Model(&models.Category{}).Where("parent_id = ?", id),
+		tx.Unscoped().Model(&models.Promotion{}).Where("category_id = ?", id),
+	)
+	if err != nil {
+		return err
+	}
+	if referred {
+		return ErrStillReferred
+	}
+
+	for _, model := range []interface{}{&models.CategoryImage{}, &models.LoyaltyCategoryMultiplier{}} {
+		if err := tx.Where("category_id = ?", id).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("entity_type = ? AND entity_id = ?", SlugCategory, id).Delete(&models.SlugRedirect{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&category).Error
+}
+
+// TrashBrand soft deletes a brand that has no products left
+func TrashBrand(tx *gorm.DB, brand models.Brand) error {
+	inUse, err := anyRows(tx.Model(&models.Product{}).Where("brand_id = ?", brand.ID))
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrBrandInUse
+	}
+	return tx.Delete(&brand).Error
+}
+
+// RestoreBrand brings a brand back from the trash
+func RestoreBrand(tx *gorm.DB, id uint) (*models.Brand, error) {
+	var brand models.Brand
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&brand, id).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Model(&brand).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return &brand, nil
+}
+
+// PurgeBrand permanently deletes a brand in the trash, once no product refers to it, even from
+// the trash
+func PurgeBrand(tx *gorm.DB, id uint) error {
+	var brand models.Brand
+	if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&brand, id).Error; err != nil {
+		return err
+	}
+	referred, err := anyRows(tx.Unscoped().Model(&models.Product{}).Where("brand_id = ?", id))
+	if err != nil {
+		return err
+	}
+	if referred {
+		return ErrStillReferred
+	}
+
+	if err := tx.Where("brand_id = ?", id).Delete(&models.BrandImage{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("entity_type = ? AND entity_id = ?", SlugBrand, id).Delete(&models.SlugRedirect{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&brand).Error
+}
+
+// TrashPurgeResult counts what a purge of the trash deleted and kept
+type TrashPurgeResult struct {
+	Purged int
+	Kept   int // Still referred to, such as products that were ordered
+}
+
+// PurgeTrash permanently deletes the products, brands and categories deleted before the given
+// time. Each is purged on its own, one that cannot be does not hold up the others.
+func PurgeTrash(db *gorm.DB, deletedBefore time.Time) (TrashPurgeResult, error) {
+	var result TrashPurgeResult
+	var failed error
+
+	// files of images purged in a transaction that did not commit are kept, their rows still exist
+	var discarded []models.Image
+	purgeProduct := func(tx *gorm.DB, id uint) error {
+		images, err := PurgeProduct(tx, id)
+		discarded = append(discarded, images...)
+		return err
+	}
+	purges := []struct {
+		name  string
+		model interface{}
+		where string
+		purge func(tx *gorm.DB, id uint) error
+	}{
+		{"product", &models.Product{}, "deleted_at < ? AND is_child = false", purgeProduct},
+		{"brand", &models.Brand{}, "deleted_at < ?", PurgeBrand},
+		// sub categories were deleted before their parent and go first
+		{"category", &models.Category{}, "deleted_at < ?", PurgeCategory},
+	}
+	for _, p := range purges {
+		var ids []uint
+		if err := db.Unscoped().Model(p.model).Where(p.where, deletedBefore).
+			Order("deleted_at ASC, id ASC").Pluck("id", &ids).Error; err != nil {
+			return result, err
+		}
+		for _, id := range ids {
+			err := db.Transaction(func(tx *gorm.DB) error { return p.purge(tx, id) })
+			switch {
+			case err == nil:
+				result.Purged++
+			case errors.Is(err, ErrStillReferred):
+				result.Kept++
+			default:
+				failed = errors.Join(failed, fmt.Errorf("purging %s %d: %w", p.name, id, err))
+			}
+		}
+	}
+	return result, errors.Join(failed, models.DiscardImageFiles(db, discarded))
+}
+
+// familyOf returns a product with its variations stored as child products
+func familyOf(tx *gorm.DB, productID uint) ([]uint, error) {
+	ids := []uint{productID}
+	var children []uint
+	if err := tx.Model(&models.Product{}).Where("parent_id = ? AND is_child", productID).Pluck("id", &children).Error; err != nil {
+		return nil, err
+	}
+	return append(ids, children...), nil
+}
+
+// checkLive fails with ErrTrashedParent when the record of id is in the trash, an empty id is
+// not checked
+func checkLive(tx *gorm.DB, model interface{}, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	live, err := anyRows(tx.Model(model).Where("id = ?", *id))
+	if err != nil {
+		return err
+	}
+	if !live {
+		return ErrTrashedParent
+	}
+	return nil
+}
+
+// anyRows reports whether any of the queries matches a row
+func anyRows(queries ...*gorm.DB) (bool, error) {
+	for _, query := range queries {
+		var count int64
+		if err := query.Limit(1).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
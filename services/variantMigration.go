@@ -0,0 +1,206 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrDuplicateVariantValues = errors.New("two variations of the product have the same option values")
+
+// VariantMigrationResult counts what MigrateChildVariants converted
+type VariantMigrationResult struct {
+	Products int
+	Variants int
+}
+
+// MigrateChildVariants converts the variations stored as child products into variants of their
+// parent. Stock, cart and order items, wish lists, reviews and images of a child are moved to its
+// variant and the child row is deleted, so the migration can be run again until nothing is left.
+// Every parent is migrated in its own transaction. A parent whose children can't be told apart by
+// their option values, such as two children without a color and size, is left as it is and
+// reported with ErrDuplicateVariantValues, the other parents are still migrated.
+func MigrateChildVariants(db *gorm.DB) (VariantMigrationResult, error) {
+	var result VariantMigrationResult
+
+	var parentIDs []uint
+	if err := db.Model(&models.Product{}).Where("is_child = true AND parent_id IS NOT NULL").
+		Distinct("parent_id").Order("parent_id ASC").Pluck("parent_id", &parentIDs).Error; err != nil {
+		return result, err
+	}
+
+	var errs []error
+	for _, parentID := range parentIDs {
+		var migrated int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			migrated, err = migrateChildren(tx, parentID)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("product %d: %w", parentID, err))
+			continue
+		}
+		result.Products++
+		result.Variants += migrated
+	}
+	return result, errors.Join(errs...)
+}
+
+// migrateChildren converts the child products of one parent
+func migrateChildren(tx *gorm.DB, parentID uint) (int, error) {
+	var parent models.Product
+	if err := tx.First(&parent, parentID).Error; err != nil {
+		return 0, err
+	}
+
+	var children []models.Product
+	if err := tx.Preload("OptionValues.Option").Where("parent_id = ? AND is_child = true", parentID).Order("id ASC").Find(&children).Error; err != nil {
+		return 0, err
+	}
+
+	var options []models.ProductOption
+	if err := tx.Preload("Values", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("product_id = ?", parentID).Order("position ASC").Find(&options).Error; err != nil {
+		return 0, err
+	}
+
+	var existing []models.ProductVariant
+	if err := tx.Preload("Values").Where("product_id = ?", parentID).Find(&existing).Error; err != nil {
+		return 0, err
+	}
+	position := len(existing)
+	// the SKU of the variant having each combination of option values
+	taken := make(map[string]string, len(existing)+len(children))
+	for _, variant := range existing {
+		taken[valuesKey(variant.Values)] = variant.SKU
+	}
+
+	for _, child := range children {
+		values := child.OptionValues
+		if len(values) == 0 {
+			// children created before options only know their color and size
+			var err error
+			values, err = legacyValues(tx, parentID, &options, child)
+			if err != nil {
+				return 0, err
+			}
+		}
+		SortVariantValues(values)
+		for i := range values {
+			values[i].Option = nil
+		}
+		key := valuesKey(values)
+		if sku, ok := taken[key]; ok {
+			return 0, fmt.Errorf("%w: %s and %s", ErrDuplicateVariantValues, sku, child.SKU)
+		}
+		taken[key] = child.SKU
+
+		variant := models.ProductVariant{
+			ProductID:       parentID,
+			SKU:             child.SKU,
+			Barcode:         child.Barcode,
+			Position:        position,
+			Values:          values,
+			LegacyProductID: &child.ID,
+			SalePrice:       child.SalePrice,
+			SaleStartDate:   child.SaleStartDate,
+			SaleEndDate:     child.SaleEndDate,
+		}
+		if child.Price != parent.Price {
+			price := child.Price
+			variant.Price = &price
+		}
+		position++
+
+		if err := tx.Omit("Values.*").Create(&variant).Error; err != nil {
+			return 0, err
+		}
+
+		if err := tx.Model(&models.Inventory{}).Where("product_id = ?", child.ID).
+			Updates(map[string]interface{}{"product_id": parentID, "variant_id": variant.ID}).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.CartItem{}).Where("product_id = ?", child.ID).
+			Updates(map[string]interface{}{"product_id": parentID, "variant_id": variant.ID}).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.OrderItem{}).Where("product_id = ?", child.ID).
+			Updates(map[string]interface{}{"product_id": parentID, "variant_id": variant.ID}).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", child.ID).
+			Updates(map[string]interface{}{"product_id": parentID, "variant_id": variant.ID}).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.WishList{}).Where("product_id = ?", child.ID).Update("product_id", parentID).Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Model(&models.Review{}).Where("product_id = ?", child.ID).Update("product_id", parentID).Error; err != nil {
+			return 0, err
+		}
+
+		// the SKU moves to the variant, the deleted child keeps a marked copy for its history
+		if err := tx.Model(&child).Update("sku", child.SKU+"~migrated").Error; err != nil {
+			return 0, err
+		}
+		if err := tx.Delete(&child).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := RefreshSearchIndex(tx, parentID); err != nil {
+		return 0, err
+	}
+	return len(children), nil
+}
+
+// valuesKey identifies a combination of option values by their IDs, whatever their order
+func valuesKey(values []models.ProductOptionValue) string {
+	ids := make([]int, len(values))
+	for i, value := range values {
+		ids[i] = int(value.ID)
+	}
+	sort.Ints(ids)
+	return fmt.Sprint(ids)
+}
+
+// legacyValues returns the color and size values of a child product, creating the options and
+// values the parent doesn't have yet
+func legacyValues(tx *gorm.DB, parentID uint, options *[]models.ProductOption, child models.Product) ([]models.ProductOptionValue, error) {
+	var values []models.ProductOptionValue
+	for _, pair := range [][2]string{{"Color", child.Color}, {"Size", child.Size}} {
+		name, text := pair[0], strings.TrimSpace(pair[1])
+		if text == "" {
+			continue
+		}
+
+		index := -1
+		for i := range *options {
+			if isOption((*options)[i], name) {
+				index = i
+			}
+		}
+		if index < 0 {
+			option := models.ProductOption{ProductID: parentID, Name: name, Position: len(*options)}
+			if err := tx.Create(&option).Error; err != nil {
+				return nil, err
+			}
+			*options = append(*options, option)
+			index = len(*options) - 1
+		}
+
+		value, err := findOrCreateValue(tx, &(*options)[index], text)
+		if err != nil {
+			return nil, err
+		}
+		copied := *value
+		copied.Option = &models.ProductOption{Name: (*options)[index].Name, Position: (*options)[index].Position}
+		values = append(values, copied)
+	}
+	return values, nil
+}
@@ -0,0 +1,45 @@
+// Package storage keeps uploaded files such as product images outside the database. Records only
+// hold the key of a blob, clients download it from the URL of the key.
+package storage
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// BlobStore keeps blobs under keys shaped like relative paths, such as "products/3f2a.jpg"
+type BlobStore interface {
+	// Put stores data under key, replacing what the key held
+	Put(key string, data []byte, contentType string) error
+	// Get returns the data stored under key, ErrNotFound when there is none
+	Get(key string) ([]byte, error)
+	// Delete removes the blob of key, a missing blob is not an error
+	Delete(key string) error
+	// URL is where clients download the blob of key from
+	URL(key string) string
+}
+
+var ErrNotFound = errors.New("blob not found")
+
+var errInvalidKey = errors.New("invalid blob key")
+
+// Default is the store of the API, set up by config.ConnectBlobStore
+var Default BlobStore
+
+// URL returns where the blob of key is downloaded from, nothing when no blob is stored
+func URL(key string) string {
+	if key == "" || Default == nil {
+		return ""
+	}
+	return Default.URL(key)
+}
+
+// cleanKey rejects keys that would leave the store, such as "../secrets"
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", errInvalidKey
+	}
+	return cleaned, nil
+}
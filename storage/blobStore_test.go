@@ -0,0 +1,35 @@
+package storage
+
+import "testing"
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+		err  bool
+	}{
+		{"products/3f2a.jpg", "products/3f2a.jpg", false},
+		{"/products/3f2a.jpg", "products/3f2a.jpg", false},
+		{"", "", true},
+		{"/", "", true},
+		{"..", "", true},
+		{"../secrets", "", true},
+		{"products/../../secrets", "", true},
+		{"products/../3f2a.jpg", "", true},
+		{"products/./3f2a.jpg", "", true},
+		{"products//3f2a.jpg", "", true},
+		{"products/", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			got, err := cleanKey(test.key)
+			if (err != nil) != test.err {
+				t.Fatalf("cleanKey(%q) error = %v, want error %v", test.key, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("cleanKey(%q) = %q, want %q", test.key, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+)
+
+// The dimensions an uploaded image must have. Larger images are refused before they are decoded.
+const (
+	MinImageSide   = 32
+	MaxImageSide   = 12000
+	MaxImagePixels = 50_000_000
+)
+
+// Rendition is a size an uploaded image is scaled down to, fitting both sides in MaxSide
+type Rendition struct {
+	Name    string
+	MaxSide int
+}
+
+// Renditions are made of every uploaded image, from small to large. An image smaller than a
+// rendition is kept at its own size rather than enlarged.
+var Renditions = []Rendition{
+	{Name: "thumbnail", MaxSide: 160},
+	{Name: "card", MaxSide: 480},
+	{Name: "zoom", MaxSide: 1600},
+}
+
+var (
+	ErrUnsupportedImage = errors.New("images must be JPEG, PNG, GIF or WebP")
+	ErrImageDimensions  = fmt.Errorf("images must be %d to %d pixels wide and high, %d megapixels at most",
+		MinImageSide, MaxImageSide, MaxImagePixels/1_000_000)
+)
+
+// ImageFile is an encoded image produced by the pipeline
+type ImageFile struct {
+	Name        string // "original" or the name of a rendition
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// ProcessedImage is an uploaded image made ready for storage
+type ProcessedImage struct {
+	Format     string // Format of the upload, such as "jpeg"
+	Original   ImageFile
+	Renditions []ImageFile // Every rendition in the fallback format, then in WebP when made
+}
+
+// ProcessImage checks that data is an image of a supported format and size, and re-encodes it
+// without its metadata, turned upright when its EXIF data says it was taken rotated. Each
+// rendition is made as JPEG, or PNG for images with transparency, and as WebP when every WebP
+// rendition is smaller than its JPEG or PNG.
+func ProcessImage(data []byte) (*ProcessedImage, error) {
+	format, err := ValidateImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	img := toNRGBA(decoded)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	opaque := img.Opaque()
+
+	processed := &ProcessedImage{Format: format}
+	// re-encoding drops the EXIF data, such as the location a photo was taken at
+	if format == "jpeg" {
+		processed.Original, err = encodeJPEG("original", img, 90)
+	} else {
+		processed.Original, err = encodePNG("original", img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var webps []ImageFile
+	smaller := true
+	for _, rendition := range Renditions {
+		scaled := fit(img, rendition.MaxSide)
+		var fallback ImageFile
+		if opaque {
+			fallback, err = encodeJPEG(rendition.Name, scaled, 82)
+		} else {
+			fallback, err = encodePNG(rendition.Name, scaled)
+		}
+		if err != nil {
+			return nil, err
+		}
+		webp, err := encodeWebP(rendition.Name, scaled)
+		if err != nil {
+			return nil, err
+		}
+		processed.Renditions = append(processed.Renditions, fallback)
+		webps = append(webps, webp)
+		smaller = smaller && len(webp.Data) < len(fallback.Data)
+	}
+	// the WebP encoder is lossless, which beats PNG graphics but rarely JPEG photos
+	if smaller {
+		processed.Renditions = append(processed.Renditions, webps...)
+	}
+	return processed, nil
+}
+
+// ValidateImage checks the format and dimensions of image data from its header and returns the format
+func ValidateImage(data []byte) (string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedImage
+	}
+	switch format {
+	case "jpeg", "png", "gif", "webp":
+	default:
+		return "", ErrUnsupportedImage
+	}
+	if config.Width < MinImageSide || config.Height < MinImageSide ||
+		config.Width > MaxImageSide || config.Height > MaxImageSide ||
+		config.Width*config.Height > MaxImagePixels {
+		return "", ErrImageDimensions
+	}
+	return format, nil
+}
+
+func toNRGBA(src image.Image) *image.NRGBA {
+	if img, ok := src.(*image.NRGBA); ok && img.Rect.Min == (image.Point{}) {
+		return img
+	}
+	bounds := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Rect, src, bounds.Min, draw.Src)
+	return img
+}
+
+// fit scales img down to fit in a square of side pixels
+func fit(img *image.NRGBA, side int) *image.NRGBA {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if width <= side && height <= side {
+		return img
+	}
+	if width >= height {
+		height, width = max(1, height*side/width), side
+	} else {
+		width, height = max(1, width*side/height), side
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(scaled, scaled.Rect, img, img.Rect, xdraw.Src, nil)
+	return scaled
+}
+
+func encodeJPEG(name string, img *image.NRGBA, quality int) (ImageFile, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	return ImageFile{Name: name, ContentType: "image/jpeg", Width: img.Rect.Dx(), Height: img.Rect.Dy(), Data: buf.Bytes()}, err
+}
+
+func encodePNG(name string, img *image.NRGBA) (ImageFile, error) {
+	var buf bytes.Buffer
+	err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	return ImageFile{Name: name, ContentType: "image/png", Width: img.Rect.Dx(), Height: img.Rect.Dy(), Data: buf.Bytes()}, err
+}
+
+func encodeWebP(name string, img *image.NRGBA) (ImageFile, error) {
+	var buf bytes.Buffer
+	err := nativewebp.Encode(&buf, img, nil)
+	return ImageFile{Name: name, ContentType: "image/webp", Width: img.Rect.Dx(), Height: img.Rect.Dy(), Data: buf.Bytes()}, err
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG file, 1 (upright) when it has none
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[0] == 0xFF && data[1] == 0xD8; {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1 // the image data starts, no EXIF came before it
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag of the first image directory of TIFF data
+func exifOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns an image stored with an EXIF orientation other than 1 upright
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = width-1-x, y
+			case 3: // upside down
+				dx, dy = width-1-x, height-1-y
+			case 4: // upside down and mirrored
+				dx, dy = x, height-1-y
+			case 5: // mirrored along the diagonal
+				dx, dy = y, x
+			case 6: // turned clockwise to be upright
+				dx, dy = height-1-y, x
+			case 7: // mirrored along the other diagonal
+				dx, dy = height-1-y, width-1-x
+			case 8: // turned counterclockwise to be upright
+				dx, dy = y, width-1-x
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"testing"
+)
+
+// pngHeader is the start of a PNG file of the given size, enough for its dimensions to be read
+func pngHeader(width, height int) []byte {
+	chunk := []byte("IHDR")
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(width))
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(height))
+	chunk = append(chunk, 8, 6, 0, 0, 0) // 8 bit RGBA, not interlaced
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(chunk)-4))
+	data = append(data, chunk...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+}
+
+func TestValidateImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	jpegFile, err := encodeJPEG("original", img, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webpFile, err := encodeWebP("original", img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		err    error
+	}{
+		{"jpeg", jpegFile.Data, "jpeg", nil},
+		{"png", pngHeader(MaxImageSide, 4000), "png", nil},
+		{"gif", gifData.Bytes(), "gif", nil},
+		{"webp", webpFile.Data, "webp", nil},
+		{"not an image", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "", ErrUnsupportedImage},
+		{"empty", nil, "", ErrUnsupportedImage},
+		{"smallest", pngHeader(MinImageSide, MinImageSide), "png", nil},
+		{"too narrow", pngHeader(MinImageSide-1, 400), "", ErrImageDimensions},
+		{"too low", pngHeader(400, MinImageSide-1), "", ErrImageDimensions},
+		{"too wide", pngHeader(MaxImageSide+1, 400), "", ErrImageDimensions},
+		{"too high", pngHeader(400, MaxImageSide+1), "", ErrImageDimensions},
+		// both sides fit, the pixels of the decoded image would not
+		{"too many pixels", pngHeader(8000, 7000), "", ErrImageDimensions},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := ValidateImage(test.data)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ValidateImage error = %v, want %v", err, test.err)
+			}
+			if format != test.format {
+				t.Errorf("ValidateImage format = %q, want %q", format, test.format)
+			}
+		})
+	}
+}
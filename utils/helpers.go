@@ -1,111 +1,53 @@
 package utils
 
 import (
+	cryptorand "crypto/rand"
 	"encoding/base64"
-	"fmt"
 	"time"
 
 	"math/rand"
 )
 
+// Parameters are the filters and sort order of the product listings. Brands, colors, sizes and price ranges
+// take several values, repeated (brand_id=1&brand_id=2) or comma separated (brand_id=1,2).
 type Parameters struct {
-	Featured   string `form:"featured"`
-	CategoryID string `form:"category_id"`
-	BrandID    string `form:"brand_id"`
-	StartPrice *int   `form:"start_price"`
-	EndPrice   *int   `form:"end_price"`
-	Status     string `form:"status"`
-	Month      string `form:"month"`
-	Key        string `form:"key"`
+	Featured     string   `form:"featured"`
+	CategoryID   string   `form:"category_id"`
+	BrandID      []string `form:"brand_id"`
+	Colors       []string `form:"colors"`
+	Sizes        []string `form:"sizes"`
+	Tags         []string `form:"tag"` // Tag slugs, a product needs one of them
+	StartPrice   *int     `form:"start_price"`
+	EndPrice     *int     `form:"end_price"`
+	Prices       []string `form:"price"`         // Price ranges such as 25-50, or 200- without an upper bound
+	PriceBuckets string   `form:"price_buckets"` // Bounds of the price facet, such as 25,50,100
+	Rating       *int     `form:"rating"`        // Lowest average rating
+	InStock      bool     `form:"in_stock"`
+	Status       string   `form:"status"`
+	Month        string   `form:"month"`
+	Key          string   `form:"key"`
+	Sort         string   `form:"sort"`        // price_asc, price_desc, newest, rating, best_selling, trending or name
+	WindowDays   *int     `form:"window_days"` // Days of sales ranking best_selling and trending
 }
 
-func ProductQueryParameterToMap(P Parameters) string {
-	querystring := ""
-
-	if P.Month != "" {
-		if querystring != "" {
-			querystring = querystring + " AND EXTRACT(MONTH from products.created_at) = " + P.Month
-
-		} else {
-			querystring = "EXTRACT(MONTH from products.created_at) = " + P.Month
-		}
-	}
-
-	if P.CategoryID != "" {
-		if querystring != "" {
-			recursive := fmt.Sprintf(`WITH RECURSIVE category_tree AS (
-				SELECT id, parent_id FROM categories WHERE id = %s
-				UNION ALL
-				SELECT c.id, c.parent_id
-				FROM categories c
-				INNER JOIN category_tree ct ON c.parent_id = ct.id
-			)
-			SELECT id FROM category_tree`, P.CategoryID)
-			querystring = querystring + " AND category_id IN (" + recursive + ")"
-
-		} else {
-			recursive := fmt.Sprintf(`WITH RECURSIVE category_tree AS (
-							SELECT id, parent_id FROM categories WHERE id = %s
-							UNION ALL
-							SELECT c.id, c.parent_id
-							FROM categories c
-							INNER JOIN category_tree ct ON c.parent_id = ct.id
-						)
-						SELECT id FROM category_tree`, P.CategoryID)
-			querystring = "category_id IN (" + recursive + ")"
-		}
-	}
-	if P.BrandID != "" {
-		if querystring != "" {
-			querystring = querystring + " AND brand_id IN (" + P.BrandID + ")"
-
-		} else {
-			querystring = "brand_id IN (" + P.BrandID + ")"
-		}
-	}
-	if P.Featured != "" {
-		if querystring != "" {
-			querystring = querystring + " AND products.featured = " + P.Featured
-
-		} else {
-			querystring = "products.featured = " + P.Featured
-		}
-	}
-	if P.Status != "" {
-		if querystring != "" {
-			querystring = querystring + " AND products.status = '" + P.Status + "'"
-
-		} else {
-			querystring = "products.status = '" + P.Status + "'"
-		}
-	}
-
-	if P.StartPrice != nil && P.EndPrice != nil {
-		if querystring != "" {
-			querystring = querystring + " AND " + fmt.Sprintf("price >= %d AND price <= %d", *P.StartPrice, *P.EndPrice)
-
-		} else {
-			querystring = fmt.Sprintf("price >= %d AND price <= %d", *P.StartPrice, *P.EndPrice)
-		}
-
-	} else if P.StartPrice != nil && P.EndPrice == nil {
-		if querystring != "" {
-			querystring = querystring + " AND " + fmt.Sprintf("price >= %d", *P.StartPrice)
-
-		} else {
-			querystring = fmt.Sprintf("price >= %d", *P.StartPrice)
-		}
-
-	} else if P.StartPrice == nil && P.EndPrice != nil {
-		if querystring != "" {
-			querystring = querystring + " AND " + fmt.Sprintf("price <= %d", *P.EndPrice)
-
-		} else {
-			querystring = fmt.Sprintf("price <= %d", *P.EndPrice)
-		}
-	}
-	return querystring
-}
+// EffectivePriceColumn resolves the price a product currently sells for, honouring an active sale window
+const EffectivePriceColumn = `(CASE
+	WHEN products.sale_price IS NOT NULL
+		AND (products.sale_start_date IS NULL OR products.sale_start_date <= NOW())
+		AND (products.sale_end_date IS NULL OR products.sale_end_date > NOW())
+	THEN products.sale_price
+	ELSE products.price
+END)`
+
+// BasePriceColumn is EffectivePriceColumn converted from the currency of the product into the base
+// currency, so products priced in different currencies compare by what they are worth. A price in
+// the base currency, or in a currency without a rate, is taken as it is.
+const BasePriceColumn = `ROUND(` + EffectivePriceColumn + ` / COALESCE((
+	SELECT currencies.rate
+	FROM currencies
+	WHERE currencies.code = products.currency
+	AND currencies.code <> COALESCE((SELECT currency_settings.base_currency FROM currency_settings ORDER BY currency_settings.id LIMIT 1), 'USD')
+), 1), 2)`
 
 func GenerateOrderID() string {
 	const charset = "0123456789"
@@ -137,6 +79,25 @@ func GenerateTransactionID() string {
 	return "INV" + string(txID)
 }
 
+// GenerateGiftCardCode returns a random gift card code like GC-XXXX-XXXX-XXXX-XXXX.
+// Codes act as bearer credentials so they come from crypto/rand.
+func GenerateGiftCardCode() (string, error) {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	raw := make([]byte, 16)
+	if _, err := cryptorand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := "GC"
+	for i, b := range raw {
+		if i%4 == 0 {
+			code += "-"
+		}
+		code += string(charset[int(b)%len(charset)])
+	}
+	return code, nil
+}
+
 // Decode Base64 string to []byte
 func DecodeBase64Image(base64String string) ([]byte, error) {
 	decodedImage, err := base64.StdEncoding.DecodeString(base64String)
@@ -145,8 +106,3 @@ func DecodeBase64Image(base64String string) ([]byte, error) {
 	}
 	return decodedImage, nil
 }
-
-func EncodeImageToBase64(imageBytes []byte) string {
-	encodedString := base64.StdEncoding.EncodeToString(imageBytes)
-	return encodedString
-}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (cents). It is stored in decimal(10,2) columns and
+// encoded in JSON as a plain number, so clients keep receiving 12.5 for twelve and a half.
+//
+// Rounding rules: any operation that produces a fraction of a cent (percentages, tax, exchange
+// rates, proportional shares) rounds half away from zero to the nearest cent. Allocate splits an
+// amount without losing or creating cents.
+type Money int64
+
+const moneyScale = 100
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ParseMoney parses a decimal amount such as "12.5", "-3" or "1e2", rounding to the nearest cent
+func ParseMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, ErrInvalidMoney
+	}
+	return roundRat(r.Mul(r, big.NewRat(moneyScale, 1))), nil
+}
+
+// MoneyFromFloat converts a float amount, rounding to the nearest cent
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// Float64 returns the amount in major units. Use it for display or ratios only.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// String returns the amount with two decimals, e.g. "12.50"
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyScale, v%moneyScale)
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// MulRate multiplies the amount by a factor such as an exchange rate, rounding to the nearest cent
+func (m Money) MulRate(factor float64) Money {
+	return m.scale(factorRat(factor))
+}
+
+// DivRate divides the amount by a factor such as an exchange rate, rounding to the nearest cent
+func (m Money) DivRate(factor float64) Money {
+	f := factorRat(factor)
+	if f.Sign() == 0 {
+		return 0
+	}
+	return m.scale(f.Inv(f))
+}
+
+// Percent returns percent % of the amount, rounding to the nearest cent
+func (m Money) Percent(percent float64) Money {
+	f := factorRat(percent)
+	return m.scale(f.Quo(f, big.NewRat(100, 1)))
+}
+
+// MulDiv returns the amount times numerator / denominator, rounding to the nearest cent.
+// It is used for proportional shares, e.g. the part of a discount that falls on one line.
+func (m Money) MulDiv(numerator Money, denominator Money) Money {
+	if denominator == 0 {
+		return 0
+	}
+	return m.scale(big.NewRat(int64(numerator), int64(denominator)))
+}
+
+// Allocate splits the amount proportionally to weights. The shares always add up to the
+// amount exactly; leftover cents go to the shares with the largest remainders.
+func (m Money) Allocate(weights []Money) []Money {
+	shares := make([]Money, len(weights))
+	var total Money
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 || len(weights) == 0 {
+		return shares
+	}
+
+	type remainder struct {
+		index int
+		value *big.Rat
+	}
+	var allocated Money
+	remainders := make([]remainder, len(weights))
+	for i, w := range weights {
+		exact := new(big.Rat).Mul(big.NewRat(int64(m), 1), big.NewRat(int64(w), int64(total)))
+		floor := new(big.Int).Quo(exact.Num(), exact.Denom())
+		shares[i] = Money(floor.Int64())
+		allocated += shares[i]
+		remainders[i] = remainder{i, new(big.Rat).Sub(exact, new(big.Rat).SetInt(floor))}
+	}
+
+	step := Money(1)
+	if m < 0 {
+		step = -1
+	}
+	for left := m - allocated; left != 0; left -= step {
+		best := -1
+		for i, r := range remainders {
+			if best == -1 || r.value.Cmp(remainders[best].value)*int(step) > 0 {
+				best = i
+			}
+		}
+		shares[remainders[best].index] += step
+		remainders[best].value = new(big.Rat)
+	}
+	return shares
+}
+
+// MinMoney returns the smaller of two amounts
+func MinMoney(a Money, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MaxMoney returns the larger of two amounts
+func MaxMoney(a Money, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (m Money) scale(factor *big.Rat) Money {
+	return roundRat(new(big.Rat).Mul(big.NewRat(int64(m), 1), factor))
+}
+
+// factorRat turns a float factor into the decimal it was written as, so 0.1 is exactly one tenth
+func factorRat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// roundRat rounds a rational amount of cents half away from zero
+func roundRat(r *big.Rat) Money {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	quotient, rest := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rest.Mul(rest, big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quotient.Neg(quotient)
+	}
+	return Money(quotient.Int64())
+}
+
+// MarshalJSON encodes the amount as a number without trailing zeros
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON accepts a number or a quoted decimal string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		return nil
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a decimal column
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		*m = parsed
+		return err
+	case string:
+		parsed, err := ParseMoney(v)
+		*m = parsed
+		return err
+	case int64:
+		*m = Money(v * moneyScale)
+		return nil
+	case float64:
+		*m = MoneyFromFloat(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Money", value)
+}
+
+// Value writes the amount as a decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Money
+		err   bool
+	}{
+		{"12.5", 1250, false},
+		{" -3 ", -300, false},
+		{"1e2", 10000, false},
+		{"0.005", 1, false},   // half a cent rounds away from zero
+		{"-0.005", -1, false}, // on both sides
+		{"0.0049", 0, false},
+		{"19.999", 2000, false},
+		{"abc", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := ParseMoney(test.input)
+			if (err != nil) != test.err {
+				t.Fatalf("ParseMoney(%q) error = %v, want error %v", test.input, err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMoneyRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"percent", Money(1999).Percent(15), 300},       // 299.85
+		{"percent half cent", Money(10).Percent(5), 1},  // 0.5
+		{"negative percent", Money(-10).Percent(5), -1}, // -0.5
+		{"decimal percent is exact", Money(1000).Percent(0.1), 1},
+		{"mul rate", Money(1000).MulRate(0.85), 850},
+		{"mul rate half cent", Money(1).MulRate(1.5), 2}, // 1.5
+		{"div rate", Money(1000).DivRate(3), 333},
+		{"div rate half cent", Money(5).DivRate(2), 3}, // 2.5
+		{"div by zero", Money(1000).DivRate(0), 0},
+		{"mul div", Money(1000).MulDiv(1, 3), 333},
+		{"mul div half cent", Money(1).MulDiv(1, 2), 1},
+		{"mul div by zero", Money(1000).MulDiv(1, 0), 0},
+		{"mul", Money(1250).Mul(3), 3750},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.got != test.want {
+				t.Errorf("got %d, want %d", test.got, test.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []Money
+		want    []Money
+	}{
+		{"even split", 900, []Money{1, 1, 1}, []Money{300, 300, 300}},
+		{"leftover cent to the largest remainder", 1000, []Money{1, 1, 1}, []Money{334, 333, 333}},
+		{"proportional", 1000, []Money{100, 300}, []Money{250, 750}},
+		{"leftover cents by remainder", 100, []Money{1, 2, 4}, []Money{14, 29, 57}}, // 14.29, 28.57, 57.14
+		{"negative amount", -1000, []Money{1, 1, 1}, []Money{-334, -333, -333}},
+		{"zero weight gets nothing", 500, []Money{0, 5}, []Money{0, 500}},
+		{"zero weights", 500, []Money{0, 0}, []Money{0, 0}},
+		{"no weights", 500, nil, []Money{}},
+		{"zero amount", 0, []Money{1, 2}, []Money{0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.amount.Allocate(test.weights)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Allocate(%d, %v) = %v, want %v", test.amount, test.weights, got, test.want)
+			}
+			if len(test.weights) == 0 {
+				return
+			}
+			var sum, weights Money
+			for i, share := range got {
+				sum += share
+				weights += test.weights[i]
+			}
+			if weights != 0 && sum != test.amount {
+				t.Errorf("shares add up to %d, want %d", sum, test.amount)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		money Money
+		json  string
+	}{
+		{1250, "12.5"},
+		{10000, "100"},
+		{5, "0.05"},
+		{0, "0"},
+		{-199, "-1.99"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.json, func(t *testing.T) {
+			data, err := json.Marshal(test.money)
+			if err != nil || string(data) != test.json {
+				t.Fatalf("Marshal(%d) = %s, %v, want %s", test.money, data, err, test.json)
+			}
+			var decoded Money
+			if err := json.Unmarshal(data, &decoded); err != nil || decoded != test.money {
+				t.Errorf("Unmarshal(%s) = %d, %v, want %d", data, decoded, err, test.money)
+			}
+		})
+	}
+
+	var quoted Money
+	if err := json.Unmarshal([]byte(`"7.25"`), &quoted); err != nil || quoted != 725 {
+		t.Errorf(`Unmarshal("7.25") = %d, %v, want 725`, quoted, err)
+	}
+}
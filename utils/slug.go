@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxSlugLength leaves room for the "-2" suffix that makes a slug unique
+const MaxSlugLength = 190
+
+// Slugify turns a name into a URL path segment, "Linen Shirt – Blue" becomes "linen-shirt-blue".
+// Accents are dropped, letters of other scripts are kept, everything else separates words.
+func Slugify(text string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(strings.ToLower(text)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining accent of the previous letter
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if slug.Len()+len(string(r)) > MaxSlugLength {
+				return strings.Trim(slug.String(), "-")
+			}
+			slug.WriteRune(r)
+			dash = false
+		case slug.Len() > 0 && !dash:
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.Trim(slug.String(), "-")
+}